@@ -1,11 +1,18 @@
 package rdb
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 )
 
+// the size of the chunks the discarded bytes are read in.
+const discardChunkSize = 32 << 10
+
+var errNegativeRead = errors.New("negative number of bytes to read")
+
 // a partial view of buffer, starting from a particular position.
 type bufferView interface {
 	buffer
@@ -14,6 +21,8 @@ type bufferView interface {
 
 type buffer interface {
 	Get(n int) ([]byte, error)
+	// Discard skips the next n bytes, without returning them.
+	Discard(n int) error
 	Pos() int
 	SupportsView() bool
 	View(pos int) (bufferView, error)
@@ -21,6 +30,47 @@ type buffer interface {
 	Crc() uint64
 }
 
+// reusableBuffer is implemented by the buffers that can reuse the memory
+// of the bytes they return, once the entry they belong to is released.
+type reusableBuffer interface {
+	// enableReuse makes the buffer reuse its memory. Once it is called,
+	// the bytes returned from the buffer are valid only until the
+	// entry they belong to is released.
+	enableReuse()
+
+	// release is called at the beginning of each entry, after which
+	// the bytes returned for the previous entries are not used.
+	release()
+}
+
+// sizedBuffer is implemented by the buffers that know the
+// number of bytes they can return up front.
+type sizedBuffer interface {
+	size() int
+}
+
+// recordingBuffer is a buffer that keeps a copy of the bytes read from it.
+type recordingBuffer struct {
+	buffer
+	recorded []byte
+}
+
+func (b *recordingBuffer) Get(n int) ([]byte, error) {
+	value, err := b.buffer.Get(n)
+	if err != nil {
+		return nil, err
+	}
+
+	b.recorded = append(b.recorded, value...)
+	return value, nil
+}
+
+func (b *recordingBuffer) Discard(n int) error {
+	// the skipped bytes are recorded as well
+	_, err := b.Get(n)
+	return err
+}
+
 type memoryBackedBuffer struct {
 	buf []byte
 	len int
@@ -35,12 +85,9 @@ func newMemoryBackedBuffer(buf []byte) *memoryBackedBuffer {
 }
 
 func (b *memoryBackedBuffer) Get(n int) ([]byte, error) {
-	if b.len < b.pos+n {
-		if b.len == b.pos {
-			return nil, io.EOF
-		}
-
-		return nil, io.ErrUnexpectedEOF
+	err := b.check(n)
+	if err != nil {
+		return nil, err
 	}
 
 	value := b.buf[b.pos : b.pos+n]
@@ -48,10 +95,41 @@ func (b *memoryBackedBuffer) Get(n int) ([]byte, error) {
 	return value, nil
 }
 
+func (b *memoryBackedBuffer) Discard(n int) error {
+	err := b.check(n)
+	if err != nil {
+		return err
+	}
+
+	b.pos += n
+	return nil
+}
+
+// check returns an error if there are not n bytes left in the buffer.
+func (b *memoryBackedBuffer) check(n int) error {
+	if n < 0 {
+		return errNegativeRead
+	}
+
+	if b.len-b.pos < n {
+		if b.len == b.pos {
+			return io.EOF
+		}
+
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
 func (b *memoryBackedBuffer) Pos() int {
 	return b.pos
 }
 
+func (b *memoryBackedBuffer) size() int {
+	return b.len
+}
+
 func (b *memoryBackedBuffer) DoNotCalcCrc() {
 	// nop
 }
@@ -82,6 +160,10 @@ func (v *memoryBackedBufferView) Get(n int) ([]byte, error) {
 	return v.buf.Get(n)
 }
 
+func (v *memoryBackedBufferView) Discard(n int) error {
+	return v.buf.Discard(n)
+}
+
 func (v *memoryBackedBufferView) Pos() int {
 	return v.buf.Pos()
 }
@@ -143,6 +225,14 @@ type fileBackedBuffer struct {
 	len     int
 	pos     int
 	crcCalc *crcCalculator
+	// whether the spare buffer is reused for the next reads
+	reuse bool
+	// the buffer that was replaced by the last read, which can be
+	// reused once the entries with bytes in it are released
+	spare     []byte
+	spareFree bool
+	// the buffer the discarded bytes are read into, for the CRC
+	discardBuf []byte
 }
 
 func newFileBackedBuffer(file *os.File, fileLen int, bufCap int) *fileBackedBuffer {
@@ -161,13 +251,9 @@ func newFileBackedBuffer(file *os.File, fileLen int, bufCap int) *fileBackedBuff
 }
 
 func (b *fileBackedBuffer) Get(n int) ([]byte, error) {
-	if b.fileLen < b.filePos+n {
-		// we use the file pos as the source of truth
-		if b.fileLen == b.filePos {
-			return nil, io.EOF
-		}
-
-		return nil, io.ErrUnexpectedEOF
+	err := b.check(n)
+	if err != nil {
+		return nil, err
 	}
 
 	if b.len < b.pos+n {
@@ -186,10 +272,82 @@ func (b *fileBackedBuffer) Get(n int) ([]byte, error) {
 	return value, nil
 }
 
+// Discard skips the next n bytes. The bytes that are not read into the buffer
+// yet are skipped in the file, or read in chunks if the CRC is calculated.
+func (b *fileBackedBuffer) Discard(n int) error {
+	err := b.check(n)
+	if err != nil {
+		return err
+	}
+
+	buffered := b.len - b.pos
+	if n <= buffered {
+		b.pos += n
+		b.filePos += n
+		return nil
+	}
+
+	// the bytes in the buffer might still be referenced, so
+	// the buffer is marked as read without being modified.
+	b.pos = b.len
+	b.filePos += buffered
+	remaining := n - buffered
+
+	if b.crcCalc == nil || b.crcCalc.doNotUpdate {
+		_, err = b.file.Seek(int64(remaining), io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		b.filePos += remaining
+		return nil
+	}
+
+	if b.discardBuf == nil {
+		b.discardBuf = make([]byte, discardChunkSize)
+	}
+
+	for remaining > 0 {
+		chunk := b.discardBuf[:minInt(remaining, len(b.discardBuf))]
+		_, err = io.ReadFull(b.file, chunk)
+		if err != nil {
+			return err
+		}
+
+		b.crcCalc.Update(chunk)
+		b.filePos += len(chunk)
+		remaining -= len(chunk)
+	}
+
+	return nil
+}
+
+// check returns an error if there are not n bytes left in the file.
+func (b *fileBackedBuffer) check(n int) error {
+	if n < 0 {
+		return errNegativeRead
+	}
+
+	// we use the file pos as the source of truth
+	if b.fileLen-b.filePos < n {
+		if b.fileLen == b.filePos {
+			return io.EOF
+		}
+
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
 func (b *fileBackedBuffer) Pos() int {
 	return b.filePos
 }
 
+func (b *fileBackedBuffer) size() int {
+	return b.fileLen
+}
+
 type fileBackedBufferView struct {
 	file *os.File
 	buf  *fileBackedBuffer
@@ -206,31 +364,44 @@ func (b *fileBackedBuffer) View(pos int) (bufferView, error) {
 		return nil, err
 	}
 
+	buf, err := newFileBackedBufferAt(file, b.fileLen, b.bufCap, pos)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &fileBackedBufferView{
+		file: file,
+		buf:  buf,
+	}, nil
+}
+
+// newFileBackedBufferAt seeks the file to the given position, and returns
+// a buffer that reads the file from there.
+func newFileBackedBufferAt(file *os.File, fileLen int, bufCap int, pos int) (*fileBackedBuffer, error) {
 	shouldSeek := int64(pos)
 	seek, err := file.Seek(shouldSeek, 0) // from the start
 	if err != nil {
-		_ = file.Close()
 		return nil, err
 	}
 
 	if seek != shouldSeek {
-		_ = file.Close()
 		return nil, fmt.Errorf("expected to seek %d, but it was %d", shouldSeek, seek)
 	}
 
-	buf := newFileBackedBuffer(file, b.fileLen, b.bufCap)
+	buf := newFileBackedBuffer(file, fileLen, bufCap)
 	buf.filePos = pos
-
-	return &fileBackedBufferView{
-		file: file,
-		buf:  buf,
-	}, nil
+	return buf, nil
 }
 
 func (v *fileBackedBufferView) Get(n int) ([]byte, error) {
 	return v.buf.Get(n)
 }
 
+func (v *fileBackedBufferView) Discard(n int) error {
+	return v.buf.Discard(n)
+}
+
 func (v *fileBackedBufferView) Pos() int {
 	return v.buf.Pos()
 }
@@ -272,9 +443,26 @@ func (b *fileBackedBuffer) read(n int) error {
 	// because otherwise we would break the invariant that the string
 	// is immutable. So, we would either have to copy downstream or
 	// here.
+	//
+	// In the reuse mode, the new buffer is the spare one, which is not
+	// written to until the entries read from it are released. The bytes
+	// returned are valid only until then, since the spare buffer is
+	// overwritten afterwards.
+
+	size := maxInt(b.bufCap, n) // n might be >> bufCap
+	var dst []byte
+	if b.reuse && b.spareFree && len(b.spare) == size {
+		dst = b.spare
+	} else {
+		dst = make([]byte, size)
+	}
 
-	dst := make([]byte, maxInt(b.bufCap, n)) // n might be >> bufCap
-	copied := copy(dst, b.buf[b.pos:])       // copy remaining bytes into new buffer
+	if b.reuse {
+		b.spare = b.buf
+		b.spareFree = false
+	}
+
+	copied := copy(dst, b.buf[b.pos:b.len]) // copy remaining bytes into new buffer
 	if copied != remaining {
 		return fmt.Errorf("expected to copy %d bytes, but it was %d", remaining, copied)
 	}
@@ -303,37 +491,105 @@ func (b *fileBackedBuffer) Crc() uint64 {
 	return b.crcCalc.Crc()
 }
 
+func (b *fileBackedBuffer) enableReuse() {
+	b.reuse = true
+}
+
+func (b *fileBackedBuffer) release() {
+	// the spare buffer only has the bytes of the released entries
+	b.spareFree = true
+}
+
+// lenReader is implemented by the readers that know
+// the number of bytes left in them, as the bytes.Reader.
+type lenReader interface {
+	Len() int
+}
+
+// readerSize returns the number of bytes left in the
+// reader, or -1 if the reader does not know it.
+func readerSize(r io.Reader) int {
+	if l, ok := r.(lenReader); ok {
+		return l.Len()
+	}
+	return -1
+}
+
 func newForwardOnlyBuffer(r io.Reader) buffer {
+	return newSizedForwardOnlyBuffer(r, readerSize(r))
+}
+
+// newSizedForwardOnlyBuffer returns a forwardOnlyBuffer that reads the given
+// number of bytes from the reader, or until its end if the size is negative.
+func newSizedForwardOnlyBuffer(r io.Reader, size int) buffer {
 	return &forwardOnlyBuffer{
 		reader:  r,
+		size:    size,
 		calcCRC: true,
 		crc:     0,
 	}
 }
 
+// the size of the arena used by the forwardOnlyBuffer in the reuse mode,
+// and the largest number of bytes that are returned from it.
+const forwardOnlyArenaSize = 1 << 20
+
+// the number of bytes allocated up front for the values read by the
+// forwardOnlyBuffer. The larger values are read in growing chunks, so
+// that the memory allocated for a corrupt length is proportional to the
+// bytes that are available in the reader.
+const forwardOnlyChunkSize = 1 << 20
+
 type forwardOnlyBuffer struct {
-	reader  io.Reader
+	reader io.Reader
+	pos    int
+	// the number of bytes that can be read, or -1 if it is not known
+	size    int
 	calcCRC bool
 	crc     uint64
+	// whether the arena is reused for the bytes of the next entries
+	reuse bool
+	arena []byte
+	// the buffer the discarded bytes are read into
+	discardBuf []byte
 }
 
 func (f *forwardOnlyBuffer) Get(n int) ([]byte, error) {
-	b := make([]byte, n)
-	remaining := n
+	if n < 0 {
+		return nil, errNegativeRead
+	}
 
-	for remaining > 0 {
-		read, err := f.reader.Read(b[n-remaining:])
-		if err != nil {
-			return nil, err
+	if f.size >= 0 && n > f.size-f.pos {
+		// the length is rejected without allocating or
+		// reading the bytes that are known to be missing.
+		if f.pos == f.size {
+			return nil, io.EOF
 		}
+		return nil, io.ErrUnexpectedEOF
+	}
 
-		if read == 0 {
-			return nil, io.ErrUnexpectedEOF
-		}
+	var b []byte
+	var err error
+	switch {
+	case f.reuse && n <= forwardOnlyArenaSize:
+		b = f.alloc(n)
+		_, err = io.ReadFull(f.reader, b)
+	case n <= forwardOnlyChunkSize:
+		b = make([]byte, n)
+		_, err = io.ReadFull(f.reader, b)
+	default:
+		b, err = f.readChunks(n)
+	}
 
-		remaining -= read
+	// io.ReadFull returns io.EOF only if no bytes are read, and
+	// io.ErrUnexpectedEOF if the reader ends in the middle, which
+	// matches with the semantics of the other buffers.
+	if err != nil {
+		return nil, err
 	}
 
+	f.pos += n
+
 	if f.calcCRC {
 		f.crc = getCRC(f.crc, b)
 	}
@@ -341,8 +597,63 @@ func (f *forwardOnlyBuffer) Get(n int) ([]byte, error) {
 	return b, nil
 }
 
+// readChunks reads n bytes into a slice that is doubled as it fills up,
+// so that the memory allocated is at most twice the bytes read.
+func (f *forwardOnlyBuffer) readChunks(n int) ([]byte, error) {
+	b := make([]byte, 0, forwardOnlyChunkSize)
+	for len(b) < n {
+		if len(b) == cap(b) {
+			b = slices.Grow(b, minInt(n-len(b), len(b)))
+		}
+
+		chunk := b[len(b):minInt(n, cap(b))]
+		read, err := io.ReadFull(f.reader, chunk)
+		if err == io.EOF && len(b) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		b = b[:len(b)+read]
+	}
+
+	return b, nil
+}
+
+// Discard skips the next n bytes, by reading them in chunks, so
+// that the bytes are not kept in memory, except for the chunk.
+func (f *forwardOnlyBuffer) Discard(n int) error {
+	if n < 0 {
+		return errNegativeRead
+	}
+
+	if f.discardBuf == nil {
+		f.discardBuf = make([]byte, discardChunkSize)
+	}
+
+	for read := 0; read < n; {
+		chunk := f.discardBuf[:minInt(n-read, len(f.discardBuf))]
+		_, err := io.ReadFull(f.reader, chunk)
+		if err == io.EOF && read > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+
+		f.pos += len(chunk)
+		read += len(chunk)
+		if f.calcCRC {
+			f.crc = getCRC(f.crc, chunk)
+		}
+	}
+
+	return nil
+}
+
 func (f *forwardOnlyBuffer) Pos() int {
-	return 0
+	return f.pos
 }
 
 func (f *forwardOnlyBuffer) DoNotCalcCrc() {
@@ -353,6 +664,26 @@ func (f *forwardOnlyBuffer) Crc() uint64 {
 	return f.crc
 }
 
+// alloc returns n bytes from the arena. When the arena is full, a new one
+// is allocated, and the bytes returned from the old one stay valid.
+func (f *forwardOnlyBuffer) alloc(n int) []byte {
+	if cap(f.arena)-len(f.arena) < n {
+		f.arena = make([]byte, 0, forwardOnlyArenaSize)
+	}
+
+	start := len(f.arena)
+	f.arena = f.arena[:start+n]
+	return f.arena[start : start+n : start+n]
+}
+
+func (f *forwardOnlyBuffer) enableReuse() {
+	f.reuse = true
+}
+
+func (f *forwardOnlyBuffer) release() {
+	f.arena = f.arena[:0]
+}
+
 func (f *forwardOnlyBuffer) SupportsView() bool {
 	return false
 }
@@ -1,10 +1,14 @@
 package rdb
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/require"
 )
@@ -108,6 +112,52 @@ func TestFileBackedBuffer_readMoreThanBufCap(t *testing.T) {
 	require.Equal(t, uint64(0x3bfa104f9b118f4d), buf.Crc())
 }
 
+func TestFileBackedBuffer_reuse(t *testing.T) {
+	file, fileLen, err := open()
+	require.NoError(t, err)
+	defer file.Close()
+
+	buf := newFileBackedBuffer(file, int(fileLen), 16)
+	buf.enableReuse()
+
+	sequence := func(start int) []byte {
+		b := make([]byte, 16)
+		for i := range b {
+			b[i] = byte(start + i)
+		}
+		return b
+	}
+
+	a, err := buf.Get(16)
+	require.NoError(t, err)
+	require.Equal(t, sequence(0), a)
+
+	// the bytes of the entry are not overwritten until it is released
+	b, err := buf.Get(16)
+	require.NoError(t, err)
+	require.Equal(t, sequence(16), b)
+	require.Equal(t, sequence(0), a)
+
+	buf.release()
+
+	// the buffer of the released entry is reused
+	c, err := buf.Get(16)
+	require.NoError(t, err)
+	require.Equal(t, sequence(32), c)
+	require.Equal(t, sequence(32), a)
+	require.Equal(t, sequence(16), b)
+
+	d, err := buf.Get(16)
+	require.NoError(t, err)
+	require.Equal(t, sequence(48), d)
+	require.Equal(t, sequence(16), b)
+	require.Equal(t, sequence(32), c)
+
+	// the checksum is calculated from the bytes read before the reuse
+	all := append(append(sequence(0), sequence(16)...), append(sequence(32), sequence(48)...)...)
+	require.Equal(t, getCRC(0, all), buf.Crc())
+}
+
 func TestFileBackedBuffer_outOfBoundsAccess(t *testing.T) {
 	file, fileLen, err := open()
 	require.NoError(t, err)
@@ -188,3 +238,178 @@ func TestFileBackedBuffer_view(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte{255, 0, 1, 2, 3}, b)
 }
+
+func TestForwardOnlyBuffer(t *testing.T) {
+	buf := newForwardOnlyBuffer(iotest.OneByteReader(bytes.NewReader([]byte{1, 2, 3, 4, 5})))
+
+	b, err := buf.Get(2)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, b)
+	require.Equal(t, 2, buf.Pos())
+
+	b, err = buf.Get(3)
+	require.NoError(t, err)
+	require.Equal(t, []byte{3, 4, 5}, b)
+	require.Equal(t, 5, buf.Pos())
+
+	_, err = buf.Get(1)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestForwardOnlyBuffer_outOfBoundsAccess(t *testing.T) {
+	buf := newForwardOnlyBuffer(bytes.NewReader(make([]byte, 10)))
+
+	_, err := buf.Get(11)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestForwardOnlyBuffer_knownSize(t *testing.T) {
+	buf := newSizedForwardOnlyBuffer(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7}), 5)
+
+	// the length past the size is rejected without consuming the bytes
+	_, err := buf.Get(6)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, 0, buf.Pos())
+
+	b, err := buf.Get(5)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3, 4, 5}, b)
+
+	_, err = buf.Get(1)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestForwardOnlyBuffer_largeLength(t *testing.T) {
+	// the reader is wrapped so that its size is not known
+	buf := newForwardOnlyBuffer(struct{ io.Reader }{bytes.NewReader(make([]byte, 10))})
+	require.Equal(t, -1, buf.(*forwardOnlyBuffer).size)
+
+	// the forged length fails when the reader ends, instead of
+	// allocating the whole length up front
+	_, err := buf.Get(1 << 50)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	data := make([]byte, 3*forwardOnlyChunkSize+5)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	buf = newForwardOnlyBuffer(struct{ io.Reader }{bytes.NewReader(data)})
+	b, err := buf.Get(len(data))
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+	require.Equal(t, len(data), buf.Pos())
+}
+
+func TestForwardOnlyBuffer_reuse(t *testing.T) {
+	buf := newForwardOnlyBuffer(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7}))
+	reusable := buf.(reusableBuffer)
+	reusable.enableReuse()
+
+	a, err := buf.Get(2)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, a)
+
+	b, err := buf.Get(3)
+	require.NoError(t, err)
+	require.Equal(t, []byte{3, 4, 5}, b)
+	require.Equal(t, []byte{1, 2}, a)
+
+	reusable.release()
+
+	// the memory of the released entry is reused
+	c, err := buf.Get(2)
+	require.NoError(t, err)
+	require.Equal(t, []byte{6, 7}, c)
+	require.Equal(t, []byte{6, 7}, a)
+	require.Equal(t, 7, buf.Pos())
+}
+
+func TestMemoryBackedBuffer_discard(t *testing.T) {
+	buf := newMemoryBackedBuffer([]byte{1, 2, 3, 4, 5})
+
+	require.NoError(t, buf.Discard(2))
+	b, err := buf.Get(1)
+	require.NoError(t, err)
+	require.Equal(t, []byte{3}, b)
+
+	require.ErrorIs(t, buf.Discard(-1), errNegativeRead)
+	require.ErrorIs(t, buf.Discard(math.MaxInt), io.ErrUnexpectedEOF)
+	_, err = buf.Get(math.MaxInt)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	require.NoError(t, buf.Discard(2))
+	require.ErrorIs(t, buf.Discard(1), io.EOF)
+}
+
+func TestFileBackedBuffer_discard(t *testing.T) {
+	sequence := func(start, n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(start + i)
+		}
+		return b
+	}
+
+	for _, calcCRC := range []bool{true, false} {
+		file, fileLen, err := open()
+		require.NoError(t, err)
+		defer file.Close()
+
+		buf := newFileBackedBuffer(file, int(fileLen+crcLen), 16)
+		if !calcCRC {
+			buf.DoNotCalcCrc()
+		}
+
+		b, err := buf.Get(8)
+		require.NoError(t, err)
+		require.Equal(t, sequence(0, 8), b)
+
+		// within the buffer
+		require.NoError(t, buf.Discard(4))
+		require.Equal(t, 12, buf.Pos())
+
+		// past the buffer
+		require.NoError(t, buf.Discard(1000))
+		require.Equal(t, 1012, buf.Pos())
+
+		b, err = buf.Get(4)
+		require.NoError(t, err)
+		require.Equal(t, sequence(1012, 4), b)
+
+		// to the end of the file, without the crc
+		require.NoError(t, buf.Discard(1032))
+		require.Equal(t, 2048, buf.Pos())
+
+		if calcCRC {
+			require.Equal(t, uint64(9267225763363821280), buf.Crc())
+		} else {
+			require.Zero(t, buf.Crc())
+		}
+
+		require.ErrorIs(t, buf.Discard(-1), errNegativeRead)
+		require.ErrorIs(t, buf.Discard(math.MaxInt), io.ErrUnexpectedEOF)
+		_, err = buf.Get(math.MaxInt)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestForwardOnlyBuffer_discard(t *testing.T) {
+	data := make([]byte, 3*discardChunkSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	buf := newForwardOnlyBuffer(bytes.NewReader(data))
+	require.NoError(t, buf.Discard(2*discardChunkSize+1))
+	require.Equal(t, 2*discardChunkSize+1, buf.Pos())
+
+	b, err := buf.Get(1)
+	require.NoError(t, err)
+	require.Equal(t, data[2*discardChunkSize+1:2*discardChunkSize+2], b)
+	require.Equal(t, getCRC(0, data[:2*discardChunkSize+2]), buf.Crc())
+
+	require.ErrorIs(t, buf.Discard(-1), errNegativeRead)
+	require.ErrorIs(t, buf.Discard(discardChunkSize), io.ErrUnexpectedEOF)
+	require.ErrorIs(t, buf.Discard(1), io.EOF)
+}
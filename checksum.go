@@ -50,6 +50,18 @@ func VerifyValueChecksum(payload []byte) error {
 	return nil
 }
 
+// DumpPayload returns the payload of the DUMP command for the given serialized
+// value, which has the form of <type><value>, such as the ones passed to the
+// RawValueHandler, by appending the given RDB version and the CRC64 to it. The
+// servers the payload is restored to must support the given version, and the
+// encoding of the value.
+func DumpPayload(value []byte, version uint16) []byte {
+	payload := make([]byte, len(value), len(value)+ValueChecksumSize)
+	copy(payload, value)
+	payload = binary.LittleEndian.AppendUint16(payload, version)
+	return binary.LittleEndian.AppendUint64(payload, getCRC(0, payload))
+}
+
 // getCRC returns the CRC-64 of the payload, using the given CRC as a base.
 func getCRC(crc uint64, payload []byte) uint64 {
 	buildOnce.Do(buildCrc64Table)
@@ -1,6 +1,7 @@
 package rdb
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -74,3 +75,16 @@ func TestCRC64(t *testing.T) {
 		})
 	}
 }
+
+func TestDumpPayload(t *testing.T) {
+	w := NewWriter()
+	assert.NoError(t, w.WriteType(TypeString))
+	assert.NoError(t, w.WriteString("upstash"))
+	value := bytes.Clone(w.GetBuffer())
+	assert.NoError(t, w.WriteChecksum(Version))
+
+	payload := DumpPayload(value, Version)
+	assert.Equal(t, w.GetBuffer(), payload)
+	assert.NoError(t, VerifyValueChecksum(payload))
+	assert.Equal(t, []byte{byte(TypeString), 7, 'u', 'p', 's', 't', 'a', 's', 'h'}, value)
+}
@@ -31,6 +31,62 @@ const (
 	TypeHashListpackEx      Type = 25
 )
 
+// Kind is the logical type of a value, as reported by the TYPE command,
+// regardless of the encoding of the value in the file.
+type Kind uint8
+
+const (
+	KindString Kind = iota
+	KindList
+	KindSet
+	KindZset
+	KindHash
+	KindStream
+	KindModule
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindList:
+		return "list"
+	case KindSet:
+		return "set"
+	case KindZset:
+		return "zset"
+	case KindHash:
+		return "hash"
+	case KindStream:
+		return "stream"
+	case KindModule:
+		return "module"
+	default:
+		return "unknown"
+	}
+}
+
+// Kind returns the logical type of the values encoded with the type.
+func (t Type) Kind() Kind {
+	switch t {
+	case TypeString:
+		return KindString
+	case TypeList, TypeListZiplist, TypeListQuicklist, TypeListQuicklist2:
+		return KindList
+	case TypeSet, TypeSetIntset, TypeSetListpack:
+		return KindSet
+	case TypeZset, TypeZset2, TypeZsetZiplist, TypeZsetListpack:
+		return KindZset
+	case TypeHash, TypeHashZipmap, TypeHashZiplist, TypeHashListpack,
+		TypeHashMetadataPreGa, TypeHashListpackExPreGa, TypeHashMetadata, TypeHashListpackEx:
+		return KindHash
+	case TypeStreamListpacks, TypeStreamListpacks2, TypeStreamListpacks3:
+		return KindStream
+	default:
+		return KindModule
+	}
+}
+
 const (
 	typeOpCodeFunction2     Type = 245
 	typeOpCodeFunctionPreGA Type = 246
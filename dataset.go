@@ -0,0 +1,668 @@
+package rdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Value is the in-memory copy of an RDB value, which is one of the String,
+// List, Set, ZSet, Hash, *Stream and JSON types.
+type Value interface {
+	// Kind returns the logical type of the value.
+	Kind() Kind
+}
+
+// String is the value of a string.
+type String string
+
+// List is the value of a list, with the elements in order.
+type List []string
+
+// Set is the value of a set, with the elements in the order they are read.
+type Set []string
+
+// ZSet is the value of a sorted set, with the scores of its members.
+type ZSet map[string]float64
+
+// Hash is the value of a hash, with the values and the
+// expiration times of its fields, if they have any.
+type Hash map[string]HashEntry
+
+// JSON is the value of a JSON document, stored by the JSON module.
+type JSON string
+
+func (String) Kind() Kind { return KindString }
+
+func (List) Kind() Kind { return KindList }
+
+func (Set) Kind() Kind { return KindSet }
+
+func (ZSet) Kind() Kind { return KindZset }
+
+func (Hash) Kind() Kind { return KindHash }
+
+func (*Stream) Kind() Kind { return KindStream }
+
+func (JSON) Kind() Kind { return KindModule }
+
+// Item is a value in a Dataset, along with its expiration time.
+type Item struct {
+	Value Value
+	// ExpireTime is the expiration time of the key, or the zero time
+	// if the key does not expire.
+	ExpireTime time.Time
+}
+
+// Database is the set of the keys of a database, and their values.
+type Database map[string]*Item
+
+// Dataset is the in-memory copy of the entries of an RDB file,
+// keyed by the number of their databases and their keys.
+type Dataset struct {
+	DBs map[uint64]Database
+	// Libraries are the codes of the function libraries.
+	Libraries []string
+}
+
+// NewDataset returns an empty dataset.
+func NewDataset() *Dataset {
+	return &Dataset{
+		DBs: make(map[uint64]Database),
+	}
+}
+
+// DB returns the database with the given number, which
+// is added to the dataset if it does not exist yet.
+func (d *Dataset) DB(dbnum uint64) Database {
+	db, ok := d.DBs[dbnum]
+	if !ok {
+		db = make(Database)
+		d.DBs[dbnum] = db
+	}
+
+	return db
+}
+
+// LoadOptions are the limits of the memory used while loading values.
+// The sizes are estimated from the lengths of the keys and the strings of
+// the values, and the limits are not applied when they are not positive.
+type LoadOptions struct {
+	MaxDataSize  int
+	MaxEntrySize int
+}
+
+// LoadFile reads the RDB file in the given path into a dataset. The entries of
+// all the databases are loaded, except the values of the modules other than
+// JSON, which are skipped.
+func LoadFile(path string, opts LoadOptions) (*Dataset, error) {
+	l := newDatasetLoader(opts)
+	err := ReadFile(path, l.adapter())
+	if err != nil {
+		return nil, err
+	}
+
+	return l.dataset, nil
+}
+
+// LoadReader reads the RDB file from the given reader
+// into a dataset, in the same way as LoadFile.
+func LoadReader(r io.Reader, opts LoadOptions) (*Dataset, error) {
+	l := newDatasetLoader(opts)
+	err := ReadReader(r, l.adapter())
+	if err != nil {
+		return nil, err
+	}
+
+	return l.dataset, nil
+}
+
+// LoadValue reads the given RDB value payload, as it is read by ReadValue. The
+// payload is copied, so that it can be modified once the value is returned.
+func LoadValue(payload []byte, opts LoadOptions) (Value, error) {
+	l := newDatasetLoader(opts)
+	a := l.adapter()
+	err := ReadValue("", bytes.Clone(payload), a)
+	if err != nil {
+		return nil, err
+	}
+
+	// the payloads do not have the metadata of the
+	// entries, which completes the values of the files
+	err = a.HandleKeyInfo(KeyInfo{})
+	if err != nil {
+		return nil, err
+	}
+
+	item, ok := l.db[""]
+	if !ok {
+		return nil, errors.New("unsupported module value")
+	}
+
+	return item.Value, nil
+}
+
+// datasetLoader is a WholeValueHandler that builds the dataset
+// from the values of all databases, passed by the ValueAdapter.
+type datasetLoader struct {
+	BaseHandler
+	dataset *Dataset
+	db      Database
+	opts    LoadOptions
+	// estimated sizes of the dataset and the value being read
+	dataSize  int
+	entrySize int
+}
+
+func newDatasetLoader(opts LoadOptions) *datasetLoader {
+	l := &datasetLoader{
+		dataset: NewDataset(),
+		opts:    opts,
+	}
+
+	_ = l.HandleSelectDB(0)
+	return l
+}
+
+// adapter returns the ValueAdapter that passes the values to the loader. The
+// collections that cannot fit in the limits are streamed to the loader
+// instead, so that the limits are applied before they are read completely.
+func (l *datasetLoader) adapter() *ValueAdapter {
+	maxBytes := l.opts.MaxEntrySize
+	if l.opts.MaxDataSize > 0 && (maxBytes <= 0 || l.opts.MaxDataSize < maxBytes) {
+		maxBytes = l.opts.MaxDataSize
+	}
+
+	return NewValueAdapter(l, ValueAdapterOptions{MaxBytes: maxBytes})
+}
+
+// grow adds the given size to the sizes of the dataset and the value being
+// read, and returns an error if either of them exceeds its limit.
+func (l *datasetLoader) grow(size int) error {
+	l.entrySize += size
+	l.dataSize += size
+	if l.opts.MaxEntrySize > 0 && l.entrySize > l.opts.MaxEntrySize {
+		return errMaxEntrySizeExceeded(l.entrySize, l.opts.MaxEntrySize)
+	}
+
+	if l.opts.MaxDataSize > 0 && l.dataSize > l.opts.MaxDataSize {
+		return errMaxDataSizeExceeded(l.dataSize, l.opts.MaxDataSize)
+	}
+
+	return nil
+}
+
+// stream starts the value of the key that is streamed to the loader, and
+// returns the function that grows the sizes by the size of each element.
+func (l *datasetLoader) stream(key string) func(size int) error {
+	l.entrySize = 0
+	err := l.grow(len(key))
+	return func(size int) error {
+		if err != nil {
+			return err
+		}
+
+		return l.grow(size)
+	}
+}
+
+func (l *datasetLoader) AllowPartialRead() bool {
+	return true
+}
+
+func (l *datasetLoader) HandleSelectDB(dbnum uint64) error {
+	l.db = l.dataset.DB(dbnum)
+	return nil
+}
+
+func (l *datasetLoader) HandleValue(key string, value Value, info KeyInfo) error {
+	l.entrySize = 0
+	err := l.grow(len(key) + valueSize(value))
+	if err != nil {
+		return err
+	}
+
+	l.db[key] = &Item{
+		Value:      value,
+		ExpireTime: info.ExpireTime,
+	}
+	return nil
+}
+
+// The streaming methods are called only for the collections that exceed one
+// of the limits, which return the error once the sizes read exceed them.
+
+func (l *datasetLoader) ListEntryHandler(key string) func(elem string) error {
+	grow := l.stream(key)
+	return func(elem string) error {
+		return grow(len(elem))
+	}
+}
+
+func (l *datasetLoader) SetEntryHandler(key string) func(elem string) error {
+	grow := l.stream(key)
+	return func(elem string) error {
+		return grow(len(elem))
+	}
+}
+
+func (l *datasetLoader) ZsetEntryHandler(key string) func(elem string, score float64) error {
+	grow := l.stream(key)
+	return func(elem string, score float64) error {
+		return grow(len(elem) + 8)
+	}
+}
+
+func (l *datasetLoader) HashEntryHandler(key string) func(field, value string) error {
+	grow := l.stream(key)
+	return func(field, value string) error {
+		return grow(len(field) + len(value))
+	}
+}
+
+func (l *datasetLoader) HashWithExpEntryHandler(key string) func(field string, value string, ttl time.Time) error {
+	grow := l.stream(key)
+	return func(field string, value string, ttl time.Time) error {
+		return grow(len(field) + len(value))
+	}
+}
+
+func (l *datasetLoader) HandleModule(key, value string, marker ModuleMarker) error {
+	// skipped module, whose value is not available. The
+	// JSON values are passed to HandleValue.
+	delete(l.db, key)
+	return nil
+}
+
+func (l *datasetLoader) StreamEntryHandler(key string) func(entry StreamEntry) error {
+	grow := l.stream(key)
+	return func(entry StreamEntry) error {
+		return grow(streamEntrySize(entry))
+	}
+}
+
+func (l *datasetLoader) StreamGroupHandler(key string) func(group StreamConsumerGroup) error {
+	// the groups are streamed after the entries of the same value
+	return func(group StreamConsumerGroup) error {
+		return l.grow(len(group.Name))
+	}
+}
+
+func (l *datasetLoader) HandleLibrary(code string) error {
+	l.dataset.Libraries = append(l.dataset.Libraries, code)
+	return nil
+}
+
+// valueSize returns the estimated size of the value, from the lengths of its strings.
+func valueSize(value Value) int {
+	size := 0
+	switch v := value.(type) {
+	case String:
+		size = len(v)
+	case JSON:
+		size = len(v)
+	case List:
+		for _, elem := range v {
+			size += len(elem)
+		}
+	case Set:
+		for _, elem := range v {
+			size += len(elem)
+		}
+	case ZSet:
+		for elem := range v {
+			size += len(elem) + 8
+		}
+	case Hash:
+		for field, entry := range v {
+			size += len(field) + len(entry.Value)
+		}
+	case *Stream:
+		for _, entry := range v.Entries {
+			size += streamEntrySize(entry)
+		}
+		for _, group := range v.Groups {
+			size += len(group.Name)
+		}
+	}
+
+	return size
+}
+
+func streamEntrySize(entry StreamEntry) int {
+	size := 16 // id
+	for _, v := range entry.Value {
+		size += len(v)
+	}
+	return size
+}
+
+// saveRedisVersion is the Redis version written to the files saved from datasets.
+const saveRedisVersion = "7.4.0"
+
+// SaveFile writes the dataset to an RDB file in the given path, with the
+// FileEncoder. The databases and the keys are written in the sorted order.
+// The empty collections are not written, since they cannot be loaded. The
+// streams are written in the first stream format, without the entries read of
+// the consumer groups and the active times of the consumers.
+func SaveFile(path string, ds *Dataset) error {
+	encoder, err := NewFileEncoder(path, saveRedisVersion)
+	if err != nil {
+		return err
+	}
+
+	err = saveDataset(encoder, ds)
+	if err != nil {
+		_ = encoder.abort()
+		return err
+	}
+
+	return encoder.Close()
+}
+
+func saveDataset(encoder *FileEncoder, ds *Dataset) error {
+	err := encoder.Begin()
+	if err != nil {
+		return err
+	}
+
+	dbnums := make([]uint64, 0, len(ds.DBs))
+	for dbnum := range ds.DBs {
+		dbnums = append(dbnums, dbnum)
+	}
+	slices.Sort(dbnums)
+
+	for i, dbnum := range dbnums {
+		if i > 0 || dbnum != 0 {
+			err = encoder.SelectDB(int(dbnum))
+			if err != nil {
+				return err
+			}
+		}
+
+		db := ds.DBs[dbnum]
+		keys := make([]string, 0, len(db))
+		for key := range db {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			err = saveItem(encoder, key, db[key])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, code := range ds.Libraries {
+		err = encoder.WriteLibrary(code)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func saveItem(encoder *FileEncoder, key string, item *Item) error {
+	expiry := item.ExpireTime
+	switch v := item.Value.(type) {
+	case String:
+		return encoder.WriteStringEntry(key, string(v), expiry)
+	case JSON:
+		return encoder.WriteJSON(key, string(v), expiry)
+	case List:
+		if len(v) == 0 {
+			return nil
+		}
+
+		e, err := encoder.BeginList(key, expiry)
+		if err != nil {
+			return err
+		}
+
+		for _, elem := range v {
+			err = e.WriteFieldStr(elem)
+			if err != nil {
+				return err
+			}
+		}
+
+		return e.Close()
+	case Set:
+		if len(v) == 0 {
+			return nil
+		}
+
+		e, err := encoder.BeginSet(key, expiry)
+		if err != nil {
+			return err
+		}
+
+		for _, elem := range v {
+			err = e.WriteFieldStr(elem)
+			if err != nil {
+				return err
+			}
+		}
+
+		return e.Close()
+	case ZSet:
+		if len(v) == 0 {
+			return nil
+		}
+
+		e, err := encoder.BeginSortedSet(key, expiry)
+		if err != nil {
+			return err
+		}
+
+		members, scores := v.sorted()
+		for i, member := range members {
+			err = e.WriteFieldStrFloat64(member, scores[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		return e.Close()
+	case Hash:
+		if len(v) == 0 {
+			return nil
+		}
+
+		fields := v.sortedFields()
+		if !v.hasExpiringFields() {
+			e, err := encoder.BeginHash(key, expiry)
+			if err != nil {
+				return err
+			}
+
+			for _, field := range fields {
+				err = e.WriteFieldStrStr(field, v[field].Value)
+				if err != nil {
+					return err
+				}
+			}
+
+			return e.Close()
+		}
+
+		e, err := encoder.BeginHashWithMetadata(key, expiry)
+		if err != nil {
+			return err
+		}
+
+		for _, field := range fields {
+			err = e.WriteFieldStrStrWithExpiry(field, v[field].Value, v[field].ExpirationTime)
+			if err != nil {
+				return err
+			}
+		}
+
+		return e.Close()
+	case *Stream:
+		e, err := encoder.BeginStream(key, expiry)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range v.Entries {
+			err = e.WriteEntry(entry)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = e.WriteMetadata(v.Length, v.LastID)
+		if err != nil {
+			return err
+		}
+
+		err = e.WriteGroups(v.Groups)
+		if err != nil {
+			return err
+		}
+
+		return e.Close()
+	default:
+		return fmt.Errorf("unsupported value type %T", item.Value)
+	}
+}
+
+// SaveValue returns the RDB value payload of the given value, written with the
+// Writer, along with the RDB version and the checksum. It can be read with
+// LoadValue or ReadValue, and restored with the RESTORE command. The streams
+// are written in the same format as SaveFile writes them.
+func SaveValue(value Value) ([]byte, error) {
+	w := NewWriter()
+	err := writeValue(w, value)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.WriteChecksum(Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.GetBuffer(), nil
+}
+
+func writeValue(w *Writer, value Value) error {
+	switch v := value.(type) {
+	case String:
+		err := w.WriteType(TypeString)
+		if err != nil {
+			return err
+		}
+
+		return w.WriteString(string(v))
+	case JSON:
+		err := w.WriteType(TypeModule2)
+		if err != nil {
+			return err
+		}
+
+		return w.WriteJSON(string(v))
+	case List:
+		err := w.WriteType(TypeList)
+		if err != nil {
+			return err
+		}
+
+		return w.WriteList(v)
+	case Set:
+		err := w.WriteType(TypeSet)
+		if err != nil {
+			return err
+		}
+
+		return w.WriteSet(v)
+	case ZSet:
+		err := w.WriteType(TypeZset2)
+		if err != nil {
+			return err
+		}
+
+		return w.WriteZset(v.sorted())
+	case Hash:
+		if !v.hasExpiringFields() {
+			err := w.WriteType(TypeHash)
+			if err != nil {
+				return err
+			}
+
+			hash := make(map[string]string, len(v))
+			for field, entry := range v {
+				hash[field] = entry.Value
+			}
+
+			return w.WriteHash(hash)
+		}
+
+		err := w.WriteType(TypeHashMetadata)
+		if err != nil {
+			return err
+		}
+
+		return w.WriteHashWithMetadata(v)
+	case *Stream:
+		err := w.WriteType(TypeStreamListpacks)
+		if err != nil {
+			return err
+		}
+
+		return w.WriteStream(v)
+	default:
+		return fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+// sorted returns the members of the sorted set and their scores,
+// sorted by their scores and then lexicographically.
+func (z ZSet) sorted() ([]string, []float64) {
+	members := make([]string, 0, len(z))
+	for member := range z {
+		members = append(members, member)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if z[members[i]] != z[members[j]] {
+			return z[members[i]] < z[members[j]]
+		}
+		return members[i] < members[j]
+	})
+
+	scores := make([]float64, len(members))
+	for i, member := range members {
+		scores[i] = z[member]
+	}
+
+	return members, scores
+}
+
+func (h Hash) sortedFields() []string {
+	fields := make([]string, 0, len(h))
+	for field := range h {
+		fields = append(fields, field)
+	}
+
+	slices.Sort(fields)
+	return fields
+}
+
+func (h Hash) hasExpiringFields() bool {
+	for _, entry := range h {
+		if !entry.ExpirationTime.IsZero() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,262 @@
+package rdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile(t *testing.T) {
+	ds, err := LoadFile(filepath.Join(dumpsPath, "all-types.rdb"), LoadOptions{})
+	require.NoError(t, err)
+
+	expected := newDummyDB()
+	err = ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), expected)
+	require.NoError(t, err)
+
+	db := ds.DBs[0]
+	for key, value := range expected.strings {
+		require.Equal(t, String(value), db[key].Value)
+	}
+	for key, elems := range expected.lists {
+		require.Equal(t, List(elems), db[key].Value)
+	}
+	for key, elems := range expected.sets {
+		require.ElementsMatch(t, elems, db[key].Value)
+	}
+	for key, entries := range expected.zsets {
+		require.Equal(t, ZSet(entries), db[key].Value)
+	}
+	for key, entries := range expected.streamEntries {
+		stream := db[key].Value.(*Stream)
+		require.Equal(t, entries, stream.Entries)
+		require.Equal(t, expected.streamGroups[key], stream.Groups)
+	}
+	for key, value := range expected.modules {
+		require.Equal(t, JSON(value), db[key].Value)
+	}
+}
+
+func TestLoadFile_expireTime(t *testing.T) {
+	ds, err := LoadFile(filepath.Join(dumpsPath, "expiretime-sec.rdb"), LoadOptions{})
+	require.NoError(t, err)
+
+	expected := newDummyDB()
+	err = ReadFile(filepath.Join(dumpsPath, "expiretime-sec.rdb"), expected)
+	require.NoError(t, err)
+	require.NotEmpty(t, expected.expireTimes)
+
+	for key, expireTime := range expected.expireTimes {
+		require.Equal(t, time.UnixMilli(expireTime.Milliseconds()), ds.DBs[0][key].ExpireTime)
+	}
+}
+
+func TestLoadFile_multiDB(t *testing.T) {
+	ds, err := LoadFile(filepath.Join(dumpsPath, "multi-db.rdb"), LoadOptions{})
+	require.NoError(t, err)
+
+	require.Contains(t, ds.DBs[0], "00")
+	require.Contains(t, ds.DBs[1], "00")
+	require.Contains(t, ds.DBs[1], "01")
+	require.NotContains(t, ds.DBs[0], "01")
+}
+
+func TestLoadFile_limits(t *testing.T) {
+	_, err := LoadFile(filepath.Join(dumpsPath, "all-types.rdb"), LoadOptions{MaxDataSize: 64})
+	require.ErrorContains(t, err, "max data size")
+
+	_, err = LoadFile(filepath.Join(dumpsPath, "all-types.rdb"), LoadOptions{MaxEntrySize: 8})
+	require.ErrorContains(t, err, "max entry size")
+}
+
+func TestLoadReader(t *testing.T) {
+	expected, err := LoadFile(filepath.Join(dumpsPath, "multi-db.rdb"), LoadOptions{})
+	require.NoError(t, err)
+
+	file, err := os.Open(filepath.Join(dumpsPath, "multi-db.rdb"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	ds, err := LoadReader(file, LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, expected, ds)
+}
+
+func TestSaveFile(t *testing.T) {
+	for _, name := range []string{"all-types.rdb", "multi-db.rdb", "expiretime-sec.rdb", "function.rdb"} {
+		t.Run(name, func(t *testing.T) {
+			expected, err := LoadFile(filepath.Join(dumpsPath, name), LoadOptions{})
+			require.NoError(t, err)
+
+			path := filepath.Join(t.TempDir(), name)
+			require.NoError(t, SaveFile(path, expected))
+
+			for _, db := range expected.DBs {
+				for _, item := range db {
+					item.Value = withoutStreamV2Fields(item.Value)
+				}
+			}
+
+			ds, err := LoadFile(path, LoadOptions{})
+			require.NoError(t, err)
+			require.Equal(t, expected, ds)
+		})
+	}
+}
+
+func TestSaveFile_hashWithFieldTTLs(t *testing.T) {
+	ttl := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	expected := NewDataset()
+	expected.DB(0)["hash"] = &Item{
+		Value: Hash{
+			"a": {Value: "1"},
+			"b": {Value: "2", ExpirationTime: ttl},
+		},
+	}
+	expected.DB(3)["zset"] = &Item{
+		Value:      ZSet{"x": 1.5, "y": -2},
+		ExpireTime: ttl,
+	}
+
+	path := filepath.Join(t.TempDir(), "dataset.rdb")
+	require.NoError(t, SaveFile(path, expected))
+
+	ds, err := LoadFile(path, LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, expected, ds)
+}
+
+func TestSaveFile_streamLastID(t *testing.T) {
+	// the entries after the second one are deleted, and the
+	// group is delivered past the last entry of the stream
+	expected := NewDataset()
+	expected.DB(0)["stream"] = &Item{
+		Value: &Stream{
+			LastID: StreamID{Millis: 4},
+			Entries: []StreamEntry{
+				{ID: StreamID{Millis: 1}, Value: []string{"a", "1"}},
+				{ID: StreamID{Millis: 2, Seq: 1}, Value: []string{"b", "2"}},
+			},
+			Length: 2,
+			Groups: []StreamConsumerGroup{
+				{Name: "group", LastID: StreamID{Millis: 4}},
+			},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "stream.rdb")
+	require.NoError(t, SaveFile(path, expected))
+
+	ds, err := LoadFile(path, LoadOptions{})
+	require.NoError(t, err)
+
+	stream := ds.DBs[0]["stream"].Value.(*Stream)
+	require.Equal(t, StreamID{Millis: 4}, stream.LastID)
+	require.Equal(t, uint64(2), stream.Length)
+	require.Equal(t, expected.DBs[0]["stream"].Value.(*Stream).Entries, stream.Entries)
+	require.Len(t, stream.Groups, 1)
+	require.Equal(t, StreamID{Millis: 4}, stream.Groups[0].LastID)
+
+	// the stream is saved again with the same last id
+	require.NoError(t, SaveFile(path, ds))
+	reloaded, err := LoadFile(path, LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, ds, reloaded)
+}
+
+type unsupportedValue struct{}
+
+func (unsupportedValue) Kind() Kind { return KindString }
+
+func TestSaveFile_error(t *testing.T) {
+	ds := NewDataset()
+	ds.DB(0)["a"] = &Item{Value: String("1")}
+	ds.DB(0)["b"] = &Item{Value: unsupportedValue{}}
+
+	path := filepath.Join(t.TempDir(), "error.rdb")
+	err := SaveFile(path, ds)
+	require.ErrorContains(t, err, "unsupported value type")
+
+	// the incomplete file is not finished
+	_, err = LoadFile(path, LoadOptions{})
+	require.Error(t, err)
+}
+
+func TestLoadValue(t *testing.T) {
+	tests := []struct {
+		name string
+		kind Kind
+	}{
+		{name: "string.bin", kind: KindString},
+		{name: "list-quicklist2-small.bin", kind: KindList},
+		{name: "set-intset-int64.bin", kind: KindSet},
+		{name: "zset-listpack.bin", kind: KindZset},
+		{name: "hash-listpack-with-exp.bin", kind: KindHash},
+		{name: "stream-listpacks3.bin", kind: KindStream},
+		{name: "module2-jsonv3.bin", kind: KindModule},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := os.ReadFile(filepath.Join(valueDumpsPath, tc.name))
+			require.NoError(t, err)
+
+			value, err := LoadValue(payload, LoadOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tc.kind, value.Kind())
+
+			saved, err := SaveValue(value)
+			require.NoError(t, err)
+
+			loaded, err := LoadValue(saved, LoadOptions{})
+			require.NoError(t, err)
+			require.Equal(t, withoutStreamV2Fields(value), loaded)
+		})
+	}
+}
+
+func TestLoadValue_unsupportedModule(t *testing.T) {
+	payload, err := os.ReadFile(filepath.Join(valueDumpsPath, "module2-bloomfilter.bin"))
+	require.NoError(t, err)
+
+	_, err = LoadValue(payload, LoadOptions{})
+	require.Error(t, err)
+}
+
+func TestLoadValue_maxEntrySize(t *testing.T) {
+	payload, err := os.ReadFile(filepath.Join(valueDumpsPath, "list-quicklist2-big.bin"))
+	require.NoError(t, err)
+
+	_, err = LoadValue(payload, LoadOptions{MaxEntrySize: 16})
+	require.ErrorContains(t, err, "max entry size")
+}
+
+func TestLoadValue_maxDataSize(t *testing.T) {
+	payload, err := os.ReadFile(filepath.Join(valueDumpsPath, "list-quicklist2-big.bin"))
+	require.NoError(t, err)
+
+	// the list is streamed once it exceeds the limit, instead of being buffered
+	_, err = LoadValue(payload, LoadOptions{MaxDataSize: 16})
+	require.ErrorContains(t, err, "max data size is exceeded. current: 17")
+}
+
+// withoutStreamV2Fields returns the value without the fields of the streams
+// that are not written in the stream format used by the writers.
+func withoutStreamV2Fields(value Value) Value {
+	stream, ok := value.(*Stream)
+	if !ok {
+		return value
+	}
+
+	for i := range stream.Groups {
+		stream.Groups[i].EntriesRead = 0
+		for j := range stream.Groups[i].Consumers {
+			stream.Groups[i].Consumers[j].ActiveTime = 0
+		}
+	}
+
+	return stream
+}
@@ -6,16 +6,59 @@ import (
 	"time"
 )
 
+// EntryOption configures the optional metadata written before an entry.
+type EntryOption func(*entryOptions)
+
+type entryOptions struct {
+	hasFreq bool
+	freq    uint8
+	hasIdle bool
+	idle    time.Duration
+}
+
+// WithLFUFreq writes the given LFU frequency counter for the entry,
+// which is used by the servers configured with an LFU "maxmemory-policy".
+func WithLFUFreq(freq uint8) EntryOption {
+	return func(o *entryOptions) {
+		o.hasFreq = true
+		o.freq = freq
+	}
+}
+
+// WithLRUIdle writes the given LRU idle time for the entry, which is used
+// by the servers configured with an LRU "maxmemory-policy". The idle time
+// is written with the precision of seconds, and the negative idle times
+// are written as 0.
+func WithLRUIdle(idle time.Duration) EntryOption {
+	return func(o *entryOptions) {
+		if idle < 0 {
+			idle = 0
+		}
+		o.hasIdle = true
+		o.idle = idle
+	}
+}
+
 type FileEncoder struct {
 	writer       *FileWriter
 	countPos     int64
 	count        int64
 	countWithExp int64
+	// the sizes of the databases selected before the current one
+	prevDBSizes  []encodedDBSize
 	backlenBuf   []byte
 	redisVersion string
 	begin        bool
 }
 
+// encodedDBSize is the number of entries written for a database, which are
+// written to the resize-db at the given position once the file is closed.
+type encodedDBSize struct {
+	countPos     int64
+	count        int64
+	countWithExp int64
+}
+
 func NewFileEncoder(path string, redisVersion string) (*FileEncoder, error) {
 	w, err := newFileWriter(path)
 	if redisVersion == "" {
@@ -62,13 +105,40 @@ func (s *FileEncoder) Begin() error {
 	return nil
 }
 
-func (s *FileEncoder) WriteStringEntry(key string, value string, expiry time.Time) error {
+// SelectDB selects the database the next entries are written to. The entries
+// are written to the database 0 until it is called.
+func (s *FileEncoder) SelectDB(dbNumber int) error {
+	if s.begin {
+		return fmt.Errorf("cannot select; a collection is already being written. Call Close on the existing collection first")
+	}
+	s.prevDBSizes = append(s.prevDBSizes, encodedDBSize{
+		countPos:     s.countPos,
+		count:        s.count,
+		countWithExp: s.countWithExp,
+	})
+	if err := s.selectDB(dbNumber); err != nil {
+		return err
+	}
+	resizeDbPos, err := s.writer.Pos()
+	if err != nil {
+		return err
+	}
+	s.countPos = resizeDbPos
+	s.count = 0
+	s.countWithExp = 0
+	return s.writeResizeDB(0, 0)
+}
+
+func (s *FileEncoder) WriteStringEntry(key string, value string, expiry time.Time, opts ...EntryOption) error {
 	if s.begin {
 		return fmt.Errorf("cannot write; a collection is already being written. Call Close on the existing collection first")
 	}
 	if err := s.writeExpiry(expiry); err != nil {
 		return err
 	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return err
+	}
 	if err := s.writer.WriteByte(byte(TypeString)); err != nil {
 		return err
 	}
@@ -82,7 +152,7 @@ func (s *FileEncoder) WriteStringEntry(key string, value string, expiry time.Tim
 	return nil
 }
 
-func (s *FileEncoder) BeginHash(key string, expiry time.Time) (*HashEncoder, error) {
+func (s *FileEncoder) BeginHash(key string, expiry time.Time, opts ...EntryOption) (*HashEncoder, error) {
 	if s.begin {
 		return nil, fmt.Errorf("cannot begin; a collection is already being written. Call Close on the existing collection first")
 	}
@@ -90,6 +160,9 @@ func (s *FileEncoder) BeginHash(key string, expiry time.Time) (*HashEncoder, err
 	if err := s.writeExpiry(expiry); err != nil {
 		return nil, err
 	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return nil, err
+	}
 	err := s.writeTypeAndKey(TypeHash, key)
 	if err != nil {
 		return nil, err
@@ -98,7 +171,7 @@ func (s *FileEncoder) BeginHash(key string, expiry time.Time) (*HashEncoder, err
 	return NewHashEncoder(s)
 }
 
-func (s *FileEncoder) BeginHashWithMetadata(key string, expiry time.Time) (*HashMetadataEncoder, error) {
+func (s *FileEncoder) BeginHashWithMetadata(key string, expiry time.Time, opts ...EntryOption) (*HashMetadataEncoder, error) {
 	if s.begin {
 		return nil, fmt.Errorf("cannot begin; a collection is already being written. Call Close on the existing collection first")
 	}
@@ -106,6 +179,9 @@ func (s *FileEncoder) BeginHashWithMetadata(key string, expiry time.Time) (*Hash
 	if err := s.writeExpiry(expiry); err != nil {
 		return nil, err
 	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return nil, err
+	}
 	err := s.writeTypeAndKey(TypeHashMetadata, key)
 	if err != nil {
 		return nil, err
@@ -114,7 +190,7 @@ func (s *FileEncoder) BeginHashWithMetadata(key string, expiry time.Time) (*Hash
 	return NewHashMetadataEncoder(s)
 }
 
-func (s *FileEncoder) BeginStream(key string, expiry time.Time) (*StreamEncoder, error) {
+func (s *FileEncoder) BeginStream(key string, expiry time.Time, opts ...EntryOption) (*StreamEncoder, error) {
 	if s.begin {
 		return nil, fmt.Errorf("cannot begin; a collection is already being written. Call Close on the existing collection first")
 	}
@@ -122,6 +198,9 @@ func (s *FileEncoder) BeginStream(key string, expiry time.Time) (*StreamEncoder,
 	if err := s.writeExpiry(expiry); err != nil {
 		return nil, err
 	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return nil, err
+	}
 	err := s.writeTypeAndKey(TypeStreamListpacks, key)
 	if err != nil {
 		return nil, err
@@ -130,7 +209,7 @@ func (s *FileEncoder) BeginStream(key string, expiry time.Time) (*StreamEncoder,
 	return NewStreamEncoder(s)
 }
 
-func (s *FileEncoder) BeginList(key string, expiry time.Time) (*ListEncoder, error) {
+func (s *FileEncoder) BeginList(key string, expiry time.Time, opts ...EntryOption) (*ListEncoder, error) {
 	if s.begin {
 		return nil, fmt.Errorf("cannot begin; a collection is already being written. Call Close on the existing collection first")
 	}
@@ -138,6 +217,9 @@ func (s *FileEncoder) BeginList(key string, expiry time.Time) (*ListEncoder, err
 	if err := s.writeExpiry(expiry); err != nil {
 		return nil, err
 	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return nil, err
+	}
 	err := s.writeTypeAndKey(TypeList, key)
 	if err != nil {
 		return nil, err
@@ -146,7 +228,7 @@ func (s *FileEncoder) BeginList(key string, expiry time.Time) (*ListEncoder, err
 	return NewListEncoder(s)
 }
 
-func (s *FileEncoder) BeginSet(key string, expiry time.Time) (*SetEncoder, error) {
+func (s *FileEncoder) BeginSet(key string, expiry time.Time, opts ...EntryOption) (*SetEncoder, error) {
 	if s.begin {
 		return nil, fmt.Errorf("cannot begin; a collection is already being written. Call Close on the existing collection first")
 	}
@@ -154,6 +236,9 @@ func (s *FileEncoder) BeginSet(key string, expiry time.Time) (*SetEncoder, error
 	if err := s.writeExpiry(expiry); err != nil {
 		return nil, err
 	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return nil, err
+	}
 	err := s.writeTypeAndKey(TypeSet, key)
 	if err != nil {
 		return nil, err
@@ -162,7 +247,7 @@ func (s *FileEncoder) BeginSet(key string, expiry time.Time) (*SetEncoder, error
 	return NewSetEncoder(s)
 }
 
-func (s *FileEncoder) BeginSortedSet(key string, expiry time.Time) (*SortedSetEncoder, error) {
+func (s *FileEncoder) BeginSortedSet(key string, expiry time.Time, opts ...EntryOption) (*SortedSetEncoder, error) {
 	if s.begin {
 		return nil, fmt.Errorf("cannot begin; a collection is already being written. Call Close on the existing collection first")
 	}
@@ -170,6 +255,9 @@ func (s *FileEncoder) BeginSortedSet(key string, expiry time.Time) (*SortedSetEn
 	if err := s.writeExpiry(expiry); err != nil {
 		return nil, err
 	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return nil, err
+	}
 	err := s.writeTypeAndKey(TypeZset2, key)
 	if err != nil {
 		return nil, err
@@ -178,13 +266,16 @@ func (s *FileEncoder) BeginSortedSet(key string, expiry time.Time) (*SortedSetEn
 	return NewSortedSetEncoder(s)
 }
 
-func (s *FileEncoder) WriteJSON(key string, json string, expiry time.Time) error {
+func (s *FileEncoder) WriteJSON(key string, json string, expiry time.Time, opts ...EntryOption) error {
 	if s.begin {
 		return fmt.Errorf("cannot write; a collection is already being written. Call Close on the existing collection first")
 	}
 	if err := s.writeExpiry(expiry); err != nil {
 		return err
 	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return err
+	}
 	err := s.writeTypeAndKey(TypeModule2, key)
 	if err != nil {
 		return err
@@ -207,6 +298,57 @@ func (s *FileEncoder) WriteJSON(key string, json string, expiry time.Time) error
 	return nil
 }
 
+// WriteDumpPayload writes the value in the given payload of the DUMP command
+// for the key. The checksum of the payload is verified, and its RDB version must
+// not be greater than the version of the file. The value is written as it is,
+// with its encoding in the payload, without the version and the checksum.
+func (s *FileEncoder) WriteDumpPayload(key string, payload []byte, expiry time.Time, opts ...EntryOption) error {
+	if s.begin {
+		return fmt.Errorf("cannot write; a collection is already being written. Call Close on the existing collection first")
+	}
+	if err := VerifyValueChecksum(payload); err != nil {
+		return err
+	}
+	value := payload[:len(payload)-ValueChecksumSize]
+	if err := verifyRawValue(value); err != nil {
+		return err
+	}
+	if err := s.writeExpiry(expiry); err != nil {
+		return err
+	}
+	if err := s.writeEntryOptions(opts); err != nil {
+		return err
+	}
+	err := s.writeTypeAndKey(Type(value[0]), key)
+	if err != nil {
+		return err
+	}
+	if _, err := s.writer.Write(value[1:]); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// verifyRawValue verifies that the given bytes are a
+// single serialized value, in the form of <type><value>.
+func verifyRawValue(value []byte) error {
+	reader := &valueReader{
+		buf: newMemoryBackedBuffer(value),
+	}
+	t, err := reader.ReadType()
+	if err != nil {
+		return err
+	}
+	if err := reader.skipObject(t); err != nil {
+		return err
+	}
+	if n := len(value) - reader.buf.Pos(); n > 0 {
+		return fmt.Errorf("unexpected %d bytes after the value", n)
+	}
+	return nil
+}
+
 func (s *FileEncoder) WriteLibrary(code string) error {
 	if s.begin {
 		return fmt.Errorf("cannot write; a collection is already being written. Call Close on the existing collection first")
@@ -217,7 +359,50 @@ func (s *FileEncoder) WriteLibrary(code string) error {
 	return s.writeString(code)
 }
 
+// WriteModuleAux writes the auxiliary data of a module. The file can only be
+// loaded by the servers that have a module with the same name loaded.
+func (s *FileEncoder) WriteModuleAux(aux ModuleAux) error {
+	if s.begin {
+		return fmt.Errorf("cannot write; a collection is already being written. Call Close on the existing collection first")
+	}
+	if err := s.writer.WriteByte(byte(typeOpCodeModuleAux)); err != nil {
+		return err
+	}
+	if err := s.writer.WriteLength(aux.ID); err != nil {
+		return err
+	}
+	if err := s.writer.WriteLength(moduleOpCodeUInt); err != nil {
+		return err
+	}
+	if err := s.writer.WriteLength(aux.When); err != nil {
+		return err
+	}
+	for _, value := range aux.Values {
+		if err := s.writeModuleValue(value); err != nil {
+			return err
+		}
+	}
+	return s.writeModuleEOF()
+}
+
+// Close writes the end of the file and the sizes of the databases, and
+// closes the file, even if writing them fails.
 func (s *FileEncoder) Close() error {
+	err := s.finish()
+	if err != nil {
+		_ = s.writer.Close()
+		return err
+	}
+
+	return s.writer.Close()
+}
+
+// abort closes the file without finishing it, once encoding it fails.
+func (s *FileEncoder) abort() error {
+	return s.writer.Close()
+}
+
+func (s *FileEncoder) finish() error {
 	err := s.writeEOF()
 	if err != nil {
 		return err
@@ -230,6 +415,16 @@ func (s *FileEncoder) Close() error {
 	if err != nil {
 		return err
 	}
+	for _, size := range s.prevDBSizes {
+		_, err = s.writer.SeekPos(size.countPos)
+		if err != nil {
+			return err
+		}
+		err = s.writeResizeDB(int(size.count), int(size.countWithExp))
+		if err != nil {
+			return err
+		}
+	}
 	_, err = s.writer.SeekPos(s.countPos)
 	if err != nil {
 		return err
@@ -306,6 +501,28 @@ func (s *FileEncoder) writeModuleString(value string) error {
 	return s.writeString(value)
 }
 
+func (s *FileEncoder) writeModuleValue(value ModuleValue) error {
+	if value.OpCode == ModuleOpCodeString {
+		return s.writeModuleString(value.String)
+	}
+	err := s.writer.WriteLength(uint64(value.OpCode))
+	if err != nil {
+		return err
+	}
+	switch value.OpCode {
+	case ModuleOpCodeSInt:
+		return s.writer.WriteLength(uint64(value.SInt))
+	case ModuleOpCodeUInt:
+		return s.writer.WriteLength(value.UInt)
+	case ModuleOpCodeFloat:
+		return s.writer.WriteUint32(math.Float32bits(value.Float))
+	case ModuleOpCodeDouble:
+		return s.writer.WriteUint64(math.Float64bits(value.Double))
+	default:
+		return fmt.Errorf("unexpected module opcode %d", value.OpCode)
+	}
+}
+
 func (s *FileEncoder) writeModuleEOF() error {
 	return s.writer.WriteLength(moduleOpCodeEOF)
 }
@@ -317,7 +534,8 @@ func (s *FileEncoder) writeExpiry(expiry time.Time) error {
 	if err := s.writer.WriteByte(byte(typeOpCodeExpireTimeMS)); err != nil {
 		return err
 	}
-	msTimestamp := uint64(time.Until(expiry).Milliseconds())
+	// the expire time is the UNIX time in milliseconds
+	msTimestamp := uint64(expiry.UnixMilli())
 	if err := s.writer.WriteUint64(msTimestamp); err != nil {
 		return err
 	}
@@ -325,6 +543,34 @@ func (s *FileEncoder) writeExpiry(expiry time.Time) error {
 	return nil
 }
 
+func (s *FileEncoder) writeEntryOptions(opts []EntryOption) error {
+	if len(opts) == 0 {
+		return nil
+	}
+	var o entryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// Redis writes the idle time before the frequency, we do the same.
+	if o.hasIdle {
+		if err := s.writer.WriteByte(byte(typeOpCodeIdle)); err != nil {
+			return err
+		}
+		if err := s.writer.WriteLength(uint64(o.idle / time.Second)); err != nil {
+			return err
+		}
+	}
+	if o.hasFreq {
+		if err := s.writer.WriteByte(byte(typeOpCodeFreq)); err != nil {
+			return err
+		}
+		if err := s.writer.WriteUint8(o.freq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *FileEncoder) writeListpackStrEntry(value string) (uint32, error) {
 	// we always write 32 bit long strings for simplicity
 	err := s.writer.WriteUint8(listpackEnc32bitStrLen)
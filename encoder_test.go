@@ -1,7 +1,10 @@
 package rdb
 
 import (
+	"bytes"
+	"io"
 	"math"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -72,12 +75,80 @@ func TestEncoder_String(t *testing.T) {
 	for _, tc := range tests {
 		require.Equal(t, db.strings[tc.key], tc.value)
 		if !tc.expiry.IsZero() {
-			require.WithinDuration(t, time.Now().Add(db.expireTimes[tc.key]), tc.expiry, time.Second*30)
+			require.Equal(t, tc.expiry.UnixMilli(), db.expireTimes[tc.key].Milliseconds())
 		}
 	}
 
 }
 
+func TestEncoder_EvictionInfo(t *testing.T) {
+	rdbFile := filepath.Join(t.TempDir(), "eviction.rdb")
+
+	encoder, err := NewFileEncoder(rdbFile, version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	require.NoError(t, encoder.WriteStringEntry("freq", "a", time.Time{}, WithLFUFreq(42)))
+	require.NoError(t, encoder.WriteStringEntry("idle", "b", time.Now().Add(time.Hour), WithLRUIdle(90*time.Second)))
+	require.NoError(t, encoder.WriteStringEntry("none", "c", time.Time{}))
+	require.NoError(t, encoder.WriteStringEntry("negative", "d", time.Time{}, WithLRUIdle(-time.Minute)))
+
+	list, err := encoder.BeginList("list", time.Time{}, WithLFUFreq(7), WithLRUIdle(time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, list.WriteFieldStr("x"))
+	require.NoError(t, list.Close())
+
+	require.NoError(t, encoder.Close())
+
+	db := newEvictionDummyDB()
+	err = ReadFile(rdbFile, db)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]uint8{"freq": 42, "list": 7}, db.freqs)
+	require.Equal(t, map[string]time.Duration{"idle": 90 * time.Second, "negative": 0, "list": time.Minute}, db.idles)
+	require.Equal(t, "c", db.strings["none"])
+	require.Equal(t, []string{"x"}, db.lists["list"])
+}
+
+func TestEncoder_closeFile(t *testing.T) {
+	encoder, err := NewFileEncoder(filepath.Join(t.TempDir(), "close.rdb"), version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+	require.NoError(t, encoder.Close())
+
+	// the file is closed along with the encoder
+	_, err = encoder.writer.f.Write([]byte{0})
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestEncoder_SelectDB(t *testing.T) {
+	rdbFile := filepath.Join(t.TempDir(), "select-db.rdb")
+
+	encoder, err := NewFileEncoder(rdbFile, version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	require.NoError(t, encoder.WriteStringEntry("a", "0", time.Time{}))
+	require.NoError(t, encoder.SelectDB(2))
+	require.NoError(t, encoder.WriteStringEntry("a", "2", time.Time{}))
+
+	list, err := encoder.BeginList("b", time.Time{})
+	require.NoError(t, err)
+	require.Error(t, encoder.SelectDB(3))
+	require.NoError(t, list.WriteFieldStr("x"))
+	require.NoError(t, list.Close())
+
+	require.NoError(t, encoder.SelectDB(5))
+	require.NoError(t, encoder.Close())
+
+	ds, err := LoadFile(rdbFile, LoadOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, Database{"a": {Value: String("0")}}, ds.DBs[0])
+	require.Equal(t, Database{"a": {Value: String("2")}, "b": {Value: List{"x"}}}, ds.DBs[2])
+	require.Empty(t, ds.DBs[5])
+}
+
 func TestEncoder_List(t *testing.T) {
 	tempDir := t.TempDir()
 	rdbFile := filepath.Join(tempDir, "list.rdb")
@@ -362,6 +433,37 @@ func TestEncoder_JSON(t *testing.T) {
 	require.Equal(t, db.modules[jsonKey], jsonValue)
 }
 
+func TestEncoder_ModuleAux(t *testing.T) {
+	rdbFile := filepath.Join(t.TempDir(), "module-aux.rdb")
+
+	encoder, err := NewFileEncoder(rdbFile, version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	aux := ModuleAux{
+		ID:   9142274936141893655,
+		Name: "ft_index0",
+		When: ModuleAuxBeforeRDB,
+		Values: []ModuleValue{
+			{OpCode: ModuleOpCodeSInt, SInt: -42},
+			{OpCode: ModuleOpCodeUInt, UInt: 42},
+			{OpCode: ModuleOpCodeFloat, Float: 4.5},
+			{OpCode: ModuleOpCodeDouble, Double: math.Pi},
+			{OpCode: ModuleOpCodeString, String: "idx"},
+		},
+	}
+	require.NoError(t, encoder.WriteModuleAux(aux))
+	require.NoError(t, encoder.WriteStringEntry("key", "value", time.Time{}))
+	require.NoError(t, encoder.Close())
+
+	db := &moduleAuxDummyDB{dummyDB: newDummyDB()}
+	err = ReadFile(rdbFile, db)
+	require.NoError(t, err)
+
+	require.Equal(t, []ModuleAux{aux}, db.moduleAux)
+	require.Equal(t, "value", db.strings["key"])
+}
+
 func TestEncoder_Functions(t *testing.T) {
 	tempDir := t.TempDir()
 	rdbFile := filepath.Join(tempDir, "functions.rdb")
@@ -395,3 +497,62 @@ func TestEncoder_Functions(t *testing.T) {
 	require.Len(t, db.libraries, 1)
 	require.Equal(t, db.libraries[0], libraryCode)
 }
+
+func TestEncoder_DumpPayload(t *testing.T) {
+	rdbFile := filepath.Join(t.TempDir(), "dump.rdb")
+
+	encoder, err := NewFileEncoder(rdbFile, version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	w := NewWriter()
+	require.NoError(t, w.WriteType(TypeString))
+	require.NoError(t, w.WriteString("foo"))
+	require.NoError(t, w.WriteChecksum(Version))
+	expiry := time.Now().Add(time.Hour)
+	require.NoError(t, encoder.WriteDumpPayload("a", w.GetBuffer(), expiry))
+
+	w = NewWriter()
+	require.NoError(t, w.WriteType(TypeList))
+	require.NoError(t, w.WriteList([]string{"x", "y"}))
+	require.NoError(t, w.WriteChecksum(Version))
+	require.NoError(t, encoder.WriteDumpPayload("b", w.GetBuffer(), time.Time{}))
+
+	payload := bytes.Clone(w.GetBuffer())
+	payload[len(payload)-1]++
+	require.ErrorContains(t, encoder.WriteDumpPayload("c", payload, time.Time{}), "invalid CRC value for the payload")
+
+	future := DumpPayload([]byte{byte(TypeString), 1, 'a'}, Version+1)
+	require.ErrorContains(t, encoder.WriteDumpPayload("c", future, time.Time{}), "is not supported")
+
+	outOfRange := DumpPayload([]byte{byte(TypeString), 0x81, 0x80, 0, 0, 0, 0, 0, 0, 0}, Version)
+	require.ErrorIs(t, encoder.WriteDumpPayload("c", outOfRange, time.Time{}), errLengthOutOfRange)
+
+	truncated := DumpPayload([]byte{byte(TypeString), 0x81, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, Version)
+	require.ErrorIs(t, encoder.WriteDumpPayload("c", truncated, time.Time{}), io.EOF)
+
+	trailing := DumpPayload([]byte{byte(TypeString), 1, 'a', 0}, Version)
+	require.ErrorContains(t, encoder.WriteDumpPayload("c", trailing, time.Time{}), "unexpected 1 bytes after the value")
+
+	require.NoError(t, encoder.Close())
+
+	db := newDummyDB()
+	require.NoError(t, ReadFile(rdbFile, db))
+	require.Equal(t, map[string]string{"a": "foo"}, db.strings)
+	require.Equal(t, map[string][]string{"b": {"x", "y"}}, db.lists)
+	require.Contains(t, db.expireTimes, "a")
+
+	data, err := os.ReadFile(rdbFile)
+	require.NoError(t, err)
+
+	// the number of entries, and the ones with the expiry times
+	pos := bytes.Index(data, []byte{byte(typeOpCodeSelectDB), 0, byte(typeOpCodeResizeDB)})
+	require.Positive(t, pos)
+	reader := &valueReader{buf: newMemoryBackedBuffer(data[pos+3:])}
+	count, _, err := reader.readLen()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), count)
+	countWithExp, _, err := reader.readLen()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), countWithExp)
+}
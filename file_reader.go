@@ -1,11 +1,14 @@
 package rdb
 
 import (
+	"bufio"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strconv"
 	"time"
 )
@@ -16,12 +19,81 @@ const versionLen = 4
 const headerLen = magicLen + versionLen
 const crcLen = 8
 
+var errWrongCRC = errors.New("wrong CRC at the end of the RDB file")
+
 // ReadFile reads the RDB file in the given path, and calls the appropriate methods
 // of the handler for the objects read. It also allows partial read of the file which
 // means the function will skip some parts of the file, which is not compatible
 // with Upstash yet. These parts include function data, multiple databases(any database other than 0),
-// and unsupported modules.
+// and unsupported modules. If the handler implements DBHandler, entries of all the
+// databases are passed to the handler instead.
 func ReadFile(path string, handler FileHandler) error {
+	return ReadFileWithOptions(path, handler, ReadOptions{})
+}
+
+// ReadOptions are the options to filter the entries passed to the handler.
+// The values of the entries that do not match the options are skipped
+// using their length prefixes, without being decoded.
+type ReadOptions struct {
+	// KeyPattern is the glob-style pattern the keys must match, such as
+	// "user:*", with the same syntax as the KEYS command. All the keys
+	// match it when it is empty.
+	KeyPattern string
+	// Kinds are the logical types of the values to read. Values
+	// of all types are read when it is empty.
+	Kinds []Kind
+	// DBs are the numbers of the databases to read. All the databases are
+	// read when it is empty, although only the database 0 is passed to
+	// the handlers that do not implement the DBHandler.
+	DBs []uint64
+	// ReuseBuffer makes the reader reuse the memory of its buffers for the
+	// next entries, instead of allocating new ones as the file is read.
+	// The strings and the byte slices passed to the handler share the
+	// memory of the buffers, so they are valid only until the next entry
+	// of the file is read, after which they must not be used. The values
+	// that are retained by the handler must be copied, e.g. with
+	// strings.Clone or bytes.Clone.
+	ReuseBuffer bool
+	// Progress is called after each entry is read, and once the file is
+	// read completely, with the progress of the read so far.
+	Progress func(Progress)
+}
+
+// Progress is the progress of reading an RDB file.
+type Progress struct {
+	// BytesRead is the number of bytes of the file read so far.
+	BytesRead int64
+	// TotalBytes is the size of the file, or 0 if it is not known
+	// up front, as for the files read from readers.
+	TotalBytes int64
+	// Keys is the number of entries read so far, including
+	// the ones that are filtered out by the options.
+	Keys uint64
+}
+
+func (o *ReadOptions) matchKey(key string) bool {
+	return o.KeyPattern == "" || matchGlob(o.KeyPattern, key)
+}
+
+func (o *ReadOptions) matchKind(t Type) bool {
+	return len(o.Kinds) == 0 || slices.Contains(o.Kinds, t.Kind())
+}
+
+func (o *ReadOptions) matchDB(dbnum uint64) bool {
+	return len(o.DBs) == 0 || slices.Contains(o.DBs, dbnum)
+}
+
+// ReadFileWithOptions reads the RDB file in the given path in the same way as
+// ReadFile, but only the entries that match the given options are passed to
+// the handler.
+func ReadFileWithOptions(path string, handler FileHandler, opts ReadOptions) error {
+	return ReadFileContext(context.Background(), path, handler, opts)
+}
+
+// ReadFileContext reads the RDB file in the given path in the same way as
+// ReadFileWithOptions, and stops reading with the error of the context once
+// it is done. The context is checked between the entries of the file.
+func ReadFileContext(ctx context.Context, path string, handler FileHandler, opts ReadOptions) error {
 	file, err := os.Open(path)
 	if err != nil {
 		return err
@@ -36,10 +108,48 @@ func ReadFile(path string, handler FileHandler) error {
 	fileLen := info.Size()
 	buf := newFileBackedBuffer(file, int(fileLen), minInt(int(fileLen), 1<<20))
 
-	return readFile(buf, handler, 0)
+	return readFile(ctx, buf, handler, 0, opts)
 }
 
-func readFile(buf buffer, handler FileHandler, maxLz77StrLen uint64) error {
+// ReadReader reads the RDB file from the given reader, and calls the appropriate
+// methods of the handler for the objects read, in the same way as ReadFile.
+// The reader is consumed in a single forward pass, so it can be a pipe, a network
+// connection, or a decompression stream. Since the reader cannot be rewound, the
+// values of the pending entries of the stream consumer groups are not populated.
+func ReadReader(r io.Reader, handler FileHandler) error {
+	return ReadReaderWithOptions(r, handler, ReadOptions{})
+}
+
+// ReadReaderWithOptions reads the RDB file from the given reader in the same way
+// as ReadReader, but only the entries that match the given options are passed
+// to the handler.
+func ReadReaderWithOptions(r io.Reader, handler FileHandler, opts ReadOptions) error {
+	return ReadReaderContext(context.Background(), r, handler, opts)
+}
+
+// ReadReaderContext reads the RDB file from the given reader in the same way
+// as ReadReaderWithOptions, and stops reading with the error of the context
+// once it is done. The context is checked between the entries of the file.
+func ReadReaderContext(ctx context.Context, r io.Reader, handler FileHandler, opts ReadOptions) error {
+	buf := newForwardOnlyBuffer(bufio.NewReaderSize(r, 1<<20))
+	return readFile(ctx, buf, handler, 0, opts)
+}
+
+func readFile(ctx context.Context, buf buffer, handler FileHandler, maxLz77StrLen uint64, opts ReadOptions) error {
+	trace := &parseTrace{}
+	err := readEntries(ctx, buf, handler, maxLz77StrLen, opts, trace)
+	if errors.Is(err, ErrStop) {
+		return nil
+	}
+
+	if err != nil && err == ctx.Err() {
+		return err
+	}
+
+	return trace.wrap(err, buf.Pos())
+}
+
+func readEntries(ctx context.Context, buf buffer, handler FileHandler, maxLz77StrLen uint64, opts ReadOptions, trace *parseTrace) error {
 	// An RDB file has the following form:
 	// <magic><version>[<select-db>[<resize-db>]<entry>*]*[<aux>*][<module-aux>*][<function>*]<eof>[<crc>]
 	// where
@@ -75,40 +185,126 @@ func readFile(buf buffer, handler FileHandler, maxLz77StrLen uint64) error {
 	// After that, there might be a 8 byte unsigned integer describing the CRC-64 of the file content.
 	// The <crc> is added in RDB version 5, and after that version, it is always there. The RDB CRC calculation
 	// might be disabled in the database configuration. In that case, it has the value of 0.
-	header, err := buf.Get(headerLen)
+	state, err := readHeader(buf)
 	if err != nil {
 		return err
 	}
 
+	return readBody(ctx, buf, handler, maxLz77StrLen, opts, trace, state)
+}
+
+// readHeader reads the <magic> and the <version> of the file, and
+// returns the state of the reader for the entries that follow them.
+func readHeader(buf buffer) (*entriesState, error) {
+	header, err := buf.Get(headerLen)
+	if err != nil {
+		return nil, err
+	}
+
 	if bytesToString(header[:magicLen]) != magicStr {
-		return errors.New("wrong signature trying to load DB from file")
+		return nil, errors.New("wrong signature trying to load DB from file")
 	}
 
 	version, err := strconv.Atoi(bytesToString(header[magicLen:]))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if version < 1 || version > int(Version) {
-		return fmt.Errorf("cannot handle RDB format version %d", version)
+		return nil, fmt.Errorf("cannot handle RDB format version %d", version)
 	}
 
-	endsWithCRC := version >= 5
+	state := &entriesState{
+		endsWithCRC: version >= 5,
+		checkCRC:    true,
+	}
 
-	if !endsWithCRC {
+	if !state.endsWithCRC {
 		buf.DoNotCalcCrc()
 	}
 
+	return state, nil
+}
+
+// entriesState is the state of the reader that is carried from an entry of the
+// file to the next, so that the file can be read from the middle of it as well.
+type entriesState struct {
+	// whether the file ends with a CRC, and whether it is checked
+	endsWithCRC bool
+	checkCRC    bool
+	// the number of the selected database
+	dbnum uint64
+	// whether the entries of the selected database are skipped
+	skipDB bool
+	// whether the entries of the selected database are filtered out
+	filterDB bool
+	// the number of entries read, and the number reported to the progress callback
+	keys, reportedKeys uint64
+	// the number of keys of the selected database declared by the resize db
+	// opcode, which is 0 if it is not declared, and the number of entries
+	// read from the selected database
+	dbSize, dbKeys uint64
+	// the offset of the opcode or the type being read
+	pos int
+}
+
+// readBody reads the entries of the file after its header, until the eof opcode.
+func readBody(ctx context.Context, buf buffer, handler FileHandler, maxLz77StrLen uint64, opts ReadOptions, trace *parseTrace, state *entriesState) error {
 	reader := &valueReader{
 		buf:           buf,
 		maxLz77StrLen: maxLz77StrLen,
+		trace:         trace,
 	}
 
 	handler0 := handler
+	dbHandler, allDBs := handler.(DBHandler)
+	auxHandler, hasAuxHandler := handler.(AuxHandler)
+	moduleAuxHandler, hasModuleAuxHandler := handler.(ModuleAuxHandler)
+	keyInfoHandler, hasKeyInfoHandler := handler.(KeyInfoHandler)
+	reusable, reuse := buf.(reusableBuffer)
+	reuse = reuse && opts.ReuseBuffer
+	if reuse {
+		reusable.enableReuse()
+	}
+
+	if state.skipDB {
+		handler = nopHandler{}
+	}
+
+	var meta entryMetadata
+	var totalBytes int64
+	if sized, ok := buf.(sizedBuffer); ok {
+		totalBytes = int64(sized.size())
+	}
+	report := func() {
+		state.reportedKeys = state.keys
+		if opts.Progress != nil {
+			opts.Progress(Progress{
+				BytesRead:  int64(buf.Pos()),
+				TotalBytes: totalBytes,
+				Keys:       state.keys,
+			})
+		}
+	}
 
-	var hasExpireTime bool
-	var expireTime time.Duration
 	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if state.keys != state.reportedKeys {
+			report()
+		}
+
+		if reuse {
+			// nothing read for the previous entries is used anymore
+			reusable.release()
+		}
+
+		pos := buf.Pos()
+		state.pos = pos
 		t, err := reader.ReadType()
 		if err != nil {
 			return err
@@ -116,7 +312,7 @@ func readFile(buf buffer, handler FileHandler, maxLz77StrLen uint64) error {
 
 		switch t {
 		case typeOpCodeEOF:
-			if endsWithCRC {
+			if state.endsWithCRC {
 				buf.DoNotCalcCrc()
 				crcFooter, err := buf.Get(crcLen)
 				if err != nil {
@@ -124,11 +320,11 @@ func readFile(buf buffer, handler FileHandler, maxLz77StrLen uint64) error {
 				}
 
 				crc := binary.LittleEndian.Uint64(crcFooter)
-				if crc != 0 && buf.Crc() != crc {
+				if state.checkCRC && crc != 0 && buf.Crc() != crc {
 					// crc calculation can be disabled by the redis config.
 					// if it is disabled, the crc bytes are still there but
 					// it is equal to 0.
-					return errors.New("wrong CRC at the end of the RDB file")
+					return errWrongCRC
 				}
 			}
 
@@ -139,39 +335,57 @@ func readFile(buf buffer, handler FileHandler, maxLz77StrLen uint64) error {
 				}
 			}
 
+			report()
 			return nil
 		case typeOpCodeSelectDB:
 			dbnum, _, err := reader.readLen()
 			if err != nil {
 				return err
 			}
-
-			if dbnum != 0 {
+			trace.db = dbnum
+			state.dbnum = dbnum
+			state.dbSize = 0
+			state.dbKeys = 0
+
+			state.filterDB = !opts.matchDB(dbnum)
+			if state.filterDB {
+				// the entries are skipped below, regardless of the handler
+			} else if allDBs {
+				err = dbHandler.HandleSelectDB(dbnum)
+				if err != nil {
+					return err
+				}
+			} else if dbnum != 0 {
 				if !handler.AllowPartialRead() {
 					return errors.New("multiple databases are not supported when the partial restore is not allowed")
 				}
 
 				handler = nopHandler{}
+				state.skipDB = true
 			} else {
 				handler = handler0
+				state.skipDB = false
 			}
 		case typeOpCodeExpireTime:
 			t, err := reader.readUint32()
 			if err != nil {
 				return err
 			}
-			hasExpireTime = true
-			expireTime = time.Duration(t) * time.Second
+
+			meta.begin(pos)
+			meta.hasExpireTime = true
+			meta.expireTime = time.Duration(t) * time.Second
 		case typeOpCodeExpireTimeMS:
 			t, err := reader.readUint64()
 			if err != nil {
 				return err
 			}
 
-			hasExpireTime = true
-			expireTime = time.Duration(t) * time.Millisecond
+			meta.begin(pos)
+			meta.hasExpireTime = true
+			meta.expireTime = time.Duration(t) * time.Millisecond
 		case typeOpCodeResizeDB:
-			_, _, err = reader.readLen() // db size
+			state.dbSize, _, err = reader.readLen() // db size
 			if err != nil {
 				return err
 			}
@@ -181,27 +395,42 @@ func readFile(buf buffer, handler FileHandler, maxLz77StrLen uint64) error {
 				return err
 			}
 		case typeOpCodeAux:
-			_, err = reader.ReadString() // aux key
+			key, err := reader.ReadString() // aux key
 			if err != nil {
 				return err
 			}
 
-			_, err = reader.ReadString() // aux value
+			value, err := reader.ReadString() // aux value
 			if err != nil {
 				return err
 			}
+
+			if hasAuxHandler {
+				err = auxHandler.HandleAux(key, value)
+				if err != nil {
+					return err
+				}
+			}
 		case typeOpCodeFreq:
-			_, err = reader.readUint8() // lfu freq
+			freq, err := reader.readUint8() // lfu freq
 			if err != nil {
 				return err
 			}
+
+			meta.begin(pos)
+			meta.hasFreq = true
+			meta.freq = freq
 		case typeOpCodeIdle:
-			_, _, err = reader.readLen() // lru idle
+			idle, _, err := reader.readLen() // lru idle
 			if err != nil {
 				return err
 			}
+
+			meta.begin(pos)
+			meta.hasIdle = true
+			meta.idle = time.Duration(idle) * time.Second
 		case typeOpCodeModuleAux:
-			_, _, err = reader.readLen() // module id
+			id, _, err := reader.readLen() // module id
 			if err != nil {
 				return err
 			}
@@ -210,9 +439,21 @@ func readFile(buf buffer, handler FileHandler, maxLz77StrLen uint64) error {
 				reader: reader,
 			}
 
-			err = mReader.Skip()
-			if err != nil {
-				return err
+			if hasModuleAuxHandler {
+				aux, err := mReader.ReadAux(id)
+				if err != nil {
+					return err
+				}
+
+				err = moduleAuxHandler.HandleModuleAux(aux)
+				if err != nil {
+					return err
+				}
+			} else {
+				err = mReader.Skip()
+				if err != nil {
+					return err
+				}
 			}
 		case typeOpCodeFunctionPreGA:
 			return errors.New("pre-release function format not supported")
@@ -226,34 +467,137 @@ func readFile(buf buffer, handler FileHandler, maxLz77StrLen uint64) error {
 				return err
 			}
 		default:
+			trace.beginEntry(t)
+			state.keys++
+			state.dbKeys++
 			if t > TypeHashListpackEx {
 				return fmt.Errorf("unknown RDB encoding type %d", t)
 			}
 
-			err = readObject(reader, handler, t, hasExpireTime, expireTime)
+			meta.begin(pos)
+			if state.filterDB || !opts.matchKind(t) {
+				err = reader.skipString() // key
+				if err == nil {
+					err = reader.skipObject(t)
+				}
+				if err != nil {
+					return err
+				}
+
+				meta = entryMetadata{}
+				trace.endEntry()
+				continue
+			}
+
+			key, err := reader.ReadString()
+			if err != nil {
+				return err
+			}
+			trace.key = key
+
+			if !opts.matchKey(key) {
+				err = reader.skipObject(t)
+				if err != nil {
+					return err
+				}
+
+				meta = entryMetadata{}
+				trace.endEntry()
+				continue
+			}
+
+			if rawHandler, ok := handler.(RawValueHandler); ok {
+				err = readRawObject(reader, rawHandler, key, t, meta)
+			} else {
+				err = readObject(reader, handler, key, t, meta)
+			}
 			if err != nil {
 				return err
 			}
 
-			hasExpireTime = false
+			if hasKeyInfoHandler && !state.skipDB {
+				info := KeyInfo{
+					DB:     state.dbnum,
+					Key:    key,
+					Type:   t,
+					Offset: int64(meta.offset),
+					Size:   int64(buf.Pos() - meta.offset),
+				}
+
+				if meta.hasExpireTime {
+					info.ExpireTime = time.UnixMilli(meta.expireTime.Milliseconds())
+				}
+
+				err = keyInfoHandler.HandleKeyInfo(info)
+				if err != nil {
+					return err
+				}
+			}
+
+			meta = entryMetadata{}
+			trace.endEntry()
 		}
 	}
 }
 
-func readObject(reader *valueReader, handler FileHandler, t Type, hasExpireTime bool, expireTime time.Duration) error {
-	key, err := reader.ReadString()
+// entryMetadata holds the optional information that precedes the <type> of an entry.
+type entryMetadata struct {
+	// offset of the first byte of the entry, including the optional information
+	offset        int
+	started       bool
+	hasExpireTime bool
+	expireTime    time.Duration
+	hasFreq       bool
+	freq          uint8
+	hasIdle       bool
+	idle          time.Duration
+}
+
+// begin records the offset of the entry, if the given position is
+// where its first byte is.
+func (m *entryMetadata) begin(pos int) {
+	if !m.started {
+		m.started = true
+		m.offset = pos
+	}
+}
+
+func readObject(reader *valueReader, handler FileHandler, key string, t Type, meta entryMetadata) error {
+	handleMetadata(handler, key, meta)
+	return reader.readObject(key, t, handler)
+}
+
+// readRawObject passes the serialized bytes of the value to the handler, instead of decoding it.
+func readRawObject(reader *valueReader, handler RawValueHandler, key string, t Type, meta entryMetadata) error {
+	handleMetadata(handler, key, meta)
+	value, err := reader.readRaw(t)
 	if err != nil {
 		return err
 	}
 
-	if hasExpireTime {
-		handler.HandleExpireTime(key, expireTime)
+	err = handler.HandleRawValue(key, value)
+	if errors.Is(err, ErrSkipKey) {
+		return nil
 	}
 
-	err = reader.readObject(key, t, handler)
-	if err != nil {
-		return err
+	return err
+}
+
+// handleMetadata passes the optional information of the entry to the handler.
+func handleMetadata(handler FileHandler, key string, meta entryMetadata) {
+	if meta.hasExpireTime {
+		handler.HandleExpireTime(key, meta.expireTime)
 	}
 
-	return nil
+	if meta.hasFreq || meta.hasIdle {
+		if h, ok := handler.(EvictionHandler); ok {
+			if meta.hasFreq {
+				h.HandleFreq(key, meta.freq)
+			}
+
+			if meta.hasIdle {
+				h.HandleIdle(key, meta.idle)
+			}
+		}
+	}
 }
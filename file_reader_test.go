@@ -1,9 +1,14 @@
 package rdb
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
+	"os"
 	"path/filepath"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/stretchr/testify/require"
@@ -239,6 +244,68 @@ func TestFileReader_multiDB(t *testing.T) {
 	require.Equal(t, expected, db)
 }
 
+type multiDummyDB struct {
+	*dummyDB
+	selected  []uint64
+	stringDBs map[string][]uint64
+}
+
+func newMultiDummyDB() *multiDummyDB {
+	return &multiDummyDB{
+		dummyDB:   newDummyDB(),
+		selected:  make([]uint64, 0),
+		stringDBs: make(map[string][]uint64),
+	}
+}
+
+func (db *multiDummyDB) HandleSelectDB(dbnum uint64) error {
+	db.selected = append(db.selected, dbnum)
+	return nil
+}
+
+func (db *multiDummyDB) HandleString(key, value string) error {
+	dbnum := db.selected[len(db.selected)-1]
+	db.stringDBs[key] = append(db.stringDBs[key], dbnum)
+	return db.dummyDB.HandleString(key, value)
+}
+
+func TestFileReader_multiDB_allDBs(t *testing.T) {
+	db := newMultiDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), db)
+	require.NoError(t, err)
+
+	require.Equal(t, []uint64{0, 1}, db.selected)
+	require.Equal(t, map[string][]uint64{"00": {0, 1}}, db.stringDBs)
+	require.Equal(t, []string{"a"}, db.lists["01"])
+	require.Equal(t, map[string]string{"a": "a"}, db.hashes["04"])
+	require.Equal(t, map[string]float64{"a": 0}, db.zsets["17"])
+}
+
+type auxDummyDB struct {
+	*dummyDB
+	aux [][2]string
+}
+
+func (db *auxDummyDB) HandleAux(key, value string) error {
+	db.aux = append(db.aux, [2]string{key, value})
+	return nil
+}
+
+func TestFileReader_aux(t *testing.T) {
+	db := &auxDummyDB{dummyDB: newDummyDB()}
+	err := ReadFile(filepath.Join(dumpsPath, "disabled-crc.rdb"), db)
+	require.NoError(t, err)
+
+	expected := [][2]string{
+		{"redis-ver", "7.0.12"},
+		{"redis-bits", "64"},
+		{"ctime", "1694535022"},
+		{"used-mem", "959256"},
+		{"aof-base", "0"},
+	}
+	require.Equal(t, expected, db.aux)
+}
+
 func TestFileReader_moduleAux(t *testing.T) {
 	db := newDummyDB()
 	err := ReadFile(filepath.Join(dumpsPath, "module-aux.rdb"), db)
@@ -250,6 +317,46 @@ func TestFileReader_moduleAux(t *testing.T) {
 	require.Equal(t, expected, db)
 }
 
+type moduleAuxDummyDB struct {
+	*dummyDB
+	moduleAux []ModuleAux
+}
+
+func (db *moduleAuxDummyDB) HandleModuleAux(aux ModuleAux) error {
+	db.moduleAux = append(db.moduleAux, aux)
+	return nil
+}
+
+func TestFileReader_moduleAuxHandler(t *testing.T) {
+	db := &moduleAuxDummyDB{dummyDB: newDummyDB()}
+	err := ReadFile(filepath.Join(dumpsPath, "module-aux.rdb"), db)
+	require.NoError(t, err)
+
+	expected := []ModuleAux{
+		{
+			ID:     12810328381974695937,
+			Name:   "scdtype00",
+			When:   ModuleAuxBeforeRDB,
+			Values: []ModuleValue{},
+		},
+		{
+			ID:     9142274936141893655,
+			Name:   "ft_index0",
+			When:   ModuleAuxBeforeRDB,
+			Values: []ModuleValue{{OpCode: ModuleOpCodeUInt, UInt: 0}},
+		},
+		{
+			ID:     12810328381974695937,
+			Name:   "scdtype00",
+			When:   ModuleAuxAfterRDB,
+			Values: []ModuleValue{{OpCode: ModuleOpCodeUInt, UInt: 0}},
+		},
+	}
+	require.Equal(t, expected, db.moduleAux)
+	require.Equal(t, uint64(1), db.moduleAux[0].Version())
+	require.Equal(t, "{\"a\":2}", db.modules["doc"])
+}
+
 func TestFileReader_withIdleInfo(t *testing.T) {
 	db := newDummyDB()
 	err := ReadFile(filepath.Join(dumpsPath, "idle.rdb"), db)
@@ -274,6 +381,42 @@ func TestFileReader_withFreqInfo(t *testing.T) {
 	require.Equal(t, expected, db)
 }
 
+type evictionDummyDB struct {
+	*dummyDB
+	freqs map[string]uint8
+	idles map[string]time.Duration
+}
+
+func newEvictionDummyDB() *evictionDummyDB {
+	return &evictionDummyDB{
+		dummyDB: newDummyDB(),
+		freqs:   make(map[string]uint8),
+		idles:   make(map[string]time.Duration),
+	}
+}
+
+func (db *evictionDummyDB) HandleFreq(key string, freq uint8) {
+	db.freqs[key] = freq
+}
+
+func (db *evictionDummyDB) HandleIdle(key string, idle time.Duration) {
+	db.idles[key] = idle
+}
+
+func TestFileReader_evictionInfo(t *testing.T) {
+	db := newEvictionDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "idle.rdb"), db)
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{"up": 2 * time.Second}, db.idles)
+	require.Empty(t, db.freqs)
+
+	db = newEvictionDummyDB()
+	err = ReadFile(filepath.Join(dumpsPath, "freq.rdb"), db)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint8{"up": 5}, db.freqs)
+	require.Empty(t, db.idles)
+}
+
 func TestFileReader_function(t *testing.T) {
 	db := newDummyDB()
 	err := ReadFile(filepath.Join(dumpsPath, "function.rdb"), db)
@@ -367,3 +510,730 @@ func TestFileReader_allTypes(t *testing.T) {
 
 	require.Equal(t, expected, db)
 }
+
+func TestReadReader(t *testing.T) {
+	files := []string{
+		"all-types.rdb",
+		"disabled-crc.rdb",
+		"expiretime-sec.rdb",
+		"function.rdb",
+		"module-aux.rdb",
+		"no-crc.rdb",
+	}
+
+	for _, name := range files {
+		t.Run(name, func(t *testing.T) {
+			expected := newDummyDB()
+			err := ReadFile(filepath.Join(dumpsPath, name), expected)
+			require.NoError(t, err)
+
+			file, err := os.Open(filepath.Join(dumpsPath, name))
+			require.NoError(t, err)
+			defer file.Close()
+
+			db := newDummyDB()
+			err = ReadReader(iotest.HalfReader(file), db)
+			require.NoError(t, err)
+
+			require.Equal(t, expected, db)
+		})
+	}
+}
+
+func TestReadReader_badCRC(t *testing.T) {
+	file, err := os.Open(filepath.Join(dumpsPath, "bad-crc.rdb"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	err = ReadReader(file, newDummyDB())
+	require.ErrorContains(t, err, "wrong CRC at the end of the RDB file")
+}
+
+func TestReadReader_truncated(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join(dumpsPath, "all-types.rdb"))
+	require.NoError(t, err)
+
+	err = ReadReader(bytes.NewReader(data[:len(data)/2]), newDummyDB())
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+type keyInfoDummyDB struct {
+	*dummyDB
+	infos []KeyInfo
+}
+
+func (db *keyInfoDummyDB) HandleKeyInfo(info KeyInfo) error {
+	db.infos = append(db.infos, info)
+	return nil
+}
+
+func TestFileReader_keyInfo(t *testing.T) {
+	db := &keyInfoDummyDB{dummyDB: newDummyDB()}
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), db)
+	require.NoError(t, err)
+
+	types := []Type{
+		TypeString, TypeList, TypeSet, TypeZset, TypeHash, TypeZset2, TypeModule2,
+		TypeHashZipmap, TypeListZiplist, TypeSetIntset, TypeZsetZiplist, TypeHashZiplist,
+		TypeListQuicklist, TypeStreamListpacks, TypeHashListpack, TypeZsetListpack,
+		TypeListQuicklist2, TypeStreamListpacks2, TypeSetListpack, TypeStreamListpacks3,
+	}
+	require.Len(t, db.infos, len(types))
+
+	for i, info := range db.infos {
+		require.Equal(t, uint64(0), info.DB)
+		require.Equal(t, types[i], info.Type, info.Key)
+		require.True(t, info.ExpireTime.IsZero())
+		if i > 0 {
+			// the entries are written back to back
+			prev := db.infos[i-1]
+			require.Equal(t, prev.Offset+prev.Size, info.Offset, info.Key)
+		}
+	}
+
+	// <type><key-len>00<value-len>a
+	require.Equal(t, KeyInfo{DB: 0, Key: "00", Type: TypeString, Offset: db.infos[0].Offset, Size: 6}, db.infos[0])
+}
+
+func TestFileReader_keyInfoExpireTime(t *testing.T) {
+	db := &keyInfoDummyDB{dummyDB: newDummyDB()}
+	err := ReadFile(filepath.Join(dumpsPath, "idle.rdb"), db)
+	require.NoError(t, err)
+
+	require.Len(t, db.infos, 1)
+	info := db.infos[0]
+	require.Equal(t, "up", info.Key)
+	require.Equal(t, TypeString, info.Type)
+	require.Equal(t, time.UnixMilli(1694542150330), info.ExpireTime)
+	// <expire-ms><idle><type><key><value>
+	require.Equal(t, int64(9+2+1+3+6), info.Size)
+}
+
+type multiKeyInfoDummyDB struct {
+	*keyInfoDummyDB
+}
+
+func (db *multiKeyInfoDummyDB) HandleSelectDB(dbnum uint64) error {
+	return nil
+}
+
+func TestFileReader_keyInfoMultiDB(t *testing.T) {
+	db := &keyInfoDummyDB{dummyDB: newDummyDB()}
+	db.partialRead = true
+	err := ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), db)
+	require.NoError(t, err)
+
+	for _, info := range db.infos {
+		require.Equal(t, uint64(0), info.DB)
+	}
+
+	multi := &multiKeyInfoDummyDB{&keyInfoDummyDB{dummyDB: newDummyDB()}}
+	err = ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), multi)
+	require.NoError(t, err)
+
+	dbs := make(map[uint64]int)
+	for _, info := range multi.infos {
+		dbs[info.DB]++
+	}
+	require.Equal(t, len(db.infos), dbs[0])
+	require.NotZero(t, dbs[1])
+}
+
+// skipAfterDummyDB skips the collections after reading n of their elements.
+type skipAfterDummyDB struct {
+	*dummyDB
+	n int
+}
+
+func (db *skipAfterDummyDB) ListEntryHandler(key string) func(string) error {
+	h := db.dummyDB.ListEntryHandler(key)
+	read := 0
+	return func(elem string) error {
+		return db.skip(&read, h(elem))
+	}
+}
+
+func (db *skipAfterDummyDB) SetEntryHandler(key string) func(string) error {
+	h := db.dummyDB.SetEntryHandler(key)
+	read := 0
+	return func(elem string) error {
+		return db.skip(&read, h(elem))
+	}
+}
+
+func (db *skipAfterDummyDB) ZsetEntryHandler(key string) func(string, float64) error {
+	h := db.dummyDB.ZsetEntryHandler(key)
+	read := 0
+	return func(elem string, score float64) error {
+		return db.skip(&read, h(elem, score))
+	}
+}
+
+func (db *skipAfterDummyDB) HashEntryHandler(key string) func(string, string) error {
+	h := db.dummyDB.HashEntryHandler(key)
+	read := 0
+	return func(field, value string) error {
+		return db.skip(&read, h(field, value))
+	}
+}
+
+func (db *skipAfterDummyDB) HashWithExpEntryHandler(key string) func(string, string, time.Time) error {
+	h := db.dummyDB.HashWithExpEntryHandler(key)
+	read := 0
+	return func(field, value string, exp time.Time) error {
+		return db.skip(&read, h(field, value, exp))
+	}
+}
+
+func (db *skipAfterDummyDB) StreamEntryHandler(key string) func(StreamEntry) error {
+	h := db.dummyDB.StreamEntryHandler(key)
+	read := 0
+	return func(entry StreamEntry) error {
+		return db.skip(&read, h(entry))
+	}
+}
+
+func (db *skipAfterDummyDB) skip(read *int, err error) error {
+	if err != nil {
+		return err
+	}
+
+	*read++
+	if *read == db.n {
+		return ErrSkipKey
+	}
+
+	return nil
+}
+
+func writeSkipTestFile(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "skip.rdb")
+
+	encoder, err := NewFileEncoder(path, version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	list, err := encoder.BeginList("list", time.Time{})
+	require.NoError(t, err)
+	for _, elem := range []string{"a", "b", "c"} {
+		require.NoError(t, list.WriteFieldStr(elem))
+	}
+	require.NoError(t, list.Close())
+
+	set, err := encoder.BeginSet("set", time.Time{})
+	require.NoError(t, err)
+	for _, elem := range []string{"a", "b", "c"} {
+		require.NoError(t, set.WriteFieldStr(elem))
+	}
+	require.NoError(t, set.Close())
+
+	zset, err := encoder.BeginSortedSet("zset", time.Time{})
+	require.NoError(t, err)
+	for i, elem := range []string{"a", "b", "c"} {
+		require.NoError(t, zset.WriteFieldStrFloat64(elem, float64(i)))
+	}
+	require.NoError(t, zset.Close())
+
+	hash, err := encoder.BeginHash("hash", time.Time{})
+	require.NoError(t, err)
+	for _, field := range []string{"a", "b", "c"} {
+		require.NoError(t, hash.WriteFieldStrStr(field, field))
+	}
+	require.NoError(t, hash.Close())
+
+	hashex, err := encoder.BeginHashWithMetadata("hashex", time.Time{})
+	require.NoError(t, err)
+	for _, field := range []string{"a", "b", "c"} {
+		require.NoError(t, hashex.WriteFieldStrStrWithExpiry(field, field, time.Now().Add(time.Hour)))
+	}
+	require.NoError(t, hashex.Close())
+
+	stream, err := encoder.BeginStream("stream", time.Time{})
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, stream.WriteEntry(StreamEntry{
+			ID:    StreamID{Millis: uint64(i)},
+			Value: []string{"a", "a"},
+		}))
+	}
+	require.NoError(t, stream.WriteMetadata(3, StreamID{Millis: 3}))
+	require.NoError(t, stream.WriteGroups(nil))
+	require.NoError(t, stream.Close())
+
+	require.NoError(t, encoder.WriteStringEntry("after", "value", time.Time{}))
+	require.NoError(t, encoder.Close())
+	return path
+}
+
+func TestFileReader_skipKey(t *testing.T) {
+	path := writeSkipTestFile(t)
+
+	all := newDummyDB()
+	err := ReadFile(path, all)
+	require.NoError(t, err)
+	require.Len(t, all.lists["list"], 3)
+	require.Len(t, all.streamEntries["stream"], 3)
+
+	db := &skipAfterDummyDB{dummyDB: newDummyDB(), n: 1}
+	err = ReadFile(path, db)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"a"}, db.lists["list"])
+	require.Equal(t, []string{"a"}, db.sets["set"])
+	require.Equal(t, map[string]float64{"a": 0}, db.zsets["zset"])
+	require.Equal(t, map[string]string{"a": "a"}, db.hashes["hash"])
+	require.Equal(t, map[string]string{"a": "a"}, db.hashes["hashex"])
+	require.Len(t, db.streamEntries["stream"], 1)
+	require.Equal(t, "value", db.strings["after"])
+
+	// the ending callbacks are not called for the skipped keys
+	require.Empty(t, db.listEntriesRead)
+	require.Empty(t, db.zsetEntriesRead)
+	require.Empty(t, db.streamEntriesRead)
+}
+
+func TestFileReader_skipKeyAllTypes(t *testing.T) {
+	expected := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), expected)
+	require.NoError(t, err)
+
+	db := &skipAfterDummyDB{dummyDB: newDummyDB(), n: 1}
+	err = ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), db)
+	require.NoError(t, err)
+
+	require.Equal(t, expected.strings, db.strings)
+	require.Equal(t, expected.lists, db.lists)
+	require.Equal(t, expected.sets, db.sets)
+	require.Equal(t, expected.zsets, db.zsets)
+	require.Equal(t, expected.hashes, db.hashes)
+	require.Equal(t, expected.streamEntries, db.streamEntries)
+}
+
+type stopDummyDB struct {
+	*dummyDB
+	stopAt string
+}
+
+func (db *stopDummyDB) HandleString(key, value string) error {
+	if key == db.stopAt {
+		return ErrStop
+	}
+
+	return db.dummyDB.HandleString(key, value)
+}
+
+func TestFileReader_stop(t *testing.T) {
+	path := writeSkipTestFile(t)
+
+	db := &stopDummyDB{dummyDB: newDummyDB(), stopAt: "after"}
+	err := ReadFile(path, db)
+	require.NoError(t, err)
+	require.Len(t, db.lists["list"], 3)
+	require.Empty(t, db.strings)
+
+	data, err := os.ReadFile(filepath.Join(dumpsPath, "all-types.rdb"))
+	require.NoError(t, err)
+
+	// the rest of the file, including the checksum, is not read
+	data[len(data)-1]++
+
+	db = &stopDummyDB{dummyDB: newDummyDB(), stopAt: "00"}
+	err = ReadReader(bytes.NewReader(data), db)
+	require.NoError(t, err)
+	require.Empty(t, db.lists)
+
+	err = ReadReader(bytes.NewReader(data), newDummyDB())
+	require.ErrorContains(t, err, "wrong CRC at the end of the RDB file")
+}
+
+func TestReadFileWithOptions_keyPattern(t *testing.T) {
+	db := newDummyDB()
+	err := ReadFileWithOptions(filepath.Join(dumpsPath, "all-types.rdb"), db, ReadOptions{
+		KeyPattern: "0[12]",
+	})
+	require.NoError(t, err)
+
+	expected := newDummyDB()
+	expected.lists["01"] = []string{"a"}
+	expected.listEntriesRead["01"] = 1
+	expected.sets["02"] = []string{"a"}
+
+	require.Equal(t, expected, db)
+}
+
+func TestReadFileWithOptions_skipAllTypes(t *testing.T) {
+	paths := []string{
+		filepath.Join(dumpsPath, "all-types.rdb"),
+		filepath.Join(dumpsPath, "stream-with-pel.rdb"),
+		filepath.Join(dumpsPath, "expiretime-sec.rdb"),
+		filepath.Join(dumpsPath, "big.rdb"),
+		writeSkipTestFile(t),
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			db := newDummyDB()
+			err := ReadFileWithOptions(path, db, ReadOptions{KeyPattern: "after"})
+			require.NoError(t, err)
+
+			expected := newDummyDB()
+			if filepath.Base(path) == "skip.rdb" {
+				expected.strings["after"] = "value"
+			}
+
+			require.Equal(t, expected, db)
+		})
+	}
+}
+
+func TestReadFileWithOptions_kinds(t *testing.T) {
+	all := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), all)
+	require.NoError(t, err)
+
+	db := newDummyDB()
+	err = ReadFileWithOptions(filepath.Join(dumpsPath, "all-types.rdb"), db, ReadOptions{
+		Kinds: []Kind{KindHash, KindStream},
+	})
+	require.NoError(t, err)
+
+	expected := newDummyDB()
+	expected.hashes = all.hashes
+	expected.streamEntries = all.streamEntries
+	expected.streamGroups = all.streamGroups
+	expected.streamEntriesRead = all.streamEntriesRead
+
+	require.Equal(t, expected, db)
+}
+
+func TestReadFileWithOptions_dbs(t *testing.T) {
+	db := newMultiDummyDB()
+	err := ReadFileWithOptions(filepath.Join(dumpsPath, "multi-db.rdb"), db, ReadOptions{
+		DBs: []uint64{1},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []uint64{1}, db.selected)
+	require.Equal(t, map[string][]uint64{"00": {1}}, db.stringDBs)
+	require.Equal(t, []string{"a"}, db.lists["01"])
+
+	// the other databases are skipped even if the partial read is not allowed
+	single := newDummyDB()
+	err = ReadFileWithOptions(filepath.Join(dumpsPath, "multi-db.rdb"), single, ReadOptions{
+		DBs: []uint64{0},
+	})
+	require.NoError(t, err)
+
+	expected := newDummyDB()
+	expected.strings["00"] = "a"
+	require.Equal(t, expected, single)
+}
+
+func TestReadReaderWithOptions(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join(dumpsPath, "all-types.rdb"))
+	require.NoError(t, err)
+
+	db := newDummyDB()
+	err = ReadReaderWithOptions(bytes.NewReader(data), db, ReadOptions{
+		KeyPattern: "1*",
+		Kinds:      []Kind{KindList},
+	})
+	require.NoError(t, err)
+
+	require.Empty(t, db.strings)
+	require.Empty(t, db.sets)
+	require.Empty(t, db.hashes)
+	require.Len(t, db.lists, 3)
+	require.Contains(t, db.lists, "10")
+	require.Contains(t, db.lists, "14")
+	require.Contains(t, db.lists, "18")
+}
+
+func TestReadFileWithOptions_skipCorruptLength(t *testing.T) {
+	tests := map[string]struct {
+		length []byte
+		err    error
+	}{
+		"above max int": {
+			length: []byte{0x81, 0x80, 0, 0, 0, 0, 0, 0, 0},
+			err:    errLengthOutOfRange,
+		},
+		"max int": {
+			length: []byte{0x81, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			err:    io.ErrUnexpectedEOF,
+		},
+		"above file length": {
+			length: []byte{0x40, 0xff},
+			err:    io.ErrUnexpectedEOF,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := []byte("REDIS0011")
+			file = append(file, byte(typeOpCodeSelectDB), 0)
+			file = append(file, byte(TypeString), 1, 'a')
+			file = append(file, test.length...)
+			file = append(file, 'b', byte(typeOpCodeEOF))
+
+			path := filepath.Join(t.TempDir(), "corrupt.rdb")
+			require.NoError(t, os.WriteFile(path, file, 0644))
+
+			opts := ReadOptions{Kinds: []Kind{KindHash}}
+			err := ReadFileWithOptions(path, newDummyDB(), opts)
+			require.ErrorIs(t, err, test.err)
+
+			err = ReadReaderWithOptions(bytes.NewReader(file), newDummyDB(), opts)
+			require.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestReadFileWithOptions_reuseBuffer(t *testing.T) {
+	paths := []string{
+		filepath.Join(dumpsPath, "all-types.rdb"),
+		filepath.Join(dumpsPath, "stream-with-pel.rdb"),
+		filepath.Join(dumpsPath, "big.rdb"),
+		writeSkipTestFile(t),
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			expected := newDummyDB()
+			err := ReadFile(path, expected)
+			require.NoError(t, err)
+
+			file, err := os.Open(path)
+			require.NoError(t, err)
+			defer file.Close()
+
+			info, err := file.Stat()
+			require.NoError(t, err)
+
+			// a small buffer, so that it is swapped many times
+			buf := newFileBackedBuffer(file, int(info.Size()), 64)
+			db := newBytesDummyDB()
+			err = readFile(context.Background(), buf, db, 0, ReadOptions{ReuseBuffer: true})
+			require.NoError(t, err)
+			require.Equal(t, expected, db.dummyDB)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			// the values of the pending entries are not read without the views
+			expected = newDummyDB()
+			err = ReadReader(bytes.NewReader(data), expected)
+			require.NoError(t, err)
+
+			db = newBytesDummyDB()
+			err = ReadReaderWithOptions(bytes.NewReader(data), db, ReadOptions{ReuseBuffer: true})
+			require.NoError(t, err)
+			require.Equal(t, expected, db.dummyDB)
+		})
+	}
+}
+
+func TestReadFileContext(t *testing.T) {
+	info, err := os.Stat(allTypesRDBPath)
+	require.NoError(t, err)
+
+	expected := newDummyDB()
+	require.NoError(t, ReadFile(allTypesRDBPath, expected))
+
+	var progress []Progress
+	db := newDummyDB()
+	err = ReadFileContext(context.Background(), allTypesRDBPath, db, ReadOptions{
+		Progress: func(p Progress) {
+			progress = append(progress, p)
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, db)
+
+	require.NotEmpty(t, progress)
+	for i, p := range progress {
+		require.Equal(t, info.Size(), p.TotalBytes)
+		if i > 0 {
+			require.Greater(t, p.BytesRead, progress[i-1].BytesRead)
+			require.GreaterOrEqual(t, p.Keys, progress[i-1].Keys)
+		}
+	}
+
+	last := progress[len(progress)-1]
+	require.Equal(t, info.Size(), last.BytesRead)
+	require.Equal(t, uint64(len(progress)-1), last.Keys)
+}
+
+func TestReadFileContext_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ReadFileContext(ctx, allTypesRDBPath, newDummyDB(), ReadOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	db := newDummyDB()
+	err = ReadFileContext(ctx, allTypesRDBPath, db, ReadOptions{
+		Progress: func(p Progress) {
+			if p.Keys == 3 {
+				cancel()
+			}
+		},
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, map[string]string{"00": db.strings["00"]}, db.strings)
+	require.Len(t, db.lists, 1)
+	require.Len(t, db.sets, 1)
+}
+
+func TestReadReaderContext(t *testing.T) {
+	data, err := os.ReadFile(allTypesRDBPath)
+	require.NoError(t, err)
+
+	var last Progress
+	err = ReadReaderContext(context.Background(), bytes.NewReader(data), newDummyDB(), ReadOptions{
+		Progress: func(p Progress) {
+			last = p
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), last.BytesRead)
+	require.Zero(t, last.TotalBytes)
+	require.NotZero(t, last.Keys)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = ReadReaderContext(ctx, bytes.NewReader(data), newDummyDB(), ReadOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReadFile_parseError(t *testing.T) {
+	value, err := os.ReadFile(filepath.Join(valueDumpsPath, "list-quicklist2-big.bin"))
+	require.NoError(t, err)
+
+	// the encoding of the 17th entry of the first listpack, which is
+	// replaced with the end of the listpack. the value has the form
+	// <type><len><container><listpack-len><lpbytes><lplen><lpentry>...
+	value[11+17*3] = listpackEnd
+
+	file := []byte("REDIS0011")
+	file = append(file, byte(typeOpCodeSelectDB), 0)
+	file = append(file, value[0], 4, 'l', 'i', 's', 't')
+	file = append(file, value[1:len(value)-10]...)
+	file = append(file, byte(typeOpCodeEOF))
+
+	path := filepath.Join(t.TempDir(), "corrupt.rdb")
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	err = ReadFile(path, newDummyDB())
+	require.ErrorIs(t, err, errLPUnexpectedEnd)
+
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	require.Equal(t, ParseError{
+		// after the key and the first listpack
+		Offset:  int64(len("REDIS0011") + 2 + 6 + 4 + 0x15b5),
+		DB:      0,
+		InEntry: true,
+		Key:     "list",
+		Type:    TypeListQuicklist2,
+		Context: "quicklist node 0 / listpack entry 17",
+		Err:     errLPUnexpectedEnd,
+	}, *parseErr)
+	require.Equal(t, `unexpected end of listpack (offset: 5578, db: 0, key: "list", type: 18, at: quicklist node 0 / listpack entry 17)`, err.Error())
+}
+
+func TestReadFile_parseErrorUnknownType(t *testing.T) {
+	file := []byte("REDIS0011")
+	file = append(file, byte(typeOpCodeSelectDB), 3, 100)
+
+	path := filepath.Join(t.TempDir(), "unknown.rdb")
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	db := newDummyDB()
+	db.partialRead = true
+	err := ReadFile(path, db)
+
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	require.Equal(t, int64(len(file)), parseErr.Offset)
+	require.Equal(t, uint64(3), parseErr.DB)
+	require.True(t, parseErr.InEntry)
+	require.Equal(t, Type(100), parseErr.Type)
+	require.Empty(t, parseErr.Key)
+	require.Empty(t, parseErr.Context)
+	require.ErrorContains(t, err, "unknown RDB encoding type 100")
+}
+
+// stringErrorDummyDB returns the error for the strings.
+type stringErrorDummyDB struct {
+	*dummyDB
+	err error
+}
+
+func (db *stringErrorDummyDB) HandleString(key, value string) error {
+	return db.err
+}
+
+func TestReadFile_parseErrorHandler(t *testing.T) {
+	errHandler := errors.New("handler error")
+	err := ReadFile(allTypesRDBPath, &stringErrorDummyDB{dummyDB: newDummyDB(), err: errHandler})
+	require.ErrorIs(t, err, errHandler)
+
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	require.True(t, parseErr.InEntry)
+	require.Equal(t, "00", parseErr.Key)
+	require.Equal(t, TypeString, parseErr.Type)
+}
+
+type rawValueDummyDB struct {
+	*dummyDB
+	values map[string][]byte
+}
+
+func (db *rawValueDummyDB) HandleRawValue(key string, value []byte) error {
+	db.values[key] = value
+	return nil
+}
+
+func TestFileReader_rawValue(t *testing.T) {
+	expected := newDummyDB()
+	err := ReadFile(allTypesRDBPath, expected)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(allTypesRDBPath)
+	require.NoError(t, err)
+
+	read := map[string]func(h FileHandler) error{
+		"file": func(h FileHandler) error {
+			return ReadFile(allTypesRDBPath, h)
+		},
+		"reader": func(h FileHandler) error {
+			return ReadReader(bytes.NewReader(data), h)
+		},
+	}
+
+	for name, fn := range read {
+		t.Run(name, func(t *testing.T) {
+			db := &rawValueDummyDB{dummyDB: newDummyDB(), values: make(map[string][]byte)}
+			err := fn(db)
+			require.NoError(t, err)
+
+			// no values are decoded
+			require.Equal(t, newDummyDB(), db.dummyDB)
+			require.Len(t, db.values, 20)
+			require.Equal(t, []byte{byte(TypeString), 1, 'a'}, db.values["00"])
+
+			restored := newDummyDB()
+			for key, value := range db.values {
+				err = ReadValue(key, DumpPayload(value, Version), restored)
+				require.NoError(t, err, key)
+			}
+			require.Equal(t, expected, restored)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package rdb
+
+// matchGlob reports whether the string matches the glob-style pattern, with
+// the same semantics as the KEYS and SCAN commands of Redis:
+// - * matches any sequence of characters, including the empty one
+// - ? matches a single character
+// - [abc] matches one of the characters in the brackets, [^abc] matches one
+// of the characters not in the brackets, and [a-z] matches a range of characters
+// - \ escapes the next character, so that it is matched literally
+func matchGlob(pattern, str string) bool {
+	p, s := 0, 0
+	// position of the last * in the pattern, and the position
+	// in the string it is matched until, for backtracking.
+	star, starS := -1, 0
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				// consecutive stars are the same as a single one
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true
+				}
+
+				star, starS = p, s
+				continue
+			case '?':
+				p++
+				s++
+				continue
+			case '[':
+				next, ok := matchGlobClass(pattern, p, str[s])
+				if ok {
+					p = next
+					s++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) {
+					if pattern[p+1] == str[s] {
+						p += 2
+						s++
+						continue
+					}
+					break
+				}
+				fallthrough
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+
+		// the last star consumes one more character
+		if star < 0 {
+			return false
+		}
+
+		starS++
+		p, s = star, starS
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchGlobClass matches the character against the bracket expression
+// starting at the position p of the pattern, and returns the position
+// after the expression.
+func matchGlobClass(pattern string, p int, c byte) (int, bool) {
+	p++ // skip [
+	not := p < len(pattern) && pattern[p] == '^'
+	if not {
+		p++
+	}
+
+	match := false
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			if pattern[p] == c {
+				match = true
+			}
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			start, end := pattern[p], pattern[p+2]
+			if start > end {
+				start, end = end, start
+			}
+			if c >= start && c <= end {
+				match = true
+			}
+			p += 2
+		case pattern[p] == c:
+			match = true
+		}
+		p++
+	}
+
+	// an unterminated class is matched until the end of the pattern
+	if p < len(pattern) {
+		p++ // skip ]
+	}
+
+	return p, match != not
+}
@@ -0,0 +1,45 @@
+package rdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{pattern: "*", str: "", match: true},
+		{pattern: "*", str: "anything", match: true},
+		{pattern: "", str: "", match: true},
+		{pattern: "", str: "a", match: false},
+		{pattern: "user:*", str: "user:1", match: true},
+		{pattern: "user:*", str: "users:1", match: false},
+		{pattern: "*:1", str: "user:1", match: true},
+		{pattern: "*:*:*", str: "a:b:c", match: true},
+		{pattern: "*:*:*", str: "a:b", match: false},
+		{pattern: "a**b", str: "ab", match: true},
+		{pattern: "h?llo", str: "hello", match: true},
+		{pattern: "h?llo", str: "hllo", match: false},
+		{pattern: "h[ae]llo", str: "hallo", match: true},
+		{pattern: "h[ae]llo", str: "hillo", match: false},
+		{pattern: "h[^e]llo", str: "hallo", match: true},
+		{pattern: "h[^e]llo", str: "hello", match: false},
+		{pattern: "h[a-b]llo", str: "hbllo", match: true},
+		{pattern: "h[b-a]llo", str: "hbllo", match: true},
+		{pattern: "h[a-b]llo", str: "hcllo", match: false},
+		{pattern: "h[\\]]llo", str: "h]llo", match: true},
+		{pattern: "h\\*llo", str: "h*llo", match: true},
+		{pattern: "h\\*llo", str: "hello", match: false},
+		{pattern: "*llo", str: "hellollo", match: true},
+		{pattern: "*[0-9]", str: "key9", match: true},
+		{pattern: "*[0-9]", str: "key", match: false},
+	}
+
+	for _, tc := range tests {
+		require.Equal(t, tc.match, matchGlob(tc.pattern, tc.str), "%q %q", tc.pattern, tc.str)
+	}
+}
@@ -1,6 +1,20 @@
 package rdb
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrSkipKey can be returned from the handler methods to skip the rest of the
+// value being read. The remaining elements of the collection are skipped without
+// being decoded, where the encoding allows it, and the ending callbacks of the
+// value are not called. Reading continues with the next entry.
+var ErrSkipKey = errors.New("skip key")
+
+// ErrStop can be returned from the handler methods to stop reading, in which
+// case ReadFile returns without an error. The rest of the file, including its
+// checksum, is not read.
+var ErrStop = errors.New("stop reading")
 
 // ValueHandler is used to handle RDB objects while reading a file.
 type ValueHandler interface {
@@ -60,80 +74,253 @@ type FileHandler interface {
 	HandleLibrary(code string) error
 }
 
-// nopHandler is used to ignore the RDB objects read so that
-// the file can be read while skipping the values we don't need
-// to read.
-type nopHandler struct {
+// DBHandler is an optional extension of the FileHandler. When the handler passed
+// to ReadFile implements it, entries of all the databases in the file are passed
+// to the handler, instead of only the entries of the database 0.
+type DBHandler interface {
+	FileHandler
+
+	// called when a database is selected, before the entries of
+	// that database are passed to the handler.
+	HandleSelectDB(dbnum uint64) error
 }
 
-func (nopHandler) AllowPartialRead() bool {
-	return true
+// AuxHandler is an optional extension of the FileHandler. When the handler passed
+// to ReadFile implements it, the auxiliary metadata fields of the file, such as
+// redis-ver, ctime, or repl-offset, are passed to the handler in the order they
+// appear in the file.
+type AuxHandler interface {
+	FileHandler
+
+	// called when an auxiliary field is read, with its key and value.
+	HandleAux(key, value string) error
+}
+
+// EvictionHandler is an optional extension of the FileHandler. When the handler
+// passed to ReadFile implements it, the eviction metadata written for the keys
+// by the servers configured with an LFU or LRU "maxmemory-policy" is passed to
+// the handler, before the value of the key.
+type EvictionHandler interface {
+	FileHandler
+
+	// called with the LFU frequency counter of the key.
+	HandleFreq(key string, freq uint8)
+
+	// called with the LRU idle time of the key, which has a precision of seconds.
+	HandleIdle(key string, idle time.Duration)
+}
+
+// ModuleAuxHandler is an optional extension of the FileHandler. When the handler
+// passed to ReadFile implements it, the auxiliary data of the modules, which is
+// skipped otherwise, is decoded and passed to the handler.
+type ModuleAuxHandler interface {
+	FileHandler
+
+	// called when the auxiliary data of a module is read.
+	HandleModuleAux(aux ModuleAux) error
+}
+
+// KeyInfo is the metadata of an entry in the RDB file.
+type KeyInfo struct {
+	// DB is the number of the database the key belongs to.
+	DB uint64
+	// Key is the name of the key.
+	Key string
+	// Type is the type of the value, which describes its encoding in the file.
+	Type Type
+	// Offset is the offset of the first byte of the entry in the file,
+	// including its optional expiration and eviction metadata.
+	Offset int64
+	// Size is the number of bytes the entry occupies in the file.
+	Size int64
+	// ExpireTime is the expiration time of the key, or the zero time
+	// if the key does not expire.
+	ExpireTime time.Time
+}
+
+// KeyInfoHandler is an optional extension of the FileHandler. When the handler
+// passed to ReadFile implements it, the metadata of each entry is passed to the
+// handler, after the value of the entry is passed.
+type KeyInfoHandler interface {
+	FileHandler
+
+	// called after an entry is read, with its metadata.
+	HandleKeyInfo(info KeyInfo) error
+}
+
+// RawValueHandler is an optional extension of the FileHandler. When the handler
+// passed to ReadFile implements it, the values of the entries are not decoded,
+// and the serialized bytes of each value are passed to it instead, without
+// calling the rest of the ValueHandler methods for the value. The bytes have the
+// form of <type><value>, with the encoding the value has in the file, and they
+// can be turned into the payloads of the DUMP command with DumpPayload.
+type RawValueHandler interface {
+	FileHandler
+
+	// called when a value is read for the key, with its serialized bytes, which
+	// are owned by the handler. Returning ErrSkipKey from it has no effect,
+	// as the value is already read.
+	HandleRawValue(key string, value []byte) error
+}
+
+// LifecycleHandler is an optional extension of the ValueHandler. When the handler
+// passed to ReadFile or ReadValue implements it, it is notified before and after
+// each value is read, regardless of its type, so that it has a reliable point to
+// prepare for or to flush the value.
+type LifecycleHandler interface {
+	ValueHandler
+
+	// called before the first element of the value is passed to the handler, with
+	// the type of the value and the number of elements declared by its encoding, or
+	// UnknownLength if the encoding does not declare it up front, as the quicklists
+	// and the streams. Strings and modules have a single element.
+	HandleBegin(key string, t Type, length int64) error
+
+	// called after all the elements of the value are passed to the handler, with
+	// the number of elements read. For streams, it is the number of stream entries.
+	// It is called for the values skipped with ErrSkipKey as well, with the number
+	// of elements read until the value is skipped, including the one the handler
+	// skipped it at, so that each HandleBegin is followed by a HandleEnd unless
+	// reading fails or stops.
+	HandleEnd(key string, t Type, entriesRead uint64) error
+}
+
+// BaseHandler is a FileHandler that ignores the RDB objects read. It can be
+// embedded in the handlers to implement only the methods they need.
+// Partial reads are not allowed by default, so that the unsupported
+// parts of the files are not skipped silently.
+type BaseHandler struct {
+}
+
+func (BaseHandler) AllowPartialRead() bool {
+	return false
 }
 
-func (nopHandler) RequireStrictEOF() bool {
+func (BaseHandler) RequireStrictEOF() bool {
 	return false
 }
 
-func (nopHandler) HandleString(key, value string) error {
+func (BaseHandler) HandleString(key, value string) error {
 	return nil
 }
 
-func (nopHandler) ListEntryHandler(key string) func(elem string) error {
+func (BaseHandler) ListEntryHandler(key string) func(elem string) error {
 	return func(elem string) error {
 		return nil
 	}
 }
 
-func (nopHandler) HandleListEnding(key string, entriesRead uint64) {
+func (BaseHandler) HandleListEnding(key string, entriesRead uint64) {
 }
 
-func (nopHandler) SetEntryHandler(key string) func(elem string) error {
+func (BaseHandler) SetEntryHandler(key string) func(elem string) error {
 	return func(elem string) error {
 		return nil
 	}
 }
 
-func (nopHandler) ZsetEntryHandler(key string) func(elem string, score float64) error {
+func (BaseHandler) ZsetEntryHandler(key string) func(elem string, score float64) error {
 	return func(elem string, score float64) error {
 		return nil
 	}
 }
 
-func (nopHandler) HandleZsetEnding(key string, entriesRead uint64) {
+func (BaseHandler) HandleZsetEnding(key string, entriesRead uint64) {
 }
 
-func (nopHandler) HashEntryHandler(key string) func(field, value string) error {
+func (BaseHandler) HashEntryHandler(key string) func(field, value string) error {
 	return func(field, value string) error {
 		return nil
 	}
 }
 
-func (nopHandler) HandleModule(key, value string, marker ModuleMarker) error {
+func (BaseHandler) HandleModule(key, value string, marker ModuleMarker) error {
 	return nil
 }
 
-func (nopHandler) StreamEntryHandler(key string) func(entry StreamEntry) error {
+func (BaseHandler) StreamEntryHandler(key string) func(entry StreamEntry) error {
 	return func(entry StreamEntry) error {
 		return nil
 	}
 }
 
-func (nopHandler) StreamGroupHandler(key string) func(group StreamConsumerGroup) error {
+func (BaseHandler) StreamGroupHandler(key string) func(group StreamConsumerGroup) error {
 	return func(group StreamConsumerGroup) error {
 		return nil
 	}
 }
 
-func (nopHandler) HandleStreamEnding(key string, entriesRead uint64) {
+func (BaseHandler) HandleStreamEnding(key string, entriesRead uint64) {
 }
 
-func (nopHandler) HandleExpireTime(key string, expireTime time.Duration) {
+func (BaseHandler) HandleExpireTime(key string, expireTime time.Duration) {
 }
 
-func (h nopHandler) HashWithExpEntryHandler(key string) func(field string, value string, ttl time.Time) error {
-	return nil
+func (BaseHandler) HashWithExpEntryHandler(key string) func(field string, value string, ttl time.Time) error {
+	return func(field string, value string, ttl time.Time) error {
+		return nil
+	}
 }
 
-func (nopHandler) HandleLibrary(code string) error {
+func (BaseHandler) HandleLibrary(code string) error {
 	return nil
 }
+
+// nopHandler is used to ignore the RDB objects read so that
+// the file can be read while skipping the values we don't need
+// to read.
+type nopHandler struct {
+	BaseHandler
+}
+
+func (nopHandler) AllowPartialRead() bool {
+	return true
+}
+
+// IntEntryHandler is an optional extension of the ValueHandler. When the handler
+// passed to ReadFile or ReadValue implements it, the elements of the lists and the
+// sets are passed to the functions returned from its methods, instead of the ones
+// returned from the ListEntryHandler and the SetEntryHandler. The elements stored
+// as integers by the intsets, the ziplists, and the listpacks are passed as int64,
+// with the isInt flag set and an empty elem, without being converted to strings.
+// The rest of the elements are passed as strings, with the isInt flag unset.
+type IntEntryHandler interface {
+	ValueHandler
+
+	// returned function is called for the each enty read for the list key.
+	ListIntEntryHandler(key string) func(elem string, intVal int64, isInt bool) error
+
+	// returned function is called for the each enty read for the set key.
+	SetIntEntryHandler(key string) func(elem string, intVal int64, isInt bool) error
+}
+
+// BytesHandler is an optional extension of the ValueHandler. When the handler
+// passed to ReadFile or ReadValue implements it, the values of the strings and
+// the elements of the lists, sets, sorted sets, and hashes are passed to it as
+// byte slices, instead of the strings passed to the corresponding ValueHandler
+// methods, which are not called. The IntEntryHandler takes precedence over it
+// for the elements of the lists and the sets.
+//
+// The byte slices are not copied from the buffers the file is read into, so
+// they must not be modified. They stay valid as long as they are referenced,
+// unless ReadOptions.ReuseBuffer is set, in which case they are valid only
+// until the next entry of the file is read.
+type BytesHandler interface {
+	ValueHandler
+
+	// called when a string value is read for the key.
+	HandleStringBytes(key string, value []byte) error
+
+	// returned function is called for the each enty read for the list key.
+	ListEntryBytesHandler(key string) func(elem []byte) error
+
+	// returned function is called for the each enty read for the set key.
+	SetEntryBytesHandler(key string) func(elem []byte) error
+
+	// returned function is called for the each enty read for the zset key.
+	ZsetEntryBytesHandler(key string) func(elem []byte, score float64) error
+
+	// returned function is called for the each enty read for the hash key,
+	// with the zero ttl if the field does not have an expiration time.
+	HashEntryBytesHandler(key string) func(field, value []byte, ttl time.Time) error
+}
@@ -0,0 +1,272 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stringCounter struct {
+	BaseHandler
+	count int
+}
+
+func (c *stringCounter) HandleString(key, value string) error {
+	c.count++
+	return nil
+}
+
+func TestBaseHandler(t *testing.T) {
+	c := &stringCounter{}
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), c)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.count)
+
+	err = ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), c)
+	require.ErrorContains(t, err, "multiple databases are not supported when the partial restore is not allowed")
+}
+
+func TestBaseHandler_hashWithMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hash-metadata.rdb")
+
+	encoder, err := NewFileEncoder(path, version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	hashEncoder, err := encoder.BeginHashWithMetadata("hash", time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, hashEncoder.WriteFieldStrStrWithExpiry("a", "1", time.Now().Add(time.Hour)))
+	require.NoError(t, hashEncoder.Close())
+	require.NoError(t, encoder.Close())
+
+	err = ReadFile(path, &stringCounter{})
+	require.NoError(t, err)
+}
+
+type intDummyDB struct {
+	*dummyDB
+	ints map[string][]int64
+}
+
+func newIntDummyDB() *intDummyDB {
+	return &intDummyDB{
+		dummyDB: newDummyDB(),
+		ints:    make(map[string][]int64),
+	}
+}
+
+func (db *intDummyDB) ListIntEntryHandler(key string) func(string, int64, bool) error {
+	return db.intEntryHandler(key, db.dummyDB.ListEntryHandler(key))
+}
+
+func (db *intDummyDB) SetIntEntryHandler(key string) func(string, int64, bool) error {
+	return db.intEntryHandler(key, db.dummyDB.SetEntryHandler(key))
+}
+
+func (db *intDummyDB) intEntryHandler(key string, cb func(string) error) func(string, int64, bool) error {
+	return func(elem string, intVal int64, isInt bool) error {
+		if isInt {
+			if elem != "" {
+				return fmt.Errorf("unexpected elem %q for the integer %d", elem, intVal)
+			}
+
+			db.ints[key] = append(db.ints[key], intVal)
+			elem = strconv.FormatInt(intVal, 10)
+		}
+
+		return cb(elem)
+	}
+}
+
+func TestIntEntryHandler(t *testing.T) {
+	tests := map[string][]int64{
+		"set-intset-int16.bin":      {-12342, -42, 0, 42, 2323},
+		"set-intset-int64.bin":      {-14234167290, -2323232323, 4294967296, 4444444444},
+		"set-listpack.bin":          {23343423, -42},
+		"list-ziplist-small.bin":    {3147483648, -9388608, 40422, -12345, 13, 100, 12, 0, -1},
+		"list-quicklist-small.bin":  nil,
+		"list-quicklist2-small.bin": nil,
+		"list.bin":                  nil,
+		"set.bin":                   nil,
+		"list-quicklist2-big.bin":   nil,
+		"list-quicklist-big.bin":    nil,
+	}
+
+	for file, ints := range tests {
+		t.Run(file, func(t *testing.T) {
+			payload, err := os.ReadFile(filepath.Join(valueDumpsPath, file))
+			require.NoError(t, err)
+
+			expected := newDummyDB()
+			err = ReadValue("key", payload, expected)
+			require.NoError(t, err)
+
+			db := newIntDummyDB()
+			err = ReadValue("key", payload, db)
+			require.NoError(t, err)
+
+			// the same elements are read, in the same order
+			require.Equal(t, expected, db.dummyDB)
+			if ints != nil {
+				require.ElementsMatch(t, ints, db.ints["key"])
+			}
+		})
+	}
+}
+
+func TestIntEntryHandler_multiHandler(t *testing.T) {
+	payload, err := os.ReadFile(filepath.Join(valueDumpsPath, "set-intset-int32.bin"))
+	require.NoError(t, err)
+
+	intDB := newIntDummyDB()
+	db := newDummyDB()
+	err = ReadValue("key", payload, NewMultiHandler(intDB, db))
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []int64{-424242, 191919, 42000, -1234567}, intDB.ints["key"])
+	require.ElementsMatch(t, []string{"-424242", "191919", "42000", "-1234567"}, db.sets["key"])
+	require.Equal(t, db, intDB.dummyDB)
+}
+
+// bytesDummyDB is a BytesHandler that copies everything it receives,
+// so that it can be used when the buffers are reused.
+type bytesDummyDB struct {
+	*dummyDB
+}
+
+func newBytesDummyDB() *bytesDummyDB {
+	return &bytesDummyDB{dummyDB: newDummyDB()}
+}
+
+func (db *bytesDummyDB) HandleStringBytes(key string, value []byte) error {
+	return db.dummyDB.HandleString(strings.Clone(key), string(value))
+}
+
+func (db *bytesDummyDB) HandleString(key, value string) error {
+	return errors.New("unexpected string value")
+}
+
+func (db *bytesDummyDB) ListEntryBytesHandler(key string) func([]byte) error {
+	cb := db.dummyDB.ListEntryHandler(strings.Clone(key))
+	return func(elem []byte) error {
+		return cb(string(elem))
+	}
+}
+
+func (db *bytesDummyDB) SetEntryBytesHandler(key string) func([]byte) error {
+	cb := db.dummyDB.SetEntryHandler(strings.Clone(key))
+	return func(elem []byte) error {
+		return cb(string(elem))
+	}
+}
+
+func (db *bytesDummyDB) ZsetEntryBytesHandler(key string) func([]byte, float64) error {
+	cb := db.dummyDB.ZsetEntryHandler(strings.Clone(key))
+	return func(elem []byte, score float64) error {
+		return cb(string(elem), score)
+	}
+}
+
+func (db *bytesDummyDB) HashEntryBytesHandler(key string) func([]byte, []byte, time.Time) error {
+	cb := db.dummyDB.HashWithExpEntryHandler(strings.Clone(key))
+	return func(field, value []byte, ttl time.Time) error {
+		return cb(string(field), string(value), ttl)
+	}
+}
+
+func (db *bytesDummyDB) HandleListEnding(key string, entriesRead uint64) {
+	db.dummyDB.HandleListEnding(strings.Clone(key), entriesRead)
+}
+
+func (db *bytesDummyDB) HandleZsetEnding(key string, entriesRead uint64) {
+	db.dummyDB.HandleZsetEnding(strings.Clone(key), entriesRead)
+}
+
+func (db *bytesDummyDB) HandleModule(key, value string, marker ModuleMarker) error {
+	return db.dummyDB.HandleModule(strings.Clone(key), strings.Clone(value), marker)
+}
+
+func (db *bytesDummyDB) StreamEntryHandler(key string) func(StreamEntry) error {
+	cb := db.dummyDB.StreamEntryHandler(strings.Clone(key))
+	return func(entry StreamEntry) error {
+		entry.Value = slices.Clone(entry.Value)
+		for i, v := range entry.Value {
+			entry.Value[i] = strings.Clone(v)
+		}
+
+		return cb(entry)
+	}
+}
+
+func (db *bytesDummyDB) StreamGroupHandler(key string) func(StreamConsumerGroup) error {
+	cb := db.dummyDB.StreamGroupHandler(strings.Clone(key))
+	return func(group StreamConsumerGroup) error {
+		group.Name = strings.Clone(group.Name)
+		group.Consumers = slices.Clone(group.Consumers)
+		for i := range group.Consumers {
+			consumer := &group.Consumers[i]
+			consumer.Name = strings.Clone(consumer.Name)
+			consumer.PendingEntries = slices.Clone(consumer.PendingEntries)
+			for j, pending := range consumer.PendingEntries {
+				clone := *pending
+				clone.Entry.Value = slices.Clone(clone.Entry.Value)
+				for k, v := range clone.Entry.Value {
+					clone.Entry.Value[k] = strings.Clone(v)
+				}
+				consumer.PendingEntries[j] = &clone
+			}
+		}
+
+		return cb(group)
+	}
+}
+
+func (db *bytesDummyDB) HandleStreamEnding(key string, entriesRead uint64) {
+	db.dummyDB.HandleStreamEnding(strings.Clone(key), entriesRead)
+}
+
+func (db *bytesDummyDB) HandleExpireTime(key string, expireTime time.Duration) {
+	db.dummyDB.HandleExpireTime(strings.Clone(key), expireTime)
+}
+
+func (db *bytesDummyDB) HandleLibrary(code string) error {
+	return db.dummyDB.HandleLibrary(strings.Clone(code))
+}
+
+func TestBytesHandler(t *testing.T) {
+	for _, name := range []string{"all-types.rdb", "stream-with-pel.rdb", "expiretime-sec.rdb"} {
+		t.Run(name, func(t *testing.T) {
+			expected := newDummyDB()
+			err := ReadFile(filepath.Join(dumpsPath, name), expected)
+			require.NoError(t, err)
+
+			db := newBytesDummyDB()
+			err = ReadFile(filepath.Join(dumpsPath, name), db)
+			require.NoError(t, err)
+
+			require.Equal(t, expected, db.dummyDB)
+		})
+	}
+}
+
+func TestBytesHandler_multiHandler(t *testing.T) {
+	expected := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), expected)
+	require.NoError(t, err)
+
+	bytesDB := newBytesDummyDB()
+	db := newDummyDB()
+	err = ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), NewMultiHandler(bytesDB, db))
+	require.NoError(t, err)
+
+	require.Equal(t, expected, bytesDB.dummyDB)
+	require.Equal(t, expected, db)
+}
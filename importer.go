@@ -0,0 +1,399 @@
+package rdb
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultImportConcurrency  = 4
+	defaultImportBatchSize    = 100
+	defaultImportRetryBackoff = 100 * time.Millisecond
+	defaultMaxPayloadSize     = 512 << 20 // 512 MB, the proto-max-bulk-len of Redis
+)
+
+// ImportOptions configures the import of an RDB file into a server.
+type ImportOptions struct {
+	// Username and Password are sent with the AUTH command, if the Password is set.
+	Username string
+	Password string
+	// TLSConfig is used to establish TLS connections to the server, if set.
+	TLSConfig *tls.Config
+	// Concurrency is the number of connections the batches are sent over in
+	// parallel. Defaults to 4.
+	Concurrency int
+	// BatchSize is the number of RESTORE commands pipelined in a single batch.
+	// Defaults to 100.
+	BatchSize int
+	// MaxRetries is the number of times a batch is sent again over a new
+	// connection, when the connection fails. The error replies of the server
+	// are not retried. Zero disables the retries.
+	MaxRetries int
+	// RetryBackoff is the duration waited before each retry. Defaults to 100ms.
+	RetryBackoff time.Duration
+	// RDBVersion is the version written to the DUMP payloads. Servers reject
+	// the payloads with a version newer than the one they support. Defaults to
+	// the latest version supported by this library.
+	RDBVersion uint16
+	// MaxPayloadSize is the maximum size of a single DUMP payload.
+	// Defaults to 512 MB.
+	MaxPayloadSize int
+}
+
+// ImportFile reads the RDB file in the given path, and restores its entries
+// into the Redis-compatible server in the given address. See ImportReader.
+func ImportFile(ctx context.Context, addr string, path string, opts ImportOptions) error {
+	return importWith(ctx, addr, opts, func(h FileHandler) error {
+		return ReadFile(path, h)
+	})
+}
+
+// ImportReader reads the RDB file from the given reader, and restores its
+// entries into the Redis-compatible server in the given address.
+//
+// Each entry is serialized as a DUMP payload, and sent with the
+// RESTORE key ttl payload REPLACE ABSTTL command, so that the existing keys
+// are overwritten and the expiration times are kept. The entries of all the
+// databases are restored into the databases with the same numbers, and the
+// functions are loaded with the FUNCTION LOAD REPLACE command.
+//
+// Since the stream metadata is not passed to the handlers, the last id of
+// the restored streams is the greatest id of their entries and consumer
+// groups, and their length is the number of their entries. The streams are
+// written in the first stream format, which does not have the entries read
+// counter of the consumer groups and the active time of the consumers.
+func ImportReader(ctx context.Context, addr string, r io.Reader, opts ImportOptions) error {
+	return importWith(ctx, addr, opts, func(h FileHandler) error {
+		return ReadReader(r, h)
+	})
+}
+
+func importWith(ctx context.Context, addr string, opts ImportOptions, read func(h FileHandler) error) error {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultImportConcurrency
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultImportRetryBackoff
+	}
+
+	if opts.RDBVersion == 0 {
+		opts.RDBVersion = Version
+	}
+
+	if opts.MaxPayloadSize <= 0 {
+		opts.MaxPayloadSize = defaultMaxPayloadSize
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	h := newImporter(ctx, opts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := h.work(ctx, addr)
+			if err != nil {
+				cancel(err)
+			}
+		}()
+	}
+
+	err := read(NewValueAdapter(h, ValueAdapterOptions{}))
+	if err == nil {
+		err = h.finish()
+	}
+
+	close(h.batches)
+	if err != nil {
+		cancel(err)
+	}
+
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// importCommand is a command sent to the server while importing.
+type importCommand struct {
+	// db is the database the command is sent to, which is
+	// negative for the commands that are not bound to a database.
+	db   int
+	args []string
+}
+
+func (c importCommand) describe() string {
+	switch c.args[0] {
+	case "SELECT":
+		return "select the database " + c.args[1]
+	case "RESTORE":
+		return fmt.Sprintf("restore the key %q", c.args[1])
+	default:
+		return "load the function"
+	}
+}
+
+// importer is a WholeValueHandler that serializes the values passed to it by
+// the ValueAdapter as DUMP payloads, and passes them to the workers in batches
+// of RESTORE commands.
+type importer struct {
+	BaseHandler
+	ctx     context.Context
+	opts    ImportOptions
+	writer  *Writer
+	batches chan []importCommand
+	batch   []importCommand
+	db      int
+	err     error
+}
+
+func newImporter(ctx context.Context, opts ImportOptions) *importer {
+	writer := NewWriter()
+	writer.limit = opts.MaxPayloadSize
+	return &importer{
+		ctx:     ctx,
+		opts:    opts,
+		writer:  writer,
+		batches: make(chan []importCommand, opts.Concurrency),
+	}
+}
+
+func (h *importer) HandleSelectDB(dbnum uint64) error {
+	h.db = int(dbnum)
+	return h.err
+}
+
+func (h *importer) HandleValue(key string, value Value, info KeyInfo) error {
+	payload, err := h.payload(value)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the key %q: %w", key, err)
+	}
+
+	ttl := "0"
+	if !info.ExpireTime.IsZero() {
+		ttl = strconv.FormatInt(info.ExpireTime.UnixMilli(), 10)
+	}
+
+	h.add(importCommand{
+		db:   h.db,
+		args: []string{"RESTORE", key, ttl, payload, "REPLACE", "ABSTTL"},
+	})
+	return h.err
+}
+
+func (h *importer) HandleModule(key, value string, marker ModuleMarker) error {
+	// the JSON values are passed to HandleValue
+	return fmt.Errorf("cannot import the module value of the key %q", key)
+}
+
+func (h *importer) HandleLibrary(code string) error {
+	h.add(importCommand{
+		db:   -1,
+		args: []string{"FUNCTION", "LOAD", "REPLACE", code},
+	})
+	return h.err
+}
+
+func (h *importer) payload(value Value) (string, error) {
+	w := h.writer
+	w.pos = 0
+
+	err := writeValue(w, value)
+	if err != nil {
+		return "", err
+	}
+
+	err = w.WriteChecksum(h.opts.RDBVersion)
+	if err != nil {
+		return "", err
+	}
+
+	return string(w.GetBuffer()), nil
+}
+
+// add adds the command to the current batch, and passes
+// the batch to the workers when it is full.
+func (h *importer) add(cmd importCommand) {
+	h.batch = append(h.batch, cmd)
+	if len(h.batch) < h.opts.BatchSize {
+		return
+	}
+
+	h.send()
+}
+
+func (h *importer) send() {
+	if len(h.batch) == 0 {
+		return
+	}
+
+	select {
+	case h.batches <- h.batch:
+		h.batch = nil
+	case <-h.ctx.Done():
+		h.err = context.Cause(h.ctx)
+	}
+}
+
+// finish passes the remaining entries to the workers.
+func (h *importer) finish() error {
+	if h.err == nil {
+		h.send()
+	}
+
+	return h.err
+}
+
+// work sends the batches to the server over a single connection,
+// until there are no more batches or the context is done.
+func (h *importer) work(ctx context.Context, addr string) error {
+	var conn *importConn
+	defer func() {
+		if conn != nil {
+			conn.close()
+		}
+	}()
+
+	for batch := range h.batches {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		var err error
+		for attempt := 0; ; attempt++ {
+			if conn == nil {
+				conn, err = dialImportConn(ctx, addr, h.opts)
+			}
+
+			if err == nil {
+				err = conn.send(batch)
+			}
+
+			var respErr RESPError
+			if err == nil || errors.As(err, &respErr) || ctx.Err() != nil || attempt >= h.opts.MaxRetries {
+				break
+			}
+
+			if conn != nil {
+				conn.close()
+				conn = nil
+			}
+
+			select {
+			case <-time.After(h.opts.RetryBackoff):
+			case <-ctx.Done():
+			}
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importConn is a connection to the server the commands are pipelined over.
+type importConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	db   int
+	stop func() bool
+}
+
+func dialImportConn(ctx context.Context, addr string, opts ImportOptions) (*importConn, error) {
+	conn, err := dial(ctx, addr, opts.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// closing the connection unblocks the reads and writes
+	// when the context is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+
+	c := &importConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriterSize(conn, 1<<16),
+		stop: stop,
+	}
+
+	err = authenticate(conn, c.r, opts.Username, opts.Password)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// send pipelines the commands of the batch, selecting the databases
+// as necessary, and reads their replies.
+func (c *importConn) send(batch []importCommand) error {
+	sent := make([]importCommand, 0, len(batch))
+	for _, cmd := range batch {
+		if cmd.db >= 0 && cmd.db != c.db {
+			selectCmd := importCommand{
+				db:   cmd.db,
+				args: []string{"SELECT", strconv.Itoa(cmd.db)},
+			}
+			err := writeCommand(c.w, selectCmd.args...)
+			if err != nil {
+				return err
+			}
+
+			c.db = cmd.db
+			sent = append(sent, selectCmd)
+		}
+
+		err := writeCommand(c.w, cmd.args...)
+		if err != nil {
+			return err
+		}
+
+		sent = append(sent, cmd)
+	}
+
+	err := c.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range sent {
+		_, err = readStatusReply(c.r)
+		if err != nil {
+			var respErr RESPError
+			if errors.As(err, &respErr) {
+				return fmt.Errorf("failed to %s: %w", cmd.describe(), err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *importConn) close() {
+	c.stop()
+	_ = c.conn.Close()
+}
@@ -0,0 +1,289 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// restoreServer is a stand-in for a Redis-compatible server,
+// which only supports the commands used by the importer.
+type restoreServer struct {
+	listener net.Listener
+	password string
+	failKey  string
+	// number of connections to drop on the first RESTORE
+	drops int
+
+	mu  sync.Mutex
+	dbs map[int]*dummyDB
+}
+
+func startRestoreServer(t *testing.T, configure func(s *restoreServer)) *restoreServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &restoreServer{
+		listener: listener,
+		dbs:      make(map[int]*dummyDB),
+	}
+
+	if configure != nil {
+		configure(s)
+	}
+
+	go s.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	return s
+}
+
+func (s *restoreServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *restoreServer) db(n int) *dummyDB {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, ok := s.dbs[n]
+	if !ok {
+		db = newDummyDB()
+		s.dbs[n] = db
+	}
+
+	return db
+}
+
+func (s *restoreServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *restoreServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	db := 0
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case args[0] == "AUTH":
+			if args[len(args)-1] != s.password {
+				_ = writeErrorReply(conn, "WRONGPASS invalid username-password pair")
+				continue
+			}
+			authenticated = true
+			_ = writeStatusReply(conn, "OK")
+		case !authenticated:
+			_ = writeErrorReply(conn, "NOAUTH Authentication required.")
+		case args[0] == "SELECT":
+			db, _ = strconv.Atoi(args[1])
+			_ = writeStatusReply(conn, "OK")
+		case args[0] == "FUNCTION":
+			_ = s.db(0).HandleLibrary(args[3])
+			_ = writeStatusReply(conn, "OK")
+		case args[0] == "RESTORE":
+			s.mu.Lock()
+			drop := s.drops > 0
+			if drop {
+				s.drops--
+			}
+			s.mu.Unlock()
+
+			if drop {
+				return
+			}
+
+			err = s.restore(db, args)
+			if err != nil {
+				_ = writeErrorReply(conn, "ERR "+err.Error())
+				continue
+			}
+			_ = writeStatusReply(conn, "OK")
+		default:
+			_ = writeErrorReply(conn, "ERR unknown command")
+		}
+	}
+}
+
+func (s *restoreServer) restore(dbnum int, args []string) error {
+	if len(args) != 6 || args[4] != "REPLACE" || args[5] != "ABSTTL" {
+		return errors.New("unexpected RESTORE arguments")
+	}
+
+	key, payload := args[1], []byte(args[3])
+	if key == s.failKey {
+		return errors.New("DUMP payload version or checksum are wrong")
+	}
+
+	n := len(payload)
+	if binary.LittleEndian.Uint16(payload[n-10:]) != Version {
+		return errors.New("unexpected version")
+	}
+
+	if getCRC(0, payload[:n-8]) != binary.LittleEndian.Uint64(payload[n-8:]) {
+		return errors.New("unexpected checksum")
+	}
+
+	ttl, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	db := s.db(dbnum)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ttl != 0 {
+		db.HandleExpireTime(key, time.Duration(ttl)*time.Millisecond)
+	}
+
+	return ReadValue(key, payload[:n-10], db)
+}
+
+// readImportExpected reads the file in the given path, without the stream
+// fields which are not kept in the first stream format.
+func readImportExpected(t *testing.T, name string) *dummyDB {
+	db := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, name), db)
+	require.NoError(t, err)
+
+	for _, groups := range db.streamGroups {
+		for i := range groups {
+			groups[i].EntriesRead = 0
+			for j := range groups[i].Consumers {
+				groups[i].Consumers[j].ActiveTime = 0
+			}
+		}
+	}
+
+	return db
+}
+
+func TestImportFile(t *testing.T) {
+	for _, name := range []string{"all-types.rdb", "stream-with-pel.rdb", "expiretime-sec.rdb", "function.rdb"} {
+		t.Run(name, func(t *testing.T) {
+			expected := readImportExpected(t, name)
+
+			s := startRestoreServer(t, nil)
+			err := ImportFile(context.Background(), s.addr(), filepath.Join(dumpsPath, name), ImportOptions{
+				Concurrency: 2,
+				BatchSize:   3,
+			})
+			require.NoError(t, err)
+			require.Equal(t, expected, s.db(0))
+		})
+	}
+}
+
+func TestImportReader(t *testing.T) {
+	expected := readImportExpected(t, "all-types.rdb")
+
+	s := startRestoreServer(t, func(s *restoreServer) {
+		s.password = "secret"
+	})
+
+	payload := readDump(t, "all-types.rdb")
+	err := ImportReader(context.Background(), s.addr(), bytes.NewReader(payload), ImportOptions{
+		Password: "secret",
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, s.db(0))
+}
+
+func TestImportFile_multiDB(t *testing.T) {
+	expected := newDummyDB()
+	expected.partialRead = true
+	err := ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), expected)
+	require.NoError(t, err)
+	expected.partialRead = false
+
+	s := startRestoreServer(t, nil)
+	err = ImportFile(context.Background(), s.addr(), filepath.Join(dumpsPath, "multi-db.rdb"), ImportOptions{
+		Concurrency: 1,
+		BatchSize:   4,
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, s.db(0))
+	require.Contains(t, s.db(1).strings, "00")
+	require.Equal(t, []string{"a"}, s.db(1).lists["01"])
+}
+
+func TestImportFile_retry(t *testing.T) {
+	expected := readImportExpected(t, "all-types.rdb")
+
+	s := startRestoreServer(t, func(s *restoreServer) {
+		s.drops = 2
+	})
+
+	err := ImportFile(context.Background(), s.addr(), filepath.Join(dumpsPath, "all-types.rdb"), ImportOptions{
+		Concurrency:  1,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, s.db(0))
+
+	s = startRestoreServer(t, func(s *restoreServer) {
+		s.drops = 2
+	})
+
+	err = ImportFile(context.Background(), s.addr(), filepath.Join(dumpsPath, "all-types.rdb"), ImportOptions{
+		Concurrency:  1,
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	})
+	require.Error(t, err)
+}
+
+func TestImportFile_errorReply(t *testing.T) {
+	s := startRestoreServer(t, func(s *restoreServer) {
+		s.failKey = "00"
+	})
+
+	err := ImportFile(context.Background(), s.addr(), filepath.Join(dumpsPath, "all-types.rdb"), ImportOptions{
+		BatchSize:  1,
+		MaxRetries: 3,
+	})
+	require.ErrorContains(t, err, `failed to restore the key "00"`)
+
+	var respErr RESPError
+	require.ErrorAs(t, err, &respErr)
+	require.True(t, strings.HasPrefix(string(respErr), "ERR DUMP payload"))
+}
+
+func TestImportFile_contextDone(t *testing.T) {
+	s := startRestoreServer(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ImportFile(ctx, s.addr(), filepath.Join(dumpsPath, "all-types.rdb"), ImportOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,210 @@
+package rdb
+
+import "time"
+
+// UnknownLength is the length passed to the LifecycleHandler for the values
+// whose encodings do not declare their number of elements up front.
+const UnknownLength int64 = -1
+
+// valueLifecycle notifies the LifecycleHandler about the beginning
+// and the end of the value being read. All of its methods are no-op
+// when it is nil, so that the readers can call them unconditionally.
+type valueLifecycle struct {
+	handler LifecycleHandler
+	key     string
+	t       Type
+	begun   bool
+	read    uint64
+}
+
+// begin notifies the handler with the declared length of the
+// value, unless it is already notified.
+func (l *valueLifecycle) begin(length int64) error {
+	if l == nil || l.begun {
+		return nil
+	}
+
+	l.begun = true
+	return l.handler.HandleBegin(l.key, l.t, length)
+}
+
+// next is called before each element of the value is passed to the handler.
+func (l *valueLifecycle) next() error {
+	if l == nil {
+		return nil
+	}
+
+	err := l.begin(UnknownLength)
+	if err != nil {
+		return err
+	}
+
+	l.read++
+	return nil
+}
+
+// single is called before the single element of
+// the strings and the modules is passed to the handler.
+func (l *valueLifecycle) single() error {
+	if l == nil {
+		return nil
+	}
+
+	err := l.begin(1)
+	if err != nil {
+		return err
+	}
+
+	return l.next()
+}
+
+// end notifies the handler with the number of elements read.
+func (l *valueLifecycle) end() error {
+	if l == nil {
+		return nil
+	}
+
+	err := l.begin(UnknownLength)
+	if err != nil {
+		return err
+	}
+
+	return l.handler.HandleEnd(l.key, l.t, l.read)
+}
+
+// skip notifies the handler with the number of elements read until the value
+// is skipped, if it is notified about its beginning, and returns ErrSkipKey
+// unless the handler fails.
+func (l *valueLifecycle) skip() error {
+	if l == nil || !l.begun {
+		return ErrSkipKey
+	}
+
+	err := l.handler.HandleEnd(l.key, l.t, l.read)
+	if err != nil {
+		return err
+	}
+
+	return ErrSkipKey
+}
+
+func (l *valueLifecycle) elem(cb func(string) error) func(string) error {
+	if l == nil {
+		return cb
+	}
+
+	return func(elem string) error {
+		if err := l.next(); err != nil {
+			return err
+		}
+
+		return cb(elem)
+	}
+}
+
+func (l *valueLifecycle) intElem(cb func(string, int64, bool) error) func(string, int64, bool) error {
+	if l == nil {
+		return cb
+	}
+
+	return func(elem string, intVal int64, isInt bool) error {
+		if err := l.next(); err != nil {
+			return err
+		}
+
+		return cb(elem, intVal, isInt)
+	}
+}
+
+func (l *valueLifecycle) zsetElem(cb func(string, float64) error) func(string, float64) error {
+	if l == nil {
+		return cb
+	}
+
+	return func(elem string, score float64) error {
+		if err := l.next(); err != nil {
+			return err
+		}
+
+		return cb(elem, score)
+	}
+}
+
+func (l *valueLifecycle) hashElem(cb func(string, string) error) func(string, string) error {
+	if l == nil {
+		return cb
+	}
+
+	return func(field, value string) error {
+		if err := l.next(); err != nil {
+			return err
+		}
+
+		return cb(field, value)
+	}
+}
+
+func (l *valueLifecycle) hashWithExpElem(cb func(string, string, time.Time) error) func(string, string, time.Time) error {
+	if l == nil {
+		return cb
+	}
+
+	return func(field, value string, ttl time.Time) error {
+		if err := l.next(); err != nil {
+			return err
+		}
+
+		return cb(field, value, ttl)
+	}
+}
+
+func (l *valueLifecycle) streamEntry(cb func(StreamEntry) error) func(StreamEntry) error {
+	if l == nil {
+		return cb
+	}
+
+	return func(entry StreamEntry) error {
+		if err := l.next(); err != nil {
+			return err
+		}
+
+		return cb(entry)
+	}
+}
+
+func (l *valueLifecycle) streamGroup(cb func(StreamConsumerGroup) error) func(StreamConsumerGroup) error {
+	if l == nil {
+		return cb
+	}
+
+	return func(group StreamConsumerGroup) error {
+		// groups are not counted as the elements of the stream
+		if err := l.begin(UnknownLength); err != nil {
+			return err
+		}
+
+		return cb(group)
+	}
+}
+
+// declaredLength returns the number of elements declared in the header of
+// the ziplist or the listpack, in units of the given number of entries,
+// or UnknownLength if the header does not declare it.
+func declaredLength(n uint16, big uint16, unit int) int64 {
+	if n == big {
+		return UnknownLength
+	}
+
+	return int64(int(n) / unit)
+}
+
+// listpackLength returns the number of entries declared in the header
+// of the listpack, or UnknownLength if the header does not declare it.
+func listpackLength(listpack string) int64 {
+	if len(listpack) < 6 {
+		return UnknownLength
+	}
+
+	lplen := uint16(listpack[4]) | uint16(listpack[5])<<8
+	return declaredLength(lplen, listpackLenBig, 1)
+}
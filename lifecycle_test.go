@@ -0,0 +1,220 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type lifecycleDummyDB struct {
+	*dummyDB
+	events []string
+}
+
+func (db *lifecycleDummyDB) HandleBegin(key string, t Type, length int64) error {
+	// no element of the value should be passed to the handler yet
+	_, hasList := db.lists[key]
+	_, hasHash := db.hashes[key]
+	_, hasStream := db.streamEntries[key]
+	if hasList || hasHash || hasStream {
+		return errors.New("begin is called after the elements")
+	}
+
+	db.events = append(db.events, fmt.Sprintf("begin %s %d %d", key, t, length))
+	return nil
+}
+
+func (db *lifecycleDummyDB) HandleEnd(key string, t Type, entriesRead uint64) error {
+	db.events = append(db.events, fmt.Sprintf("end %s %d %d", key, t, entriesRead))
+	return nil
+}
+
+func TestLifecycleHandler(t *testing.T) {
+	db := &lifecycleDummyDB{dummyDB: newDummyDB()}
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), db)
+	require.NoError(t, err)
+
+	expected := readScanExpected(t, "all-types.rdb")
+	require.Equal(t, expected.strings, db.strings)
+	require.Equal(t, expected.lists, db.lists)
+	require.Equal(t, expected.hashes, db.hashes)
+
+	var events []string
+	for _, e := range []struct {
+		key    string
+		t      Type
+		length int64
+	}{
+		{"00", TypeString, 1},
+		{"01", TypeList, 1},
+		{"02", TypeSet, 1},
+		{"03", TypeZset, 1},
+		{"04", TypeHash, 1},
+		{"05", TypeZset2, 1},
+		{"07", TypeModule2, 1},
+		{"09", TypeHashZipmap, 1},
+		{"10", TypeListZiplist, 1},
+		{"11", TypeSetIntset, 1},
+		{"12", TypeZsetZiplist, 1},
+		{"13", TypeHashZiplist, 1},
+		{"14", TypeListQuicklist, UnknownLength},
+		{"15", TypeStreamListpacks, UnknownLength},
+		{"16", TypeHashListpack, 1},
+		{"17", TypeZsetListpack, 1},
+		{"18", TypeListQuicklist2, UnknownLength},
+		{"19", TypeStreamListpacks2, UnknownLength},
+		{"20", TypeSetListpack, 1},
+		{"21", TypeStreamListpacks3, UnknownLength},
+	} {
+		events = append(events,
+			fmt.Sprintf("begin %s %d %d", e.key, e.t, e.length),
+			fmt.Sprintf("end %s %d %d", e.key, e.t, 1),
+		)
+	}
+
+	require.Equal(t, events, db.events)
+}
+
+func TestLifecycleHandler_hashWithMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hash-metadata.rdb")
+
+	encoder, err := NewFileEncoder(path, version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	hashEncoder, err := encoder.BeginHashWithMetadata("hash", time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, hashEncoder.WriteFieldStrStrWithExpiry("a", "1", time.Now().Add(time.Hour)))
+	require.NoError(t, hashEncoder.WriteFieldStrStrWithExpiry("b", "2", time.Time{}))
+	require.NoError(t, hashEncoder.Close())
+	require.NoError(t, encoder.Close())
+
+	db := &lifecycleDummyDB{dummyDB: newDummyDB()}
+	err = ReadFile(path, db)
+	require.NoError(t, err)
+
+	require.Len(t, db.events, 2)
+	require.Regexp(t, `^begin hash (24|25) 2$`, db.events[0])
+	require.Regexp(t, `^end hash (24|25) 2$`, db.events[1])
+}
+
+func TestLifecycleHandler_value(t *testing.T) {
+	w := NewWriter()
+	require.NoError(t, w.WriteType(TypeSet))
+	require.NoError(t, w.WriteSet([]string{"a", "b", "c"}))
+	require.NoError(t, w.WriteChecksum(Version))
+
+	db := &lifecycleDummyDB{dummyDB: newDummyDB()}
+	err := ReadValue("set", w.GetBuffer(), db)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"begin set 2 3", "end set 2 3"}, db.events)
+	require.Equal(t, []string{"a", "b", "c"}, db.sets["set"])
+}
+
+type failingBeginDB struct {
+	*dummyDB
+}
+
+func (db *failingBeginDB) HandleBegin(key string, t Type, length int64) error {
+	return errors.New("failed to begin")
+}
+
+func (db *failingBeginDB) HandleEnd(key string, t Type, entriesRead uint64) error {
+	return nil
+}
+
+func TestLifecycleHandler_error(t *testing.T) {
+	db := &failingBeginDB{dummyDB: newDummyDB()}
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), db)
+	require.ErrorContains(t, err, "failed to begin")
+	require.Empty(t, db.strings)
+}
+
+func TestLifecycleHandler_multiHandler(t *testing.T) {
+	db := &lifecycleDummyDB{dummyDB: newDummyDB()}
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), NewMultiHandler(newDummyDB(), db))
+	require.NoError(t, err)
+	require.Len(t, db.events, 40)
+}
+
+type skipAfterLifecycleDB struct {
+	*skipAfterDummyDB
+	events []string
+}
+
+func (db *skipAfterLifecycleDB) HandleBegin(key string, t Type, length int64) error {
+	db.events = append(db.events, fmt.Sprintf("begin %s %d", key, t))
+	return nil
+}
+
+func (db *skipAfterLifecycleDB) HandleEnd(key string, t Type, entriesRead uint64) error {
+	db.events = append(db.events, fmt.Sprintf("end %s %d %d", key, t, entriesRead))
+	return nil
+}
+
+func TestLifecycleHandler_skipKey(t *testing.T) {
+	path := writeSkipTestFile(t)
+
+	newSkipper := func() *skipAfterLifecycleDB {
+		return &skipAfterLifecycleDB{
+			skipAfterDummyDB: &skipAfterDummyDB{dummyDB: newDummyDB(), n: 2},
+		}
+	}
+
+	alone := newSkipper()
+	require.NoError(t, ReadFile(path, alone))
+
+	keys := []string{"list", "set", "zset", "hash", "hashex", "stream"}
+	require.Len(t, alone.events, 2*len(keys)+2)
+	for i, key := range keys {
+		require.Regexp(t, fmt.Sprintf(`^begin %s \d+$`, key), alone.events[2*i])
+		// the value is skipped at its second element
+		require.Regexp(t, fmt.Sprintf(`^end %s \d+ 2$`, key), alone.events[2*i+1])
+	}
+	require.Equal(t, []string{
+		fmt.Sprintf("begin after %d", TypeString),
+		fmt.Sprintf("end after %d 1", TypeString),
+	}, alone.events[2*len(keys):])
+
+	// the handlers that skip a value in the MultiHandler are notified the same way
+	multi := newSkipper()
+	require.NoError(t, ReadFile(path, NewMultiHandler(multi, newDummyDB())))
+	require.Equal(t, alone.events, multi.events)
+	require.Equal(t, alone.dummyDB, multi.dummyDB)
+}
+
+type skipBeginLifecycleDB struct {
+	*lifecycleDummyDB
+}
+
+func (db *skipBeginLifecycleDB) HandleBegin(key string, t Type, length int64) error {
+	err := db.lifecycleDummyDB.HandleBegin(key, t, length)
+	if err != nil {
+		return err
+	}
+
+	return ErrSkipKey
+}
+
+func TestLifecycleHandler_skipKeyAtBegin(t *testing.T) {
+	db := &skipBeginLifecycleDB{lifecycleDummyDB: &lifecycleDummyDB{dummyDB: newDummyDB()}}
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), db)
+	require.NoError(t, err)
+
+	require.Empty(t, db.strings)
+	require.Empty(t, db.lists)
+	require.Len(t, db.events, 40)
+	for i := 0; i < len(db.events); i += 2 {
+		var key string
+		var typ Type
+		var length int64
+		_, err := fmt.Sscanf(db.events[i], "begin %s %d %d", &key, &typ, &length)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("end %s %d 0", key, typ), db.events[i+1])
+	}
+}
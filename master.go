@@ -0,0 +1,345 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPingInterval = 10 * time.Second
+
+var errPayloadConsumed = errors.New("the RDB file is already sent to another replica")
+
+// MasterOptions configures the master side of the replication.
+type MasterOptions struct {
+	// Username and Password are required from the replicas with the AUTH
+	// command, if the Password is set. The Username defaults to "default".
+	Username string
+	Password string
+	// PingInterval is the interval of the PING commands sent to the replicas
+	// to keep the replication link alive, after the RDB file is sent.
+	// Defaults to 10 seconds, like the repl-ping-replica-period of Redis.
+	PingInterval time.Duration
+}
+
+// Master serves an RDB file to the Redis-compatible replicas by acting as
+// their master. It answers to the replication handshake of the replicas,
+// sends the RDB file as a full resynchronization, and keeps the replication
+// link alive afterwards, without ever sending any write commands.
+type Master struct {
+	opts   MasterOptions
+	replID string
+	// open returns the RDB file to send, and its size,
+	// which is negative if it is not known in advance.
+	open func() (io.ReadCloser, int64, error)
+}
+
+// NewMaster returns a master that serves the RDB file in the given path.
+// The file is opened for each replica, and sent with its length.
+func NewMaster(path string, opts MasterOptions) *Master {
+	return newMaster(opts, func() (io.ReadCloser, int64, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, 0, err
+		}
+
+		return file, info.Size(), nil
+	})
+}
+
+// NewReaderMaster returns a master that serves the RDB file read from the
+// given reader. The file is sent with the EOF mark, as in the diskless
+// replication of Redis, or buffered in memory for the replicas that do not
+// support it. Since the reader can be consumed once, only the first replica
+// that requests a full resynchronization is served.
+func NewReaderMaster(r io.Reader, opts MasterOptions) *Master {
+	var mu sync.Mutex
+	consumed := false
+	return newMaster(opts, func() (io.ReadCloser, int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if consumed {
+			return nil, 0, errPayloadConsumed
+		}
+
+		consumed = true
+		return io.NopCloser(r), -1, nil
+	})
+}
+
+func newMaster(opts MasterOptions, open func() (io.ReadCloser, int64, error)) *Master {
+	if opts.Username == "" {
+		opts.Username = "default"
+	}
+
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = defaultPingInterval
+	}
+
+	return &Master{
+		opts:   opts,
+		replID: randomHex(20),
+		open:   open,
+	}
+}
+
+// Serve accepts the replica connections from the listener, and serves each
+// of them in a separate goroutine, until the context is done or the listener
+// is closed. It closes the listener and the connections before returning.
+func (m *Master) Serve(ctx context.Context, l net.Listener) error {
+	return serveListener(ctx, l, m.ServeConn)
+}
+
+// serveListener accepts the connections from the listener, and serves each
+// of them with the given function in a separate goroutine, until the context
+// is done or the listener is closed. It waits for the connections to be
+// closed before returning.
+func serveListener(ctx context.Context, l net.Listener, serveConn func(ctx context.Context, conn net.Conn) error) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = l.Close()
+	})
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			_ = l.Close()
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = serveConn(ctx, conn)
+		}()
+	}
+}
+
+// ServeConn serves a single replica connection, until the replica
+// disconnects or the context is done. It closes the connection before
+// returning. The replicas that request the rdb-only mode are disconnected
+// right after the RDB file is sent.
+func (m *Master) ServeConn(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	// closing the connection unblocks the reads and writes
+	// below when the context is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	err := m.serveConn(conn)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func (m *Master) serveConn(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	authenticated := m.opts.Password == ""
+	eofCapa := false
+	rdbOnly := false
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		cmd := strings.ToUpper(args[0])
+		switch {
+		case cmd == "AUTH":
+			err = m.auth(args[1:])
+			authenticated = authenticated || err == nil
+			if err != nil {
+				err = writeErrorReply(conn, err.Error())
+			} else {
+				err = writeStatusReply(conn, "OK")
+			}
+		case !authenticated:
+			err = writeErrorReply(conn, "NOAUTH Authentication required.")
+		case cmd == "PING":
+			err = writeStatusReply(conn, "PONG")
+		case cmd == "REPLCONF":
+			for i := 1; i+1 < len(args); i += 2 {
+				switch strings.ToLower(args[i]) {
+				case "capa":
+					eofCapa = eofCapa || strings.ToLower(args[i+1]) == "eof"
+				case "rdb-only":
+					rdbOnly = args[i+1] == "1"
+				}
+			}
+			err = writeStatusReply(conn, "OK")
+		case cmd == "PSYNC" || cmd == "SYNC":
+			return m.fullResync(conn, r, cmd == "PSYNC", eofCapa, rdbOnly)
+		default:
+			err = writeErrorReply(conn, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Master) auth(args []string) error {
+	username := "default"
+	var password string
+	switch len(args) {
+	case 1:
+		password = args[0]
+	case 2:
+		username, password = args[0], args[1]
+	default:
+		return errors.New("ERR wrong number of arguments for 'auth' command")
+	}
+
+	if username != m.opts.Username || password != m.opts.Password {
+		return errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+
+	return nil
+}
+
+// fullResync sends the RDB file to the replica, and keeps the
+// replication link alive afterwards, unless the replica is rdb-only.
+func (m *Master) fullResync(conn net.Conn, r *bufio.Reader, psync, eofCapa, rdbOnly bool) error {
+	file, size, err := m.open()
+	if err != nil {
+		_ = writeErrorReply(conn, "ERR "+err.Error())
+		return err
+	}
+	defer file.Close()
+
+	var payload io.Reader = file
+	if size < 0 && !eofCapa {
+		// the replica can only read the payloads with known lengths
+		data, err := io.ReadAll(file)
+		if err != nil {
+			_ = writeErrorReply(conn, "ERR "+err.Error())
+			return err
+		}
+
+		payload = bytes.NewReader(data)
+		size = int64(len(data))
+	}
+
+	if psync {
+		// the replica starts counting the offset from the
+		// given one, and we never send anything but PINGs.
+		err = writeStatusReply(conn, "FULLRESYNC "+m.replID+" 0")
+		if err != nil {
+			return err
+		}
+	}
+
+	if size >= 0 {
+		_, err = io.WriteString(conn, "$"+strconv.FormatInt(size, 10)+"\r\n")
+		if err != nil {
+			return err
+		}
+
+		_, err = io.CopyN(conn, payload, size)
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	} else {
+		mark := randomHex(eofMarkLen / 2)
+		_, err = io.WriteString(conn, "$EOF:"+mark+"\r\n")
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(conn, payload)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(conn, mark)
+		if err != nil {
+			return err
+		}
+	}
+
+	if rdbOnly {
+		return nil
+	}
+
+	return m.keepAlive(conn, r)
+}
+
+// keepAlive sends PING commands to the replica periodically, until
+// the replica disconnects. The replica acknowledges the replication
+// offset with the REPLCONF ACK commands, which are not replied.
+func (m *Master) keepAlive(conn net.Conn, r *bufio.Reader) error {
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			_, err := readCommand(r)
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(m.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-readErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ticker.C:
+			err := writeCommand(conn, "PING")
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// randomHex returns a random hex string of the length 2*n.
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
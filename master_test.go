@@ -0,0 +1,172 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startMaster(t *testing.T, m *Master) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Serve(ctx, listener)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	return listener.Addr().String()
+}
+
+// fakeReplica performs the replication handshake without the rdb-only
+// mode, and returns the connection positioned at the sync payload.
+func fakeReplica(t *testing.T, addr string, eofCapa bool) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	r := bufio.NewReader(conn)
+	reply, err := roundTrip(conn, r, "PING")
+	require.NoError(t, err)
+	require.Equal(t, "PONG", reply)
+
+	if eofCapa {
+		_, err = roundTrip(conn, r, "REPLCONF", "capa", "eof", "capa", "psync2")
+		require.NoError(t, err)
+	}
+
+	reply, err = roundTrip(conn, r, "PSYNC", "?", "-1")
+	require.NoError(t, err)
+	require.Regexp(t, "^FULLRESYNC [0-9a-f]{40} 0$", reply)
+
+	return conn, r
+}
+
+func TestMaster(t *testing.T) {
+	path := filepath.Join(dumpsPath, "all-types.rdb")
+	expected := newDummyDB()
+	err := ReadFile(path, expected)
+	require.NoError(t, err)
+
+	addr := startMaster(t, NewMaster(path, MasterOptions{}))
+
+	// the file can be served more than once
+	for i := 0; i < 2; i++ {
+		db := newDummyDB()
+		err = SyncFromMaster(context.Background(), addr, db, ReplicaOptions{})
+		require.NoError(t, err)
+		require.Equal(t, expected, db)
+	}
+}
+
+func TestMaster_auth(t *testing.T) {
+	path := filepath.Join(dumpsPath, "all-types.rdb")
+	addr := startMaster(t, NewMaster(path, MasterOptions{Password: "secret"}))
+
+	err := SyncFromMaster(context.Background(), addr, newDummyDB(), ReplicaOptions{})
+	require.ErrorContains(t, err, "NOAUTH")
+
+	err = SyncFromMaster(context.Background(), addr, newDummyDB(), ReplicaOptions{Password: "wrong"})
+	require.ErrorContains(t, err, "WRONGPASS")
+
+	err = SyncFromMaster(context.Background(), addr, newDummyDB(), ReplicaOptions{Password: "secret"})
+	require.NoError(t, err)
+
+	err = SyncFromMaster(context.Background(), addr, newDummyDB(), ReplicaOptions{Username: "default", Password: "secret"})
+	require.NoError(t, err)
+}
+
+func TestMaster_reader(t *testing.T) {
+	payload := readDump(t, "all-types.rdb")
+	expected := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), expected)
+	require.NoError(t, err)
+
+	addr := startMaster(t, NewReaderMaster(bytes.NewReader(payload), MasterOptions{}))
+
+	db := newDummyDB()
+	err = SyncFromMaster(context.Background(), addr, db, ReplicaOptions{})
+	require.NoError(t, err)
+	require.Equal(t, expected, db)
+
+	err = SyncFromMaster(context.Background(), addr, newDummyDB(), ReplicaOptions{})
+	require.ErrorContains(t, err, "already sent")
+}
+
+func TestMaster_framing(t *testing.T) {
+	path := filepath.Join(dumpsPath, "all-types.rdb")
+	payload := readDump(t, "all-types.rdb")
+
+	tests := []struct {
+		name    string
+		master  *Master
+		eofCapa bool
+		header  string
+	}{
+		{
+			name:    "file",
+			master:  NewMaster(path, MasterOptions{}),
+			eofCapa: true,
+			header:  "$" + strconv.Itoa(len(payload)),
+		},
+		{
+			name:    "reader",
+			master:  NewReaderMaster(bytes.NewReader(payload), MasterOptions{}),
+			eofCapa: true,
+			header:  "$EOF:",
+		},
+		{
+			name:    "reader without eof capa",
+			master:  NewReaderMaster(bytes.NewReader(payload), MasterOptions{}),
+			eofCapa: false,
+			header:  "$" + strconv.Itoa(len(payload)),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := startMaster(t, tc.master)
+			_, r := fakeReplica(t, addr, tc.eofCapa)
+
+			header, err := r.Peek(len(tc.header))
+			require.NoError(t, err)
+			require.Equal(t, tc.header, string(header))
+
+			_, err = ReadSyncPayload(r, newDummyDB())
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMaster_keepAlive(t *testing.T) {
+	path := filepath.Join(dumpsPath, "all-types.rdb")
+	addr := startMaster(t, NewMaster(path, MasterOptions{PingInterval: 10 * time.Millisecond}))
+
+	conn, r := fakeReplica(t, addr, true)
+	r, err := ReadSyncPayload(r, newDummyDB())
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		cmd, err := readCommand(r)
+		require.NoError(t, err)
+		require.Equal(t, []string{"PING"}, cmd)
+
+		err = writeCommand(conn, "REPLCONF", "ACK", "0")
+		require.NoError(t, err)
+	}
+}
@@ -21,6 +21,50 @@ func constructModuleName(id uint64) string {
 	return bytesToString(name)
 }
 
+// ModuleOpCode describes the type of a value saved by a module.
+type ModuleOpCode uint64
+
+const (
+	ModuleOpCodeSInt   = ModuleOpCode(moduleOpCodeSInt)
+	ModuleOpCodeUInt   = ModuleOpCode(moduleOpCodeUInt)
+	ModuleOpCodeFloat  = ModuleOpCode(moduleOpCodeFloat)
+	ModuleOpCodeDouble = ModuleOpCode(moduleOpCodeDouble)
+	ModuleOpCodeString = ModuleOpCode(moduleOpCodeString)
+)
+
+// Bits of the ModuleAux.When, describing whether the auxiliary data of the
+// module is saved before or after the keyspace.
+const (
+	ModuleAuxBeforeRDB uint64 = 1 << 0
+	ModuleAuxAfterRDB  uint64 = 1 << 1
+)
+
+// ModuleValue is a single value saved by a module. Only the field
+// corresponding to the OpCode is set.
+type ModuleValue struct {
+	OpCode ModuleOpCode
+	SInt   int64
+	UInt   uint64
+	Float  float32
+	Double float64
+	String string
+}
+
+// ModuleAux is the global, keyspace independent, data of a module
+// saved into the RDB file.
+type ModuleAux struct {
+	ID     uint64
+	Name   string
+	When   uint64
+	Values []ModuleValue
+}
+
+// Version returns the encoding version of the module data,
+// which is stored in the last 10 bits of the module id.
+func (a ModuleAux) Version() uint64 {
+	return a.ID & 0x000000000000003FF
+}
+
 type moduleReader struct {
 	reader *valueReader
 }
@@ -67,6 +111,73 @@ func (r *moduleReader) Skip() error {
 	}
 }
 
+// ReadAux reads the module auxiliary data with the given module id.
+// It has the following form:
+// <when-opcode><when><opcode><value>...<opcode><value><eof>
+// where
+// <when-opcode> is always the unsigned integer opcode, and <when> is a
+// length encoded integer describing when the data is saved.
+// Each <opcode> is a length encoded integer describing the type of the following
+// <value>, and the values are terminated with the EOF opcode.
+func (r *moduleReader) ReadAux(id uint64) (ModuleAux, error) {
+	when, err := r.readUint64()
+	if err != nil {
+		return ModuleAux{}, err
+	}
+
+	values, err := r.readValues()
+	if err != nil {
+		return ModuleAux{}, err
+	}
+
+	return ModuleAux{
+		ID:     id,
+		Name:   constructModuleName(id),
+		When:   when,
+		Values: values,
+	}, nil
+}
+
+func (r *moduleReader) readValues() ([]ModuleValue, error) {
+	values := make([]ModuleValue, 0)
+	for {
+		opcode, _, err := r.reader.readLen()
+		if err != nil {
+			return nil, err
+		}
+
+		value := ModuleValue{OpCode: ModuleOpCode(opcode)}
+		switch opcode {
+		case moduleOpCodeEOF:
+			return values, nil
+		case moduleOpCodeSInt:
+			var v uint64
+			v, _, err = r.reader.readLen()
+			value.SInt = int64(v)
+		case moduleOpCodeUInt:
+			value.UInt, _, err = r.reader.readLen()
+		case moduleOpCodeFloat:
+			var v uint32
+			v, err = r.reader.readUint32()
+			value.Float = math.Float32frombits(v)
+		case moduleOpCodeDouble:
+			var v uint64
+			v, err = r.reader.readUint64()
+			value.Double = math.Float64frombits(v)
+		case moduleOpCodeString:
+			value.String, err = r.reader.ReadString()
+		default:
+			err = errors.New("unexpected module opcode")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+}
+
 func (r *moduleReader) readJSON(version uint64) (string, error) {
 	switch version {
 	case jsonModuleV0:
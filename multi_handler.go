@@ -0,0 +1,489 @@
+package rdb
+
+import (
+	"errors"
+	"time"
+)
+
+// MultiHandler is a FileHandler that forwards the RDB objects read to multiple
+// handlers, so that a file can be processed by all of them in a single pass.
+// The functions returned for the elements of the collections call the functions
+// of all the handlers, and the first error returned stops reading the file.
+// ErrSkipKey and ErrStop only affect the handlers that return them, and they are
+// returned to the reader once all the handlers skip the key or stop reading.
+// The handlers that skip an entry of the file still receive its KeyInfo, and
+// receive the next entry once it is dispatched. The LifecycleHandlers that skip
+// a value receive its HandleEnd once they skip it, as they do when read alone.
+//
+// The optional DBHandler, AuxHandler, EvictionHandler, ModuleAuxHandler,
+// LifecycleHandler, KeyInfoHandler, IntEntryHandler and BytesHandler extensions
+// are forwarded to the handlers that implement them. The handlers that do not
+// implement the DBHandler receive only the entries of the database 0, as if they
+// were passed to ReadFile alone. The handlers that do not implement the
+// IntEntryHandler receive the integer elements as strings.
+type MultiHandler struct {
+	handlers []FileHandler
+	// whether the handler receives the entries of the selected database
+	active []bool
+	// whether the handler skipped the current key
+	skipped []bool
+	// whether the handler stopped reading
+	stopped []bool
+	// the value being read, or nil between the values
+	value *multiValue
+}
+
+// multiValue is the value being read, whose end is notified to the lifecycle
+// handlers that skip it, with the number of elements read until then.
+type multiValue struct {
+	key  string
+	t    Type
+	read uint64
+}
+
+// NewMultiHandler returns a handler that forwards the RDB objects read
+// to the given handlers, in the given order.
+func NewMultiHandler(handlers ...FileHandler) *MultiHandler {
+	active := make([]bool, len(handlers))
+	for i := range active {
+		active[i] = true
+	}
+
+	return &MultiHandler{
+		handlers: handlers,
+		active:   active,
+		skipped:  make([]bool, len(handlers)),
+		stopped:  make([]bool, len(handlers)),
+	}
+}
+
+// receives returns whether the handler with the given index
+// receives the rest of the current key.
+func (m *MultiHandler) receives(i int) bool {
+	return m.active[i] && !m.skipped[i] && !m.stopped[i]
+}
+
+// result records the ErrSkipKey and ErrStop returned from the handler with
+// the given index, and returns the error to be returned to the reader.
+func (m *MultiHandler) result(i int, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrSkipKey):
+		m.skipped[i] = true
+		return m.endSkipped(i)
+	case errors.Is(err, ErrStop):
+		m.stopped[i] = true
+		for _, stopped := range m.stopped {
+			if !stopped {
+				return nil
+			}
+		}
+
+		return ErrStop
+	default:
+		return err
+	}
+}
+
+// endSkipped notifies the handler with the given index about the end of the
+// value it skipped, as the reader does when the handler is read alone.
+func (m *MultiHandler) endSkipped(i int) error {
+	lifecycleHandler, ok := m.handlers[i].(LifecycleHandler)
+	if !ok || m.value == nil {
+		return nil
+	}
+
+	err := lifecycleHandler.HandleEnd(m.value.key, m.value.t, m.value.read)
+	if errors.Is(err, ErrSkipKey) {
+		// the value is skipped already
+		return nil
+	}
+
+	return m.result(i, err)
+}
+
+// next counts the element of the current value that is dispatched.
+func (m *MultiHandler) next() {
+	if m.value != nil {
+		m.value.read++
+	}
+}
+
+// endKey resets the handlers that skipped the key read, so that they
+// receive the next one. It is called once the key is read completely,
+// after its KeyInfo is dispatched.
+func (m *MultiHandler) endKey() {
+	clear(m.skipped)
+	m.value = nil
+}
+
+// remaining returns ErrSkipKey if none of the
+// handlers receives the rest of the current key.
+func (m *MultiHandler) remaining() error {
+	for i := range m.handlers {
+		if m.receives(i) {
+			return nil
+		}
+	}
+
+	return ErrSkipKey
+}
+
+// AllowPartialRead returns true only if all the handlers allow partial reads.
+func (m *MultiHandler) AllowPartialRead() bool {
+	for _, h := range m.handlers {
+		if !h.AllowPartialRead() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequireStrictEOF returns true if any of the handlers requires it.
+func (m *MultiHandler) RequireStrictEOF() bool {
+	for _, h := range m.handlers {
+		if h.RequireStrictEOF() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *MultiHandler) HandleSelectDB(dbnum uint64) error {
+	for i, h := range m.handlers {
+		if m.stopped[i] {
+			continue
+		}
+
+		if dbHandler, ok := h.(DBHandler); ok {
+			err := m.result(i, dbHandler.HandleSelectDB(dbnum))
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if dbnum != 0 && !h.AllowPartialRead() {
+			return errors.New("multiple databases are not supported when the partial restore is not allowed")
+		}
+
+		m.active[i] = dbnum == 0
+	}
+
+	return nil
+}
+
+func (m *MultiHandler) HandleAux(key, value string) error {
+	for i, h := range m.handlers {
+		if auxHandler, ok := h.(AuxHandler); ok && !m.stopped[i] {
+			err := m.result(i, auxHandler.HandleAux(key, value))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *MultiHandler) HandleModuleAux(aux ModuleAux) error {
+	for i, h := range m.handlers {
+		if moduleAuxHandler, ok := h.(ModuleAuxHandler); ok && !m.stopped[i] {
+			err := m.result(i, moduleAuxHandler.HandleModuleAux(aux))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *MultiHandler) HandleFreq(key string, freq uint8) {
+	for i, h := range m.handlers {
+		if evictionHandler, ok := h.(EvictionHandler); ok && m.active[i] && !m.stopped[i] {
+			evictionHandler.HandleFreq(key, freq)
+		}
+	}
+}
+
+func (m *MultiHandler) HandleIdle(key string, idle time.Duration) {
+	for i, h := range m.handlers {
+		if evictionHandler, ok := h.(EvictionHandler); ok && m.active[i] && !m.stopped[i] {
+			evictionHandler.HandleIdle(key, idle)
+		}
+	}
+}
+
+func (m *MultiHandler) HandleExpireTime(key string, expireTime time.Duration) {
+	for i, h := range m.handlers {
+		if m.active[i] && !m.stopped[i] {
+			h.HandleExpireTime(key, expireTime)
+		}
+	}
+}
+
+// each calls the function for the handlers that receive
+// the current key, until an error is returned.
+func (m *MultiHandler) each(fn func(h FileHandler) error) error {
+	for i, h := range m.handlers {
+		if !m.receives(i) {
+			continue
+		}
+
+		err := m.result(i, fn(h))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// elemFuncs are the element functions of the handlers for the current key.
+type elemFuncs[F any] struct {
+	m   *MultiHandler
+	fns []F
+}
+
+// collect returns the element functions returned by
+// the handlers that receive the entries of the selected database.
+func collect[F any](m *MultiHandler, fn func(h FileHandler) F) *elemFuncs[F] {
+	fns := make([]F, len(m.handlers))
+	for i, h := range m.handlers {
+		if m.receives(i) {
+			fns[i] = fn(h)
+		}
+	}
+
+	return &elemFuncs[F]{
+		m:   m,
+		fns: fns,
+	}
+}
+
+// call calls the element functions of the handlers that receive
+// the current key, until an error is returned.
+func (e *elemFuncs[F]) call(fn func(f F) error) error {
+	for i, f := range e.fns {
+		if !e.m.receives(i) {
+			continue
+		}
+
+		err := e.m.result(i, fn(f))
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.m.remaining()
+}
+
+func (m *MultiHandler) HandleString(key, value string) error {
+	m.next()
+	return m.each(func(h FileHandler) error {
+		if bytesHandler, ok := h.(BytesHandler); ok {
+			return bytesHandler.HandleStringBytes(key, stringToBytes(value))
+		}
+
+		return h.HandleString(key, value)
+	})
+}
+
+func (m *MultiHandler) ListEntryHandler(key string) func(elem string) error {
+	fns := collect(m, func(h FileHandler) func(string) error {
+		return plainElem(listEntryHandler(h, key, nil))
+	})
+
+	return func(elem string) error {
+		m.next()
+		return fns.call(func(fn func(string) error) error {
+			return fn(elem)
+		})
+	}
+}
+
+func (m *MultiHandler) HandleListEnding(key string, entriesRead uint64) {
+	_ = m.each(func(h FileHandler) error {
+		h.HandleListEnding(key, entriesRead)
+		return nil
+	})
+}
+
+func (m *MultiHandler) SetEntryHandler(key string) func(elem string) error {
+	fns := collect(m, func(h FileHandler) func(string) error {
+		return plainElem(setEntryHandler(h, key, nil))
+	})
+
+	return func(elem string) error {
+		m.next()
+		return fns.call(func(fn func(string) error) error {
+			return fn(elem)
+		})
+	}
+}
+
+func (m *MultiHandler) ListIntEntryHandler(key string) func(elem string, intVal int64, isInt bool) error {
+	fns := collect(m, func(h FileHandler) func(string, int64, bool) error {
+		return listEntryHandler(h, key, nil)
+	})
+
+	return func(elem string, intVal int64, isInt bool) error {
+		m.next()
+		return fns.call(func(fn func(string, int64, bool) error) error {
+			return fn(elem, intVal, isInt)
+		})
+	}
+}
+
+func (m *MultiHandler) SetIntEntryHandler(key string) func(elem string, intVal int64, isInt bool) error {
+	fns := collect(m, func(h FileHandler) func(string, int64, bool) error {
+		return setEntryHandler(h, key, nil)
+	})
+
+	return func(elem string, intVal int64, isInt bool) error {
+		m.next()
+		return fns.call(func(fn func(string, int64, bool) error) error {
+			return fn(elem, intVal, isInt)
+		})
+	}
+}
+
+func (m *MultiHandler) ZsetEntryHandler(key string) func(elem string, score float64) error {
+	fns := collect(m, func(h FileHandler) func(string, float64) error {
+		return zsetEntryHandler(h, key, nil)
+	})
+
+	return func(elem string, score float64) error {
+		m.next()
+		return fns.call(func(fn func(string, float64) error) error {
+			return fn(elem, score)
+		})
+	}
+}
+
+func (m *MultiHandler) HandleZsetEnding(key string, entriesRead uint64) {
+	_ = m.each(func(h FileHandler) error {
+		h.HandleZsetEnding(key, entriesRead)
+		return nil
+	})
+}
+
+func (m *MultiHandler) HashEntryHandler(key string) func(field, value string) error {
+	fns := collect(m, func(h FileHandler) func(string, string) error {
+		return hashEntryHandler(h, key, nil)
+	})
+
+	return func(field, value string) error {
+		m.next()
+		return fns.call(func(fn func(string, string) error) error {
+			return fn(field, value)
+		})
+	}
+}
+
+func (m *MultiHandler) HashWithExpEntryHandler(key string) func(field string, value string, ttl time.Time) error {
+	fns := collect(m, func(h FileHandler) func(string, string, time.Time) error {
+		return hashWithExpEntryHandler(h, key, nil)
+	})
+
+	return func(field string, value string, ttl time.Time) error {
+		m.next()
+		return fns.call(func(fn func(string, string, time.Time) error) error {
+			return fn(field, value, ttl)
+		})
+	}
+}
+
+func (m *MultiHandler) HandleModule(key, value string, marker ModuleMarker) error {
+	m.next()
+	return m.each(func(h FileHandler) error {
+		return h.HandleModule(key, value, marker)
+	})
+}
+
+func (m *MultiHandler) StreamEntryHandler(key string) func(entry StreamEntry) error {
+	fns := collect(m, func(h FileHandler) func(StreamEntry) error {
+		return h.StreamEntryHandler(key)
+	})
+
+	return func(entry StreamEntry) error {
+		m.next()
+		return fns.call(func(fn func(StreamEntry) error) error {
+			return fn(entry)
+		})
+	}
+}
+
+func (m *MultiHandler) StreamGroupHandler(key string) func(group StreamConsumerGroup) error {
+	fns := collect(m, func(h FileHandler) func(StreamConsumerGroup) error {
+		return h.StreamGroupHandler(key)
+	})
+
+	return func(group StreamConsumerGroup) error {
+		return fns.call(func(fn func(StreamConsumerGroup) error) error {
+			return fn(group)
+		})
+	}
+}
+
+func (m *MultiHandler) HandleStreamEnding(key string, entriesRead uint64) {
+	_ = m.each(func(h FileHandler) error {
+		h.HandleStreamEnding(key, entriesRead)
+		return nil
+	})
+}
+
+func (m *MultiHandler) HandleLibrary(code string) error {
+	// the libraries are not followed by a KeyInfo
+	defer m.endKey()
+	return m.each(func(h FileHandler) error {
+		return h.HandleLibrary(code)
+	})
+}
+
+func (m *MultiHandler) HandleBegin(key string, t Type, length int64) error {
+	m.value = &multiValue{key: key, t: t}
+	return m.each(func(h FileHandler) error {
+		if lifecycleHandler, ok := h.(LifecycleHandler); ok {
+			return lifecycleHandler.HandleBegin(key, t, length)
+		}
+
+		return nil
+	})
+}
+
+func (m *MultiHandler) HandleEnd(key string, t Type, entriesRead uint64) error {
+	// the handlers that skipped the value are notified already
+	m.value = nil
+	return m.each(func(h FileHandler) error {
+		if lifecycleHandler, ok := h.(LifecycleHandler); ok {
+			return lifecycleHandler.HandleEnd(key, t, entriesRead)
+		}
+
+		return nil
+	})
+}
+
+func (m *MultiHandler) HandleKeyInfo(info KeyInfo) error {
+	defer m.endKey()
+	// the handlers that skipped the key receive its KeyInfo
+	// as well, as they do when they are read alone
+	for i, h := range m.handlers {
+		keyInfoHandler, ok := h.(KeyInfoHandler)
+		if !ok || !m.active[i] || m.stopped[i] {
+			continue
+		}
+
+		err := m.result(i, keyInfoHandler.HandleKeyInfo(info))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
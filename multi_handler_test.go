@@ -0,0 +1,196 @@
+package rdb
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiHandler(t *testing.T) {
+	for _, name := range []string{"all-types.rdb", "stream-with-pel.rdb", "expiretime-sec.rdb", "function.rdb"} {
+		t.Run(name, func(t *testing.T) {
+			expected := newDummyDB()
+			err := ReadFile(filepath.Join(dumpsPath, name), expected)
+			require.NoError(t, err)
+
+			db1 := newDummyDB()
+			db2 := newDummyDB()
+			err = ReadFile(filepath.Join(dumpsPath, name), NewMultiHandler(db1, db2))
+			require.NoError(t, err)
+
+			require.Equal(t, expected, db1)
+			require.Equal(t, expected, db2)
+		})
+	}
+}
+
+func TestMultiHandler_multiDB(t *testing.T) {
+	multi := newMultiDummyDB()
+	db := newDummyDB()
+	db.partialRead = true
+	err := ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), NewMultiHandler(multi, db))
+	require.NoError(t, err)
+
+	require.Equal(t, []uint64{0, 1}, multi.selected)
+	require.Equal(t, map[string][]uint64{"00": {0, 1}}, multi.stringDBs)
+
+	expected := newDummyDB()
+	expected.partialRead = true
+	expected.strings["00"] = "a"
+	require.Equal(t, expected, db)
+
+	db = newDummyDB()
+	err = ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), NewMultiHandler(newMultiDummyDB(), db))
+	require.ErrorContains(t, err, "multiple databases are not supported when the partial restore is not allowed")
+}
+
+func TestMultiHandler_aux(t *testing.T) {
+	aux := &auxDummyDB{dummyDB: newDummyDB()}
+	err := ReadFile(filepath.Join(dumpsPath, "disabled-crc.rdb"), NewMultiHandler(newDummyDB(), aux))
+	require.NoError(t, err)
+	require.NotEmpty(t, aux.aux)
+}
+
+type failingListDB struct {
+	*dummyDB
+}
+
+func (db *failingListDB) ListEntryHandler(key string) func(string) error {
+	return func(elem string) error {
+		return errors.New("failed to handle the list")
+	}
+}
+
+func TestMultiHandler_error(t *testing.T) {
+	db := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), NewMultiHandler(&failingListDB{newDummyDB()}, db))
+	require.ErrorContains(t, err, "failed to handle the list")
+	require.Empty(t, db.lists)
+}
+
+func TestMultiHandler_skipKey(t *testing.T) {
+	path := writeSkipTestFile(t)
+
+	skipper := &skipAfterDummyDB{dummyDB: newDummyDB(), n: 1}
+	db := newDummyDB()
+	err := ReadFile(path, NewMultiHandler(skipper, db))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"a"}, skipper.lists["list"])
+	require.Empty(t, skipper.listEntriesRead)
+	require.Equal(t, []string{"a", "b", "c"}, db.lists["list"])
+	require.Equal(t, uint64(3), db.listEntriesRead["list"])
+	require.Len(t, db.streamEntries["stream"], 3)
+
+	// once all the handlers skip the key, it is skipped by the reader
+	skipper1 := &skipAfterDummyDB{dummyDB: newDummyDB(), n: 1}
+	skipper2 := &skipAfterDummyDB{dummyDB: newDummyDB(), n: 2}
+	err = ReadFile(path, NewMultiHandler(skipper1, skipper2))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, skipper1.lists["list"])
+	require.Equal(t, []string{"a", "b"}, skipper2.lists["list"])
+	require.Equal(t, "value", skipper1.strings["after"])
+	require.Equal(t, "value", skipper2.strings["after"])
+}
+
+func TestMultiHandler_stop(t *testing.T) {
+	path := writeSkipTestFile(t)
+
+	stopper := &stopDummyDB{dummyDB: newDummyDB(), stopAt: "after"}
+	db := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), NewMultiHandler(&stopDummyDB{dummyDB: newDummyDB(), stopAt: "00"}, db))
+	require.NoError(t, err)
+	require.NotEmpty(t, db.lists)
+
+	err = ReadFile(path, NewMultiHandler(stopper, &stopDummyDB{dummyDB: newDummyDB(), stopAt: "after"}))
+	require.NoError(t, err)
+	require.Len(t, stopper.lists["list"], 3)
+}
+
+// skipBeginDB is a LifecycleHandler that skips the given keys once they begin.
+type skipBeginDB struct {
+	*lifecycleDummyDB
+	skip map[string]bool
+}
+
+func (db *skipBeginDB) HandleBegin(key string, t Type, length int64) error {
+	err := db.lifecycleDummyDB.HandleBegin(key, t, length)
+	if err != nil {
+		return err
+	}
+
+	if db.skip[key] {
+		return ErrSkipKey
+	}
+
+	return nil
+}
+
+func TestMultiHandler_skipKeyLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skip-lifecycle.rdb")
+
+	encoder, err := NewFileEncoder(path, version)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	list, err := encoder.BeginList("list", time.Time{})
+	require.NoError(t, err)
+	for _, elem := range []string{"a", "b", "c"} {
+		require.NoError(t, list.WriteFieldStr(elem))
+	}
+	require.NoError(t, list.Close())
+	require.NoError(t, encoder.WriteStringEntry("s1", "v1", time.Time{}))
+	require.NoError(t, encoder.WriteStringEntry("s2", "v2", time.Time{}))
+	require.NoError(t, encoder.Close())
+
+	newSkipper := func() *skipBeginDB {
+		return &skipBeginDB{
+			lifecycleDummyDB: &lifecycleDummyDB{dummyDB: newDummyDB()},
+			skip:             map[string]bool{"list": true, "s1": true},
+		}
+	}
+
+	alone := newSkipper()
+	require.NoError(t, ReadFile(path, alone))
+
+	multi := newSkipper()
+	require.NoError(t, ReadFile(path, NewMultiHandler(multi, nopHandler{})))
+
+	require.Equal(t, alone.events, multi.events)
+	require.Equal(t, alone.dummyDB, multi.dummyDB)
+	require.Equal(t, map[string]string{"s2": "v2"}, multi.strings)
+	require.Empty(t, multi.lists)
+}
+
+type skipAfterKeyInfoDB struct {
+	*skipAfterDummyDB
+	keys []string
+}
+
+func (db *skipAfterKeyInfoDB) HandleKeyInfo(info KeyInfo) error {
+	db.keys = append(db.keys, info.Key)
+	return nil
+}
+
+func TestMultiHandler_skipKeyInfo(t *testing.T) {
+	path := writeSkipTestFile(t)
+
+	newSkipper := func() *skipAfterKeyInfoDB {
+		return &skipAfterKeyInfoDB{
+			skipAfterDummyDB: &skipAfterDummyDB{dummyDB: newDummyDB(), n: 1},
+		}
+	}
+
+	alone := newSkipper()
+	require.NoError(t, ReadFile(path, alone))
+	require.Equal(t, []string{"list", "set", "zset", "hash", "hashex", "stream", "after"}, alone.keys)
+
+	// the KeyInfo of the skipped keys is received in the MultiHandler as well
+	multi := newSkipper()
+	require.NoError(t, ReadFile(path, NewMultiHandler(multi, newDummyDB())))
+	require.Equal(t, alone.keys, multi.keys)
+	require.Equal(t, alone.dummyDB, multi.dummyDB)
+}
@@ -0,0 +1,146 @@
+package rdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is the error returned when reading an RDB file or value fails,
+// with the location of the failure. The errors returned from the handlers are
+// wrapped in it as well. The cause of the error is available with errors.Is
+// and errors.As, as it is unwrapped by them.
+type ParseError struct {
+	// Offset is the offset of the byte in the file or the value payload,
+	// at which the failed read begins, or, for the elements of the encodings
+	// stored as strings such as the listpacks, the offset after the string.
+	Offset int64
+	// DB is the number of the database selected when the read failed.
+	DB uint64
+	// InEntry is true when the read failed while reading an entry,
+	// in which case its Type is set, and its Key is set if it is read.
+	InEntry bool
+	// Key is the key of the entry.
+	Key string
+	// Type is the type of the entry.
+	Type Type
+	// Context is the path of the nested element being read within the
+	// value, such as "quicklist node 3 / listpack entry 17", if any.
+	Context string
+	// Err is the cause of the error.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Err.Error())
+	fmt.Fprintf(&sb, " (offset: %d, db: %d", e.Offset, e.DB)
+	if e.InEntry {
+		fmt.Fprintf(&sb, ", key: %q, type: %d", e.Key, e.Type)
+	}
+
+	if e.Context != "" {
+		sb.WriteString(", at: ")
+		sb.WriteString(e.Context)
+	}
+
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseTrace tracks the location of the reader, including the elements
+// nested in the value being read, such as the nodes of a quicklist and the
+// entries of their listpacks, so that the errors can be reported with the
+// location they occurred at. All of its methods are no-op when it is nil.
+type parseTrace struct {
+	db      uint64
+	inEntry bool
+	key     string
+	t       Type
+	frames  []parseFrame
+}
+
+// parseFrame is an element of a container, such as the 17th entry of a listpack.
+type parseFrame struct {
+	container string
+	index     int
+}
+
+// beginEntry starts tracking the entry of the given type, whose key is not read yet.
+func (t *parseTrace) beginEntry(typ Type) {
+	if t == nil {
+		return
+	}
+
+	t.inEntry = true
+	t.key = ""
+	t.t = typ
+	t.frames = t.frames[:0]
+}
+
+// endEntry stops tracking the entry, once it is read.
+func (t *parseTrace) endEntry() {
+	if t == nil {
+		return
+	}
+
+	t.inEntry = false
+	t.key = ""
+	t.frames = t.frames[:0]
+}
+
+// push starts tracking the elements of a container nested in the
+// current element, and returns its depth, to be passed to at and pop.
+func (t *parseTrace) push(container string) int {
+	if t == nil {
+		return 0
+	}
+
+	t.frames = append(t.frames, parseFrame{container: container})
+	return len(t.frames) - 1
+}
+
+// at sets the index of the element being read in the container with the
+// given depth, and stops tracking the containers nested in its previous element.
+func (t *parseTrace) at(depth int, index int) {
+	if t == nil {
+		return
+	}
+
+	t.frames = t.frames[:depth+1]
+	t.frames[depth].index = index
+}
+
+// pop stops tracking the container with the given depth, once its elements are read.
+func (t *parseTrace) pop(depth int) {
+	if t == nil {
+		return
+	}
+
+	t.frames = t.frames[:depth]
+}
+
+// wrap returns the error with the location tracked, unless it is nil.
+func (t *parseTrace) wrap(err error, offset int) error {
+	if err == nil || t == nil {
+		return err
+	}
+
+	parts := make([]string, len(t.frames))
+	for i, frame := range t.frames {
+		parts[i] = fmt.Sprintf("%s %d", frame.container, frame.index)
+	}
+
+	return &ParseError{
+		Offset:  int64(offset),
+		DB:      t.db,
+		InEntry: t.inEntry,
+		Key:     t.key,
+		Type:    t.t,
+		Context: strings.Join(parts, " / "),
+		Err:     err,
+	}
+}
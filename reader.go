@@ -16,32 +16,56 @@ func ReadValue(key string, payload []byte, handler ValueHandler) error {
 }
 
 func readValue(key string, payload []byte, handler ValueHandler, maxLz77StrLen uint64) error {
+	trace := &parseTrace{}
 	reader := valueReader{
 		buf:           newMemoryBackedBuffer(payload),
 		maxLz77StrLen: maxLz77StrLen,
+		trace:         trace,
 	}
 
 	t, err := reader.ReadType()
 	if err != nil {
-		return err
+		return trace.wrap(err, reader.buf.Pos())
+	}
+
+	trace.beginEntry(t)
+	trace.key = key
+	err = reader.readObject(key, t, handler)
+	if errors.Is(err, ErrStop) {
+		return nil
 	}
 
-	return reader.readObject(key, t, handler)
+	return trace.wrap(err, reader.buf.Pos())
 }
 
 var errZMUnexpectedEnd = errors.New("unexpected end of zipmap")
 var errZLUnexpectedEnd = errors.New("unexpected end of ziplist")
 var errLPUnexpectedEnd = errors.New("unexpected end of listpack")
 var errTooBigLz77String = errors.New("uncompressed length of the string is too big")
+var errLengthOutOfRange = errors.New("length is out of range")
 
 // valueReader provides ways of reading different RDB objects.
 // All reader methods advance the pointer by the amount of data read.
 type valueReader struct {
 	buf           buffer
 	maxLz77StrLen uint64
+	// set while reading a value for a LifecycleHandler
+	lifecycle *valueLifecycle
+	// tracks the location of the reader for the errors, if set
+	trace *parseTrace
 }
 
 func (r *valueReader) readObject(key string, t Type, handler ValueHandler) error {
+	if h, ok := handler.(LifecycleHandler); ok {
+		r.lifecycle = &valueLifecycle{
+			handler: h,
+			key:     key,
+			t:       t,
+		}
+		defer func() { r.lifecycle = nil }()
+	}
+
+	l := r.lifecycle
 	var err error
 	var read uint64
 	switch t {
@@ -49,28 +73,35 @@ func (r *valueReader) readObject(key string, t Type, handler ValueHandler) error
 		var value string
 		value, err = r.ReadString()
 		if err == nil {
-			err = handler.HandleString(key, value)
+			err = l.single()
+		}
+		if err == nil {
+			if h, ok := handler.(BytesHandler); ok {
+				err = h.HandleStringBytes(key, stringToBytes(value))
+			} else {
+				err = handler.HandleString(key, value)
+			}
 		}
 	case TypeList:
-		h := handler.ListEntryHandler(key)
-		read, err = r.ReadList(h)
+		h := listEntryHandler(handler, key, l)
+		read, err = r.ReadList(plainElem(h))
 		if err == nil {
 			handler.HandleListEnding(key, read)
 		}
 	case TypeSet:
-		h := handler.SetEntryHandler(key)
-		err = r.ReadSet(h)
+		h := setEntryHandler(handler, key, l)
+		err = r.ReadSet(plainElem(h))
 	case TypeZset:
-		h := handler.ZsetEntryHandler(key)
+		h := zsetEntryHandler(handler, key, l)
 		read, err = r.ReadZset(h)
 		if err == nil {
 			handler.HandleZsetEnding(key, read)
 		}
 	case TypeHash:
-		h := handler.HashEntryHandler(key)
+		h := hashEntryHandler(handler, key, l)
 		err = r.ReadHash(h)
 	case TypeZset2:
-		h := handler.ZsetEntryHandler(key)
+		h := zsetEntryHandler(handler, key, l)
 		read, err = r.ReadZset2(h)
 		if err == nil {
 			handler.HandleZsetEnding(key, read)
@@ -79,88 +110,249 @@ func (r *valueReader) readObject(key string, t Type, handler ValueHandler) error
 		var value string
 		var marker ModuleMarker
 		value, marker, err = r.ReadModule2(handler.AllowPartialRead())
+		if err == nil {
+			err = l.single()
+		}
 		if err == nil {
 			err = handler.HandleModule(key, value, marker)
 		}
 	case TypeHashZipmap:
-		h := handler.HashEntryHandler(key)
+		h := hashEntryHandler(handler, key, l)
 		err = r.ReadHashZipmap(h)
 	case TypeListZiplist:
-		h := handler.ListEntryHandler(key)
-		read, err = r.ReadListZiplist(h)
+		h := listEntryHandler(handler, key, l)
+		read, err = r.readListZiplist(h)
 		if err == nil {
 			handler.HandleListEnding(key, read)
 		}
 	case TypeSetIntset:
-		h := handler.SetEntryHandler(key)
-		err = r.ReadSetIntset(h)
+		h := setEntryHandler(handler, key, l)
+		err = r.readSetIntset(h)
 	case TypeZsetZiplist:
-		h := handler.ZsetEntryHandler(key)
+		h := zsetEntryHandler(handler, key, l)
 		read, err = r.ReadZsetZiplist(h)
 		if err == nil {
 			handler.HandleZsetEnding(key, read)
 		}
 	case TypeHashZiplist:
-		h := handler.HashEntryHandler(key)
+		h := hashEntryHandler(handler, key, l)
 		err = r.ReadHashZiplist(h)
 	case TypeListQuicklist:
-		h := handler.ListEntryHandler(key)
-		read, err = r.ReadListQuicklist(h)
+		h := listEntryHandler(handler, key, l)
+		read, err = r.readListQuicklist(h)
 		if err == nil {
 			handler.HandleListEnding(key, read)
 		}
 	case TypeStreamListpacks:
-		eh := handler.StreamEntryHandler(key)
-		gh := handler.StreamGroupHandler(key)
+		sk := &streamSkipper{}
+		eh := sk.entry(l.streamEntry(handler.StreamEntryHandler(key)))
+		gh := sk.group(l.streamGroup(handler.StreamGroupHandler(key)))
 		read, err = r.ReadStreamListpacks(eh, gh)
+		if err == nil && sk.skipped {
+			err = ErrSkipKey
+		}
 		if err == nil {
 			handler.HandleStreamEnding(key, read)
 		}
 	case TypeHashListpack:
-		h := handler.HashEntryHandler(key)
+		h := hashEntryHandler(handler, key, l)
 		err = r.ReadHashListpack(h)
 	case TypeZsetListpack:
-		h := handler.ZsetEntryHandler(key)
+		h := zsetEntryHandler(handler, key, l)
 		read, err = r.ReadZsetListpack(h)
 		if err == nil {
 			handler.HandleZsetEnding(key, read)
 		}
 	case TypeListQuicklist2:
-		h := handler.ListEntryHandler(key)
-		read, err = r.ReadListQuicklist2(h)
+		h := listEntryHandler(handler, key, l)
+		read, err = r.readListQuicklist2(h)
 		if err == nil {
 			handler.HandleListEnding(key, read)
 		}
 	case TypeStreamListpacks2:
-		eh := handler.StreamEntryHandler(key)
-		gh := handler.StreamGroupHandler(key)
+		sk := &streamSkipper{}
+		eh := sk.entry(l.streamEntry(handler.StreamEntryHandler(key)))
+		gh := sk.group(l.streamGroup(handler.StreamGroupHandler(key)))
 		read, err = r.ReadStreamListpacks2(eh, gh)
+		if err == nil && sk.skipped {
+			err = ErrSkipKey
+		}
 		if err == nil {
 			handler.HandleStreamEnding(key, read)
 		}
 	case TypeSetListpack:
-		h := handler.SetEntryHandler(key)
-		err = r.ReadSetListpack(h)
+		h := setEntryHandler(handler, key, l)
+		err = r.readSetListpack(h)
 	case TypeStreamListpacks3:
-		eh := handler.StreamEntryHandler(key)
-		gh := handler.StreamGroupHandler(key)
+		sk := &streamSkipper{}
+		eh := sk.entry(l.streamEntry(handler.StreamEntryHandler(key)))
+		gh := sk.group(l.streamGroup(handler.StreamGroupHandler(key)))
 		read, err = r.ReadStreamListpacks3(eh, gh)
+		if err == nil && sk.skipped {
+			err = ErrSkipKey
+		}
 		if err == nil {
 			handler.HandleStreamEnding(key, read)
 		}
 	case TypeHashMetadata:
-		h := handler.HashWithExpEntryHandler(key)
+		h := hashWithExpEntryHandler(handler, key, l)
 		err = r.ReadHashMetadata(h)
 	case TypeHashListpackEx:
-		h := handler.HashWithExpEntryHandler(key)
+		h := hashWithExpEntryHandler(handler, key, l)
 		err = r.ReadHashListpackEx(h)
 	default:
 		err = fmt.Errorf("unknown RDB object type %d", t)
 	}
 
+	if err == nil {
+		err = l.end()
+	} else if errors.Is(err, ErrSkipKey) {
+		err = l.skip()
+	}
+
+	if errors.Is(err, ErrSkipKey) {
+		// the rest of the value is already skipped
+		return nil
+	}
+
 	return err
 }
 
+// listEntryHandler returns the function that is called for the each element
+// of the list, which passes the integer elements as int64 only if the handler
+// implements the IntEntryHandler, and the elements as byte slices if it
+// implements the BytesHandler.
+func listEntryHandler(handler ValueHandler, key string, l *valueLifecycle) func(string, int64, bool) error {
+	if h, ok := handler.(IntEntryHandler); ok {
+		return l.intElem(h.ListIntEntryHandler(key))
+	}
+
+	if h, ok := handler.(BytesHandler); ok {
+		return stringElem(l.elem(bytesElem(h.ListEntryBytesHandler(key))))
+	}
+
+	return stringElem(l.elem(handler.ListEntryHandler(key)))
+}
+
+// setEntryHandler is the same as the listEntryHandler, for the sets.
+func setEntryHandler(handler ValueHandler, key string, l *valueLifecycle) func(string, int64, bool) error {
+	if h, ok := handler.(IntEntryHandler); ok {
+		return l.intElem(h.SetIntEntryHandler(key))
+	}
+
+	if h, ok := handler.(BytesHandler); ok {
+		return stringElem(l.elem(bytesElem(h.SetEntryBytesHandler(key))))
+	}
+
+	return stringElem(l.elem(handler.SetEntryHandler(key)))
+}
+
+// zsetEntryHandler returns the function that is called for the each element of
+// the zset, which passes the elements as byte slices if the handler implements
+// the BytesHandler.
+func zsetEntryHandler(handler ValueHandler, key string, l *valueLifecycle) func(string, float64) error {
+	if h, ok := handler.(BytesHandler); ok {
+		cb := h.ZsetEntryBytesHandler(key)
+		return l.zsetElem(func(elem string, score float64) error {
+			return cb(stringToBytes(elem), score)
+		})
+	}
+
+	return l.zsetElem(handler.ZsetEntryHandler(key))
+}
+
+// hashEntryHandler is the same as the zsetEntryHandler, for the hashes.
+func hashEntryHandler(handler ValueHandler, key string, l *valueLifecycle) func(string, string) error {
+	if h, ok := handler.(BytesHandler); ok {
+		cb := h.HashEntryBytesHandler(key)
+		return l.hashElem(func(field, value string) error {
+			return cb(stringToBytes(field), stringToBytes(value), time.Time{})
+		})
+	}
+
+	return l.hashElem(handler.HashEntryHandler(key))
+}
+
+// hashWithExpEntryHandler is the same as the zsetEntryHandler,
+// for the hashes with the field expiration times.
+func hashWithExpEntryHandler(handler ValueHandler, key string, l *valueLifecycle) func(string, string, time.Time) error {
+	if h, ok := handler.(BytesHandler); ok {
+		cb := h.HashEntryBytesHandler(key)
+		return l.hashWithExpElem(func(field, value string, ttl time.Time) error {
+			return cb(stringToBytes(field), stringToBytes(value), ttl)
+		})
+	}
+
+	return l.hashWithExpElem(handler.HashWithExpEntryHandler(key))
+}
+
+// bytesElem returns the function that passes the
+// elements to the cb as byte slices.
+func bytesElem(cb func([]byte) error) func(string) error {
+	return func(elem string) error {
+		return cb(stringToBytes(elem))
+	}
+}
+
+// stringElem returns the function that converts the integer
+// elements to strings before passing them to the cb.
+func stringElem(cb func(string) error) func(string, int64, bool) error {
+	return func(elem string, intVal int64, isInt bool) error {
+		if isInt {
+			elem = strconv.FormatInt(intVal, 10)
+		}
+
+		return cb(elem)
+	}
+}
+
+// plainElem returns the function that passes the
+// elements that are always strings to the cb.
+func plainElem(cb func(string, int64, bool) error) func(string) error {
+	return func(elem string) error {
+		return cb(elem, 0, false)
+	}
+}
+
+// streamSkipper ignores the rest of the entries and the groups of the stream
+// once the handler returns ErrSkipKey, since they cannot be skipped without
+// being read.
+type streamSkipper struct {
+	skipped bool
+}
+
+func (s *streamSkipper) entry(cb func(StreamEntry) error) func(StreamEntry) error {
+	return func(entry StreamEntry) error {
+		if s.skipped {
+			return nil
+		}
+
+		err := cb(entry)
+		if errors.Is(err, ErrSkipKey) {
+			s.skipped = true
+			return nil
+		}
+
+		return err
+	}
+}
+
+func (s *streamSkipper) group(cb func(StreamConsumerGroup) error) func(StreamConsumerGroup) error {
+	return func(group StreamConsumerGroup) error {
+		if s.skipped {
+			return nil
+		}
+
+		err := cb(group)
+		if errors.Is(err, ErrSkipKey) {
+			s.skipped = true
+			return nil
+		}
+
+		return err
+	}
+}
+
 // ReadType returns the type of the RDB object.
 func (r *valueReader) ReadType() (Type, error) {
 	objType, err := r.readUint8()
@@ -326,6 +518,11 @@ func (r *valueReader) ReadList(cb func(string) error) (uint64, error) {
 		return 0, err
 	}
 
+	err = r.lifecycle.begin(int64(length))
+	if err != nil {
+		return 0, r.skipElements(err, int(length), r.skipString)
+	}
+
 	for i := 0; i < int(length); i++ {
 		elem, err := r.ReadString()
 		if err != nil {
@@ -334,7 +531,7 @@ func (r *valueReader) ReadList(cb func(string) error) (uint64, error) {
 
 		err = cb(elem)
 		if err != nil {
-			return 0, err
+			return 0, r.skipElements(err, int(length)-i-1, r.skipString)
 		}
 	}
 
@@ -354,6 +551,11 @@ func (r *valueReader) ReadSet(cb func(string) error) error {
 		return err
 	}
 
+	err = r.lifecycle.begin(int64(length))
+	if err != nil {
+		return r.skipElements(err, int(length), r.skipString)
+	}
+
 	for i := 0; i < int(length); i++ {
 		elem, err := r.ReadString()
 		if err != nil {
@@ -362,7 +564,7 @@ func (r *valueReader) ReadSet(cb func(string) error) error {
 
 		err = cb(elem)
 		if err != nil {
-			return err
+			return r.skipElements(err, int(length)-i-1, r.skipString)
 		}
 	}
 
@@ -389,6 +591,11 @@ func (r *valueReader) ReadZset(cb func(string, float64) error) (uint64, error) {
 		return 0, err
 	}
 
+	err = r.lifecycle.begin(int64(length))
+	if err != nil {
+		return 0, r.skipElements(err, int(length), r.skipZsetElem)
+	}
+
 	for i := 0; i < int(length); i++ {
 		elem, err := r.ReadString()
 		if err != nil {
@@ -422,7 +629,7 @@ func (r *valueReader) ReadZset(cb func(string, float64) error) (uint64, error) {
 
 		err = cb(elem, score)
 		if err != nil {
-			return 0, err
+			return 0, r.skipElements(err, int(length)-i-1, r.skipZsetElem)
 		}
 	}
 
@@ -443,6 +650,11 @@ func (r *valueReader) ReadHash(cb func(string, string) error) error {
 		return err
 	}
 
+	err = r.lifecycle.begin(int64(length))
+	if err != nil {
+		return r.skipElements(err, int(length), r.skipHashElem)
+	}
+
 	for i := 0; i < int(length); i++ {
 		field, err := r.ReadString()
 		if err != nil {
@@ -456,7 +668,7 @@ func (r *valueReader) ReadHash(cb func(string, string) error) error {
 
 		err = cb(field, value)
 		if err != nil {
-			return err
+			return r.skipElements(err, int(length)-i-1, r.skipHashElem)
 		}
 	}
 
@@ -477,6 +689,11 @@ func (r *valueReader) ReadZset2(cb func(string, float64) error) (uint64, error)
 		return 0, err
 	}
 
+	err = r.lifecycle.begin(int64(length))
+	if err != nil {
+		return 0, r.skipElements(err, int(length), r.skipZset2Elem)
+	}
+
 	for i := 0; i < int(length); i++ {
 		elem, err := r.ReadString()
 		if err != nil {
@@ -492,7 +709,7 @@ func (r *valueReader) ReadZset2(cb func(string, float64) error) (uint64, error)
 
 		err = cb(elem, score)
 		if err != nil {
-			return 0, err
+			return 0, r.skipElements(err, int(length)-i-1, r.skipZset2Elem)
 		}
 	}
 
@@ -586,7 +803,19 @@ func (r *valueReader) ReadHashZipmap(cb func(string, string) error) error {
 		limit = math.MaxInt
 	}
 
+	length := UnknownLength
+	if limit != math.MaxInt {
+		length = int64(limit)
+	}
+
+	err = r.lifecycle.begin(length)
+	if err != nil {
+		return err
+	}
+
+	depth := r.trace.push("zipmap entry")
 	for i := 0; i < limit; i++ {
+		r.trace.at(depth, i)
 		len0, err := reader.readUint8()
 		if err != nil {
 			return err
@@ -653,6 +882,7 @@ func (r *valueReader) ReadHashZipmap(cb func(string, string) error) error {
 			return err
 		}
 	}
+	r.trace.pop(depth)
 
 	// <zmlen> was < 254, we should read the <zmend>
 	zmend, err := reader.readUint8()
@@ -707,6 +937,12 @@ func (r *valueReader) ReadHashZipmap(cb func(string, string) error) error {
 //
 // <zlend> is always 255
 func (r *valueReader) ReadListZiplist(cb func(string) error) (uint64, error) {
+	return r.readListZiplist(stringElem(cb))
+}
+
+// readListZiplist reads the next list object in the same way as ReadListZiplist,
+// but the integer elements are passed to the cb as int64.
+func (r *valueReader) readListZiplist(cb func(string, int64, bool) error) (uint64, error) {
 	ziplist, err := r.ReadString()
 	if err != nil {
 		return 0, err
@@ -727,6 +963,11 @@ func (r *valueReader) ReadListZiplist(cb func(string) error) (uint64, error) {
 		return 0, err
 	}
 
+	err = r.lifecycle.begin(declaredLength(zllen, ziplistLenBig, 1))
+	if err != nil {
+		return 0, err
+	}
+
 	var limit int
 	if zllen == ziplistLenBig {
 		limit = math.MaxInt
@@ -734,8 +975,10 @@ func (r *valueReader) ReadListZiplist(cb func(string) error) (uint64, error) {
 		limit = int(zllen)
 	}
 
+	depth := r.trace.push("ziplist entry")
 	for i := 0; i < limit; i++ {
-		elem, err := reader.readZiplistEntry()
+		r.trace.at(depth, i)
+		elem, intVal, isInt, err := reader.readZiplistValue()
 
 		if err == errZLUnexpectedEnd && limit == math.MaxInt {
 			// The ziplist size was unbounded and we read <zlend>, as expected
@@ -746,11 +989,12 @@ func (r *valueReader) ReadListZiplist(cb func(string) error) (uint64, error) {
 			return 0, err
 		}
 
-		err = cb(elem)
+		err = cb(elem, intVal, isInt)
 		if err != nil {
 			return 0, err
 		}
 	}
+	r.trace.pop(depth)
 
 	// <zllen> was < 65535, we should read the <zlend>
 	zlend, err := reader.readUint8()
@@ -776,6 +1020,12 @@ func (r *valueReader) ReadListZiplist(cb func(string) error) (uint64, error) {
 // <len> is a 4 byte unsigned integer that describes the length of the set.
 // <elem> is either a 2, 4, or 8 bytes long signed integer.
 func (r *valueReader) ReadSetIntset(cb func(string) error) error {
+	return r.readSetIntset(stringElem(cb))
+}
+
+// readSetIntset reads the next set object in the same way as
+// ReadSetIntset, but the elements are passed to the cb as int64.
+func (r *valueReader) readSetIntset(cb func(string, int64, bool) error) error {
 	intset, err := r.ReadString()
 	if err != nil {
 		return err
@@ -796,36 +1046,44 @@ func (r *valueReader) ReadSetIntset(cb func(string) error) error {
 		return err
 	}
 
+	err = r.lifecycle.begin(int64(length))
+	if err != nil {
+		return err
+	}
+
+	depth := r.trace.push("intset entry")
 	for i := 0; i < int(length); i++ {
-		var elem int
+		r.trace.at(depth, i)
+		var elem int64
 		switch encoding {
 		case intsetEncInt16:
 			elem0, err := reader.readUint16()
 			if err != nil {
 				return err
 			}
-			elem = int(int16(elem0))
+			elem = int64(int16(elem0))
 		case intsetEncInt32:
 			elem0, err := reader.readUint32()
 			if err != nil {
 				return err
 			}
-			elem = int(int32(elem0))
+			elem = int64(int32(elem0))
 		case intsetEncInt64:
 			elem0, err := reader.readUint64()
 			if err != nil {
 				return err
 			}
-			elem = int(elem0)
+			elem = int64(elem0)
 		default:
 			return errors.New("unexpected intset encoding")
 		}
 
-		err = cb(strconv.Itoa(elem))
+		err = cb("", elem, true)
 		if err != nil {
 			return err
 		}
 	}
+	r.trace.pop(depth)
 
 	return nil
 }
@@ -855,6 +1113,11 @@ func (r *valueReader) ReadZsetZiplist(cb func(string, float64) error) (uint64, e
 		return 0, err
 	}
 
+	err = r.lifecycle.begin(declaredLength(zllen, ziplistLenBig, 2))
+	if err != nil {
+		return 0, err
+	}
+
 	var limit int
 	if zllen == ziplistLenBig {
 		limit = math.MaxInt
@@ -862,7 +1125,9 @@ func (r *valueReader) ReadZsetZiplist(cb func(string, float64) error) (uint64, e
 		limit = int(zllen)
 	}
 
+	depth := r.trace.push("ziplist entry")
 	for i := 0; i < limit; i += 2 {
+		r.trace.at(depth, i)
 		elem, err := reader.readZiplistEntry()
 
 		if err == errZLUnexpectedEnd && limit == math.MaxInt {
@@ -874,6 +1139,7 @@ func (r *valueReader) ReadZsetZiplist(cb func(string, float64) error) (uint64, e
 			return 0, err
 		}
 
+		r.trace.at(depth, i+1)
 		score0, err := reader.readZiplistEntry()
 		if err != nil {
 			return 0, err
@@ -889,6 +1155,7 @@ func (r *valueReader) ReadZsetZiplist(cb func(string, float64) error) (uint64, e
 			return 0, err
 		}
 	}
+	r.trace.pop(depth)
 
 	// <zllen> was < 65535, we should read the <zlend>
 	zlend, err := reader.readUint8()
@@ -928,6 +1195,11 @@ func (r *valueReader) ReadHashZiplist(cb func(string, string) error) error {
 		return err
 	}
 
+	err = r.lifecycle.begin(declaredLength(zllen, ziplistLenBig, 2))
+	if err != nil {
+		return err
+	}
+
 	var limit int
 	if zllen == ziplistLenBig {
 		limit = math.MaxInt
@@ -935,7 +1207,9 @@ func (r *valueReader) ReadHashZiplist(cb func(string, string) error) error {
 		limit = int(zllen)
 	}
 
+	depth := r.trace.push("ziplist entry")
 	for i := 0; i < limit; i += 2 {
+		r.trace.at(depth, i)
 		field, err := reader.readZiplistEntry()
 
 		if err == errZLUnexpectedEnd && limit == math.MaxInt {
@@ -947,6 +1221,7 @@ func (r *valueReader) ReadHashZiplist(cb func(string, string) error) error {
 			return err
 		}
 
+		r.trace.at(depth, i+1)
 		value, err := reader.readZiplistEntry()
 		if err != nil {
 			return err
@@ -957,6 +1232,7 @@ func (r *valueReader) ReadHashZiplist(cb func(string, string) error) error {
 			return err
 		}
 	}
+	r.trace.pop(depth)
 
 	// <zllen> was < 65535, we should read the <zlend>
 	zlend, err := reader.readUint8()
@@ -981,19 +1257,34 @@ func (r *valueReader) ReadHashZiplist(cb func(string, string) error) error {
 //
 // The list is the concatenation of all the elements in all the ziplists.
 func (r *valueReader) ReadListQuicklist(cb func(string) error) (uint64, error) {
+	return r.readListQuicklist(stringElem(cb))
+}
+
+// readListQuicklist reads the next list object in the same way as ReadListQuicklist,
+// but the integer elements are passed to the cb as int64.
+func (r *valueReader) readListQuicklist(cb func(string, int64, bool) error) (uint64, error) {
 	length, _, err := r.readLen()
 	if err != nil {
 		return 0, err
 	}
 
+	// the number of elements is not known until all the nodes are read
+	err = r.lifecycle.begin(UnknownLength)
+	if err != nil {
+		return 0, r.skipElements(err, int(length), r.skipString)
+	}
+
 	var totalRead uint64
+	depth := r.trace.push("quicklist node")
 	for i := 0; i < int(length); i++ {
-		read, err := r.ReadListZiplist(cb)
+		r.trace.at(depth, i)
+		read, err := r.readListZiplist(cb)
 		if err != nil {
-			return 0, err
+			return 0, r.skipElements(err, int(length)-i-1, r.skipString)
 		}
 		totalRead += read
 	}
+	r.trace.pop(depth)
 
 	return totalRead, nil
 }
@@ -1023,6 +1314,11 @@ func (r *valueReader) ReadHashListpack(cb func(string, string) error) error {
 		return err
 	}
 
+	err = r.lifecycle.begin(declaredLength(lplen, listpackLenBig, 2))
+	if err != nil {
+		return err
+	}
+
 	var limit int
 	if lplen == listpackLenBig {
 		limit = math.MaxInt
@@ -1030,7 +1326,9 @@ func (r *valueReader) ReadHashListpack(cb func(string, string) error) error {
 		limit = int(lplen)
 	}
 
+	depth := r.trace.push("listpack entry")
 	for i := 0; i < limit; i += 2 {
+		r.trace.at(depth, i)
 		field, err := reader.readListpackEntry()
 
 		if err == errLPUnexpectedEnd && limit == math.MaxInt {
@@ -1042,6 +1340,7 @@ func (r *valueReader) ReadHashListpack(cb func(string, string) error) error {
 			return err
 		}
 
+		r.trace.at(depth, i+1)
 		value, err := reader.readListpackEntry()
 		if err != nil {
 			return err
@@ -1052,6 +1351,7 @@ func (r *valueReader) ReadHashListpack(cb func(string, string) error) error {
 			return err
 		}
 	}
+	r.trace.pop(depth)
 
 	// <lplen> was < 65535, we should read the <lpend>
 	lpend, err := reader.readUint8()
@@ -1091,6 +1391,11 @@ func (r *valueReader) ReadZsetListpack(cb func(string, float64) error) (uint64,
 		return 0, err
 	}
 
+	err = r.lifecycle.begin(declaredLength(lplen, listpackLenBig, 2))
+	if err != nil {
+		return 0, err
+	}
+
 	var limit int
 	if lplen == listpackLenBig {
 		limit = math.MaxInt
@@ -1098,7 +1403,9 @@ func (r *valueReader) ReadZsetListpack(cb func(string, float64) error) (uint64,
 		limit = int(lplen)
 	}
 
+	depth := r.trace.push("listpack entry")
 	for i := 0; i < limit; i += 2 {
+		r.trace.at(depth, i)
 		elem, err := reader.readListpackEntry()
 
 		if err == errLPUnexpectedEnd && limit == math.MaxInt {
@@ -1110,6 +1417,7 @@ func (r *valueReader) ReadZsetListpack(cb func(string, float64) error) (uint64,
 			return 0, err
 		}
 
+		r.trace.at(depth, i+1)
 		score0, err := reader.readListpackEntry()
 		if err != nil {
 			return 0, err
@@ -1125,6 +1433,7 @@ func (r *valueReader) ReadZsetListpack(cb func(string, float64) error) (uint64,
 			return 0, err
 		}
 	}
+	r.trace.pop(depth)
 
 	// <lplen> was < 65535, we should read the <lpend>
 	lpend, err := reader.readUint8()
@@ -1153,13 +1462,27 @@ func (r *valueReader) ReadZsetListpack(cb func(string, float64) error) (uint64,
 // which means the <node-content> is a listpack.
 // The list is the concatenation of all the elements in all the list nodes.
 func (r *valueReader) ReadListQuicklist2(cb func(string) error) (uint64, error) {
+	return r.readListQuicklist2(stringElem(cb))
+}
+
+// readListQuicklist2 reads the next list object in the same way as ReadListQuicklist2,
+// but the integer elements are passed to the cb as int64.
+func (r *valueReader) readListQuicklist2(cb func(string, int64, bool) error) (uint64, error) {
 	length, _, err := r.readLen()
 	if err != nil {
 		return 0, err
 	}
 
+	// the number of elements is not known until all the nodes are read
+	err = r.lifecycle.begin(UnknownLength)
+	if err != nil {
+		return 0, r.skipElements(err, int(length), r.skipQuicklist2Node)
+	}
+
 	var totalRead uint64
+	depth := r.trace.push("quicklist node")
 	for i := 0; i < int(length); i++ {
+		r.trace.at(depth, i)
 		container, _, err := r.readLen()
 		if err != nil {
 			return 0, err
@@ -1172,21 +1495,22 @@ func (r *valueReader) ReadListQuicklist2(cb func(string) error) (uint64, error)
 
 		switch container {
 		case quicklist2NodePlain:
-			err = cb(data)
+			err = cb(data, 0, false)
 			if err != nil {
-				return 0, err
+				return 0, r.skipElements(err, int(length)-i-1, r.skipQuicklist2Node)
 			}
 			totalRead++
 		case quicklist2NodePacked:
 			read, err := r.readListpack(data, cb)
 			if err != nil {
-				return 0, err
+				return 0, r.skipElements(err, int(length)-i-1, r.skipQuicklist2Node)
 			}
 			totalRead += read
 		default:
 			return 0, errors.New("unexpected quicklist2 container")
 		}
 	}
+	r.trace.pop(depth)
 	return totalRead, nil
 }
 
@@ -1195,11 +1519,22 @@ func (r *valueReader) ReadListQuicklist2(cb func(string) error) (uint64, error)
 // It has the same structure as the listpack. The listpack consists of
 // set elements.
 func (r *valueReader) ReadSetListpack(cb func(string) error) error {
+	return r.readSetListpack(stringElem(cb))
+}
+
+// readSetListpack reads the next set object in the same way as ReadSetListpack,
+// but the integer elements are passed to the cb as int64.
+func (r *valueReader) readSetListpack(cb func(string, int64, bool) error) error {
 	listpack, err := r.ReadString()
 	if err != nil {
 		return err
 	}
 
+	err = r.lifecycle.begin(listpackLength(listpack))
+	if err != nil {
+		return err
+	}
+
 	_, err = r.readListpack(listpack, cb)
 	return err
 }
@@ -1337,6 +1672,11 @@ func (r *valueReader) ReadHashMetadata(cb func(string, string, time.Time) error)
 		return err
 	}
 
+	err = r.lifecycle.begin(int64(length))
+	if err != nil {
+		return r.skipElements(err, int(length), r.skipHashMetadataElem)
+	}
+
 	for i := 0; i < int(length); i++ {
 		expVal, _, err := r.readLen()
 		if err != nil {
@@ -1358,7 +1698,7 @@ func (r *valueReader) ReadHashMetadata(cb func(string, string, time.Time) error)
 
 		err = cb(field, value, exp)
 		if err != nil {
-			return err
+			return r.skipElements(err, int(length)-i-1, r.skipHashMetadataElem)
 		}
 	}
 
@@ -1398,6 +1738,11 @@ func (r *valueReader) ReadHashListpackEx(cb func(string, string, time.Time) erro
 		return err
 	}
 
+	err = r.lifecycle.begin(declaredLength(lplen, listpackLenBig, 3))
+	if err != nil {
+		return err
+	}
+
 	var limit int
 	if lplen == listpackLenBig {
 		limit = math.MaxInt
@@ -1406,7 +1751,9 @@ func (r *valueReader) ReadHashListpackEx(cb func(string, string, time.Time) erro
 	}
 
 	// Read entries in triplets (field, value, TTL)
+	depth := r.trace.push("listpack entry")
 	for i := 0; i < limit; i += 3 {
+		r.trace.at(depth, i)
 		field, err := reader.readListpackEntry()
 		if err == errLPUnexpectedEnd && limit == math.MaxInt {
 			// The listpack size was unbounded and we read <lpend>, as expected
@@ -1416,11 +1763,13 @@ func (r *valueReader) ReadHashListpackEx(cb func(string, string, time.Time) erro
 			return err
 		}
 
+		r.trace.at(depth, i+1)
 		value, err := reader.readListpackEntry()
 		if err != nil {
 			return err
 		}
 
+		r.trace.at(depth, i+2)
 		expStr, err := reader.readListpackEntry()
 		if err != nil {
 			return err
@@ -1435,6 +1784,7 @@ func (r *valueReader) ReadHashListpackEx(cb func(string, string, time.Time) erro
 			return err
 		}
 	}
+	r.trace.pop(depth)
 
 	// <lplen> was < 65535, we should read the <lpend>
 	lpend, err := reader.readUint8()
@@ -1487,7 +1837,7 @@ func (r *valueReader) ReadHashListpackEx(cb func(string, string, time.Time) erro
 //   - Otherwise, it is 5 bytes long
 //
 // <lpend> is always 255
-func (r *valueReader) readListpack(listpack string, cb func(string) error) (uint64, error) {
+func (r *valueReader) readListpack(listpack string, cb func(string, int64, bool) error) (uint64, error) {
 	reader := valueReader{
 		buf:           newMemoryBackedBuffer(stringToBytes(listpack)),
 		maxLz77StrLen: r.maxLz77StrLen,
@@ -1510,8 +1860,10 @@ func (r *valueReader) readListpack(listpack string, cb func(string) error) (uint
 		limit = int(lplen)
 	}
 
+	depth := r.trace.push("listpack entry")
 	for i := 0; i < limit; i++ {
-		entry, err := reader.readListpackEntry()
+		r.trace.at(depth, i)
+		entry, intVal, isInt, err := reader.readListpackValue()
 
 		if err == errLPUnexpectedEnd && limit == math.MaxInt {
 			// The listpack size was unbounded and we read <lpend>, as expected
@@ -1522,11 +1874,12 @@ func (r *valueReader) readListpack(listpack string, cb func(string) error) (uint
 			return 0, err
 		}
 
-		err = cb(entry)
+		err = cb(entry, intVal, isInt)
 		if err != nil {
 			return 0, err
 		}
 	}
+	r.trace.pop(depth)
 
 	// <lplen> was < 65535, we should read the <lpend>
 	lpend, err := reader.readUint8()
@@ -1542,23 +1895,39 @@ func (r *valueReader) readListpack(listpack string, cb func(string) error) (uint
 }
 
 func (r *valueReader) readListpackEntry() (string, error) {
-	encoding, err := r.readUint8()
+	entry, intVal, isInt, err := r.readListpackValue()
 	if err != nil {
 		return "", err
 	}
 
+	if isInt {
+		return strconv.FormatInt(intVal, 10), nil
+	}
+
+	return entry, nil
+}
+
+// readListpackValue reads the next listpack entry, and returns
+// the integer entries as int64, with the isInt flag set.
+func (r *valueReader) readListpackValue() (string, int64, bool, error) {
+	encoding, err := r.readUint8()
+	if err != nil {
+		return "", 0, false, err
+	}
+
 	if encoding == listpackEnd {
-		return "", errLPUnexpectedEnd
+		return "", 0, false, errLPUnexpectedEnd
 	}
 
-	var entry string
+	var intVal int64
+	isInt := true
 	if encoding&0x80 == listpackEncUint7 {
 		value := encoding & 0x7F
-		entry = strconv.Itoa(int(value))
+		intVal = int64(value)
 	} else if encoding&0xE0 == listpackEncInt13 {
 		valueLsb, err := r.readUint8()
 		if err != nil {
-			return "", err
+			return "", 0, false, err
 		}
 
 		value := int16(encoding&0x1F) << 8
@@ -1566,18 +1935,18 @@ func (r *valueReader) readListpackEntry() (string, error) {
 		// This is a signed integer, we need to shift right after setting the sign bit
 		value = (value << 3) >> 3
 
-		entry = strconv.Itoa(int(value))
+		intVal = int64(value)
 	} else if encoding == listpackEncInt16 {
 		val, err := r.readUint16()
 		if err != nil {
-			return "", err
+			return "", 0, false, err
 		}
 
-		entry = strconv.Itoa(int(int16(val)))
+		intVal = int64(int16(val))
 	} else if encoding == listpackEncInt24 {
 		valueBytes, err := r.read(3)
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
 		value := int32(valueBytes[0])
@@ -1586,33 +1955,34 @@ func (r *valueReader) readListpackEntry() (string, error) {
 		// This is a signed integer, we need to shift right after setting the sign bit
 		value = (value << 8) >> 8
 
-		entry = strconv.Itoa(int(value))
-
+		intVal = int64(value)
 	} else if encoding == listpackEncInt32 {
 		value, err := r.readUint32()
 		if err != nil {
-			return "", err
+			return "", 0, false, err
 		}
 
-		entry = strconv.Itoa(int(int32(value)))
+		intVal = int64(int32(value))
 	} else if encoding == listpackEncInt64 {
 		value, err := r.readUint64()
 		if err != nil {
-			return "", err
+			return "", 0, false, err
 		}
 
-		entry = strconv.Itoa(int(int64(value)))
+		intVal = int64(value)
+	} else {
+		isInt = false
 	}
 
-	if entry != "" {
+	if isInt {
 		// read an integer as the entry, we should skip
 		// 1 byte (because backlen is < 127) and return
 
 		if err := r.skip(1); err != nil {
-			return "", err
+			return "", 0, false, err
 		}
 
-		return entry, nil
+		return "", intVal, true, nil
 	}
 
 	var valueLen, backLen int
@@ -1622,7 +1992,7 @@ func (r *valueReader) readListpackEntry() (string, error) {
 	} else if encoding&0xF0 == listpackEnc12bitStrLen {
 		valueLenLsb, err := r.readUint8()
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
 		valueLen = int(encoding&0x0F)<<8 | int(valueLenLsb)
@@ -1630,18 +2000,18 @@ func (r *valueReader) readListpackEntry() (string, error) {
 	} else if encoding == listpackEnc32bitStrLen {
 		valueLen0, err := r.readUint32()
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
 		valueLen = int(valueLen0)
 		backLen = 5 + valueLen
 	} else {
-		return "", errors.New("unexpected listpack encoding")
+		return "", 0, false, errors.New("unexpected listpack encoding")
 	}
 
 	data, err := r.read(valueLen)
 	if err != nil {
-		return "", nil
+		return "", 0, false, err
 	}
 
 	var skip int
@@ -1658,30 +2028,45 @@ func (r *valueReader) readListpackEntry() (string, error) {
 	}
 
 	if err := r.skip(skip); err != nil {
-		return "", err
+		return "", 0, false, err
 	}
 
-	return bytesToString(data), nil
+	return bytesToString(data), 0, false, nil
 }
 
 func (r *valueReader) readZiplistEntry() (string, error) {
-	prevLen0, err := r.readUint8()
+	entry, intVal, isInt, err := r.readZiplistValue()
 	if err != nil {
 		return "", err
 	}
 
+	if isInt {
+		return strconv.FormatInt(intVal, 10), nil
+	}
+
+	return entry, nil
+}
+
+// readZiplistValue reads the next ziplist entry, and returns
+// the integer entries as int64, with the isInt flag set.
+func (r *valueReader) readZiplistValue() (string, int64, bool, error) {
+	prevLen0, err := r.readUint8()
+	if err != nil {
+		return "", 0, false, err
+	}
+
 	if prevLen0 == ziplistPrevLenBig {
 		err := r.skip(4)
 		if err != nil {
-			return "", err
+			return "", 0, false, err
 		}
 	} else if prevLen0 == ziplistEnd {
-		return "", errZLUnexpectedEnd
+		return "", 0, false, errZLUnexpectedEnd
 	}
 
 	encoding, err := r.readUint8()
 	if err != nil {
-		return "", err
+		return "", 0, false, err
 	}
 
 	length := -1
@@ -1691,7 +2076,7 @@ func (r *valueReader) readZiplistEntry() (string, error) {
 	case ziplistEnc14BitStrLen:
 		lengthLsb, err := r.readUint8()
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
 		length = int(encoding&0x3F) << 8
@@ -1699,7 +2084,7 @@ func (r *valueReader) readZiplistEntry() (string, error) {
 	case ziplistEnc32BitStrLen:
 		length0, err := r.readUint32BE()
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 		length = int(length0)
 	}
@@ -1707,10 +2092,10 @@ func (r *valueReader) readZiplistEntry() (string, error) {
 	if length != -1 {
 		data, err := r.read(int(length))
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
-		return bytesToString(data), nil
+		return bytesToString(data), 0, false, nil
 	}
 
 	// encoding & 0xC0 == 3, since length is read
@@ -1719,21 +2104,21 @@ func (r *valueReader) readZiplistEntry() (string, error) {
 	case ziplistEncInt8:
 		entry, err := r.readUint8()
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
-		return strconv.Itoa(int(int8(entry))), nil
+		return "", int64(int8(entry)), true, nil
 	case ziplistEncInt16:
 		entry, err := r.readUint16()
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
-		return strconv.Itoa(int(int16(entry))), nil
+		return "", int64(int16(entry)), true, nil
 	case ziplistEncInt24:
 		raw, err := r.read(3)
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
 		val := int32(raw[0]) << 8
@@ -1742,25 +2127,25 @@ func (r *valueReader) readZiplistEntry() (string, error) {
 		// This is a signed integer, we need to shift right after setting the sign bit
 		val >>= 8
 
-		return strconv.Itoa(int(val)), nil
+		return "", int64(val), true, nil
 	case ziplistEncInt32:
 		val, err := r.readUint32()
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
-		return strconv.Itoa(int(int32(val))), nil
+		return "", int64(int32(val)), true, nil
 	case ziplistEncInt64:
 		val, err := r.readUint64()
 		if err != nil {
-			return "", nil
+			return "", 0, false, err
 		}
 
-		return strconv.Itoa(int(int64(val))), nil
+		return "", int64(val), true, nil
 	default:
 		// 1111xxxx
 		// Unsigned int between 0 and 12, after extracting 1 from the last 4 bits
-		return strconv.Itoa(int(encoding - 0xF1)), nil
+		return "", int64(encoding - 0xF1), true, nil
 	}
 }
 
@@ -1829,6 +2214,15 @@ func (r *valueReader) read(n int) ([]byte, error) {
 }
 
 func (r *valueReader) skip(n int) error {
-	_, err := r.buf.Get(n)
-	return err
+	return r.buf.Discard(n)
+}
+
+// skipLen skips the number of bytes read from the payload, which
+// might be corrupt and larger than the bytes that can be read.
+func (r *valueReader) skipLen(length uint64) error {
+	if length > math.MaxInt {
+		return errLengthOutOfRange
+	}
+
+	return r.skip(int(length))
 }
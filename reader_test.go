@@ -1380,3 +1380,113 @@ func TestReadHashWithExpirationListpack(t *testing.T) {
 	assert.Equal(t, entry.value, "myvalue")
 	assert.WithinDuration(t, entry.exp, time.Unix(2216202057, 0), time.Second)
 }
+
+func TestValueReader_skipString(t *testing.T) {
+	payload := []byte{
+		0x03, 'f', 'o', 'o', // plain
+		0xC0, 0x01, // int8
+		0xC1, 0x01, 0x02, // int16
+		0xC2, 0x01, 0x02, 0x03, 0x04, // int32
+		0xC3, 0x02, 0x05, 0x00, 0x00, // lzf
+		0x03, 'b', 'a', 'r',
+	}
+
+	r := valueReader{
+		buf: newMemoryBackedBuffer(payload),
+	}
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, r.skipString())
+	}
+
+	value, err := r.ReadString()
+	require.NoError(t, err)
+	require.Equal(t, "bar", value)
+}
+
+func TestValueReader_truncatedEntries(t *testing.T) {
+	listpackEntries := map[string][]byte{
+		"int24":      {listpackEncInt24, 0x01},
+		"12bitLen":   {listpackEnc12bitStrLen},
+		"32bitLen":   {listpackEnc32bitStrLen, 0x01},
+		"6bitString": {listpackEnc6bitStrLen | 5, 'a'},
+	}
+	for name, entry := range listpackEntries {
+		t.Run("listpack "+name, func(t *testing.T) {
+			r := valueReader{
+				buf: newMemoryBackedBuffer(entry),
+			}
+
+			_, err := r.readListpackEntry()
+			require.Error(t, err)
+		})
+	}
+
+	ziplistEntries := map[string][]byte{
+		"14bitLen":   {0, ziplistEnc14BitStrLen},
+		"32bitLen":   {0, ziplistEnc32BitStrLen, 0x01},
+		"6bitString": {0, ziplistEnc6BitStrLen | 5, 'a'},
+		"int8":       {0, ziplistEncInt8},
+		"int16":      {0, ziplistEncInt16, 0x01},
+		"int24":      {0, ziplistEncInt24, 0x01},
+		"int32":      {0, ziplistEncInt32, 0x01},
+		"int64":      {0, ziplistEncInt64, 0x01},
+	}
+	for name, entry := range ziplistEntries {
+		t.Run("ziplist "+name, func(t *testing.T) {
+			r := valueReader{
+				buf: newMemoryBackedBuffer(entry),
+			}
+
+			_, err := r.readZiplistEntry()
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestValueReader_skipQuicklist2(t *testing.T) {
+	w := NewWriter()
+	require.NoError(t, w.WriteType(TypeListQuicklist2))
+	require.NoError(t, w.writeLen(3))
+	for _, elem := range []string{"a", "b", "c"} {
+		require.NoError(t, w.writeLen(quicklist2NodePlain))
+		require.NoError(t, w.WriteString(elem))
+	}
+	require.NoError(t, w.WriteString("after"))
+
+	r := valueReader{
+		buf: newMemoryBackedBuffer(w.GetBuffer()),
+	}
+
+	typ, err := r.ReadType()
+	require.NoError(t, err)
+	require.Equal(t, TypeListQuicklist2, typ)
+
+	db := &skipAfterDummyDB{dummyDB: newDummyDB(), n: 1}
+	err = r.readObject("list", typ, db)
+	require.NoError(t, err)
+
+	value, err := r.ReadString()
+	require.NoError(t, err)
+	require.Equal(t, "after", value)
+	require.Equal(t, []string{"a"}, db.lists["list"])
+	require.Empty(t, db.listEntriesRead)
+}
+
+func TestReadValue_parseError(t *testing.T) {
+	dump, err := os.ReadFile(filepath.Join(valueDumpsPath, "list-quicklist2-big.bin"))
+	require.NoError(t, err)
+
+	// the encoding of the 5th entry of the first listpack
+	dump[11+5*3] = listpackEnd
+
+	err = ReadValue("key", dump, newDummyDB())
+	require.ErrorIs(t, err, errLPUnexpectedEnd)
+
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	require.Equal(t, "key", parseErr.Key)
+	require.Equal(t, TypeListQuicklist2, parseErr.Type)
+	require.Equal(t, "quicklist node 0 / listpack entry 5", parseErr.Context)
+	require.Equal(t, int64(5+0x15b5), parseErr.Offset)
+}
@@ -0,0 +1,203 @@
+package rdb
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReplicaOptions configures the connection of a replica to its master.
+type ReplicaOptions struct {
+	// Username and Password are sent with the AUTH command, if the Password is set.
+	Username string
+	Password string
+	// ListeningPort is the port announced to the master with the REPLCONF command.
+	// The master only uses it to report the replica in the INFO output.
+	ListeningPort int
+	// TLSConfig is used to establish a TLS connection to the master, if set.
+	TLSConfig *tls.Config
+}
+
+// SyncFromMaster connects to the Redis-compatible master in the given address
+// as a replica, requests a full resynchronization, and reads the RDB file sent
+// by the master into the handler, in the same way as ReadReader. The connection
+// is closed after the file is read, the command stream of the master is not followed.
+func SyncFromMaster(ctx context.Context, addr string, handler FileHandler, opts ReplicaOptions) error {
+	return syncFromMaster(ctx, addr, opts, func(r *bufio.Reader) error {
+		_, err := ReadSyncPayload(r, handler)
+		return err
+	})
+}
+
+// DownloadFromMaster connects to the Redis-compatible master in the given address
+// as a replica, requests a full resynchronization, and saves the RDB file sent by
+// the master into the given path. The file is parsed while it is downloaded, so
+// that its CRC is verified. The file is removed if the download fails.
+func DownloadFromMaster(ctx context.Context, addr string, path string, opts ReplicaOptions) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = syncFromMaster(ctx, addr, opts, func(r *bufio.Reader) error {
+		payload, err := readSyncPayloadHeader(r)
+		if err != nil {
+			return err
+		}
+
+		w := bufio.NewWriterSize(file, 1<<20)
+		tee := io.TeeReader(payload, w)
+		err = readFile(ctx, newSizedForwardOnlyBuffer(tee, readerSize(payload)), nopHandler{}, 0, ReadOptions{})
+		if err != nil {
+			return err
+		}
+
+		// copy the bytes after the CRC, if any, as they are
+		_, err = io.Copy(w, payload)
+		if err != nil {
+			return err
+		}
+
+		return w.Flush()
+	})
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+func syncFromMaster(ctx context.Context, addr string, opts ReplicaOptions, read func(r *bufio.Reader) error) error {
+	conn, err := dial(ctx, addr, opts.TLSConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// closing the connection unblocks the reads and writes
+	// below when the context is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	r := bufio.NewReaderSize(conn, 1<<20)
+	err = replicaHandshake(conn, r, opts)
+	if err == nil {
+		err = read(r)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// replicaHandshake performs the handshake a replica does with its master,
+// and requests a full resynchronization.
+func replicaHandshake(w io.Writer, r *bufio.Reader, opts ReplicaOptions) error {
+	err := authenticate(w, r, opts.Username, opts.Password)
+	if err != nil {
+		return err
+	}
+
+	_, err = roundTrip(w, r, "PING")
+	if err != nil {
+		return err
+	}
+
+	_, err = roundTrip(w, r, "REPLCONF", "listening-port", strconv.Itoa(opts.ListeningPort))
+	if err != nil {
+		return err
+	}
+
+	_, err = roundTrip(w, r, "REPLCONF", "capa", "eof", "capa", "psync2")
+	if err != nil {
+		return err
+	}
+
+	// tells the master to close the connection after the file, instead
+	// of streaming the commands. it is not supported before Redis 7.0,
+	// hence the error replies are ignored.
+	_, err = roundTrip(w, r, "REPLCONF", "rdb-only", "1")
+	var respErr RESPError
+	if err != nil && !errors.As(err, &respErr) {
+		return err
+	}
+
+	reply, err := roundTrip(w, r, "PSYNC", "?", "-1")
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(reply, "FULLRESYNC") {
+		return fmt.Errorf("unexpected PSYNC reply %q", reply)
+	}
+
+	return nil
+}
+
+func roundTrip(w io.Writer, r *bufio.Reader, args ...string) (string, error) {
+	err := writeCommand(w, args...)
+	if err != nil {
+		return "", err
+	}
+
+	return readStatusReply(r)
+}
+
+// dial connects to the server in the given address, over
+// TLS if the config is set.
+func dial(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil {
+		tlsConn := tls.Client(conn, tlsConfig)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	return conn, nil
+}
+
+// authenticate sends the AUTH command, if the password is set.
+func authenticate(w io.Writer, r *bufio.Reader, username, password string) error {
+	if password == "" {
+		return nil
+	}
+
+	args := []string{"AUTH", password}
+	if username != "" {
+		args = []string{"AUTH", username, password}
+	}
+
+	_, err := roundTrip(w, r, args...)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package rdb
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMaster struct {
+	listener net.Listener
+	payload  []byte
+	eofMark  bool
+	password string
+	hang     bool
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFakeMaster(t *testing.T, name string, eofMark bool) *fakeMaster {
+	return &fakeMaster{
+		payload: readDump(t, name),
+		eofMark: eofMark,
+	}
+}
+
+func startFakeMaster(t *testing.T, name string, eofMark bool) *fakeMaster {
+	m := newFakeMaster(t, name, eofMark)
+	m.start(t)
+	return m
+}
+
+func (m *fakeMaster) start(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	m.listener = listener
+	go m.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+}
+
+func (m *fakeMaster) receivedCommands() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.commands
+}
+
+func (m *fakeMaster) addr() string {
+	return m.listener.Addr().String()
+}
+
+func (m *fakeMaster) serve() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go m.serveConn(conn)
+	}
+}
+
+func (m *fakeMaster) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authenticated := m.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+
+		elems := reply.([]any)
+		args := make([]string, len(elems))
+		for i, elem := range elems {
+			args[i] = elem.(string)
+		}
+
+		m.mu.Lock()
+		m.commands = append(m.commands, strings.Join(args, " "))
+		m.mu.Unlock()
+
+		switch {
+		case args[0] == "AUTH":
+			if args[len(args)-1] != m.password {
+				_, _ = conn.Write([]byte("-WRONGPASS invalid username-password pair\r\n"))
+				continue
+			}
+			authenticated = true
+			_, _ = conn.Write([]byte("+OK\r\n"))
+		case !authenticated:
+			_, _ = conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+		case args[0] == "PING":
+			_, _ = conn.Write([]byte("+PONG\r\n"))
+		case args[0] == "REPLCONF" && args[1] == "rdb-only":
+			_, _ = conn.Write([]byte("-ERR Unrecognized REPLCONF option: rdb-only\r\n"))
+		case args[0] == "REPLCONF":
+			_, _ = conn.Write([]byte("+OK\r\n"))
+		case args[0] == "PSYNC":
+			_, _ = conn.Write([]byte("+FULLRESYNC 8de1787ba490483314a4d30f1c628bc5025eb761 0\r\n\n"))
+			if m.hang {
+				_, _ = r.ReadByte()
+				return
+			}
+
+			if m.eofMark {
+				_, _ = conn.Write(eofMarkFramed(m.payload))
+			} else {
+				_, _ = conn.Write(lengthFramed(m.payload))
+			}
+			return
+		default:
+			_, _ = conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+func TestSyncFromMaster(t *testing.T) {
+	expected := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), expected)
+	require.NoError(t, err)
+
+	for _, eofMark := range []bool{false, true} {
+		m := startFakeMaster(t, "all-types.rdb", eofMark)
+
+		db := newDummyDB()
+		err = SyncFromMaster(context.Background(), m.addr(), db, ReplicaOptions{ListeningPort: 6380})
+		require.NoError(t, err)
+		require.Equal(t, expected, db)
+
+		expectedCommands := []string{
+			"PING",
+			"REPLCONF listening-port 6380",
+			"REPLCONF capa eof capa psync2",
+			"REPLCONF rdb-only 1",
+			"PSYNC ? -1",
+		}
+		require.Equal(t, expectedCommands, m.receivedCommands())
+	}
+}
+
+func TestSyncFromMaster_auth(t *testing.T) {
+	m := newFakeMaster(t, "all-types.rdb", false)
+	m.password = "secret"
+	m.start(t)
+
+	err := SyncFromMaster(context.Background(), m.addr(), newDummyDB(), ReplicaOptions{})
+	require.ErrorContains(t, err, "NOAUTH")
+
+	err = SyncFromMaster(context.Background(), m.addr(), newDummyDB(), ReplicaOptions{Password: "wrong"})
+	require.ErrorContains(t, err, "WRONGPASS")
+
+	err = SyncFromMaster(context.Background(), m.addr(), newDummyDB(), ReplicaOptions{Username: "default", Password: "secret"})
+	require.NoError(t, err)
+}
+
+func TestSyncFromMaster_contextDone(t *testing.T) {
+	m := newFakeMaster(t, "all-types.rdb", false)
+	m.hang = true
+	m.start(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := SyncFromMaster(ctx, m.addr(), newDummyDB(), ReplicaOptions{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDownloadFromMaster(t *testing.T) {
+	for _, eofMark := range []bool{false, true} {
+		m := startFakeMaster(t, "all-types.rdb", eofMark)
+
+		path := filepath.Join(t.TempDir(), "dump.rdb")
+		err := DownloadFromMaster(context.Background(), m.addr(), path, ReplicaOptions{})
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, m.payload, data)
+	}
+}
+
+func TestDownloadFromMaster_badCRC(t *testing.T) {
+	m := startFakeMaster(t, "bad-crc.rdb", true)
+
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	err := DownloadFromMaster(context.Background(), m.addr(), path, ReplicaOptions{})
+	require.ErrorContains(t, err, "wrong CRC at the end of the RDB file")
+
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,192 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const eofMarkLen = 40
+
+// ReadSyncPayload reads the RDB file sent by a master to its replica during
+// a full resynchronization from the given reader, and calls the appropriate
+// methods of the handler for the objects read, in the same way as ReadReader.
+//
+// The payload is framed in one of the following forms:
+// - $<len>\r\n<payload>, where the <len> is the length of the <payload>
+// - $EOF:<mark>\r\n<payload><mark>, where the <mark> is 40 random bytes, which
+// is used by the masters configured with the diskless replication
+//
+// The reader might start with the empty lines the master sends as keepalives
+// while preparing the payload, or with the +FULLRESYNC reply of the PSYNC command.
+// Both of them are skipped.
+//
+// It returns a buffered reader positioned at the command stream that follows
+// the payload, which must be used instead of the given reader afterwards.
+func ReadSyncPayload(r io.Reader, handler FileHandler) (*bufio.Reader, error) {
+	br := bufio.NewReader(r)
+
+	payload, err := readSyncPayloadHeader(br)
+	if err != nil {
+		return br, err
+	}
+
+	err = readFile(context.Background(), newForwardOnlyBuffer(payload), handler, 0, ReadOptions{})
+	if err != nil {
+		return br, err
+	}
+
+	// the bytes after the EOF opcode and the CRC are not interpreted
+	// by Redis either, but we have to skip them to reach the commands.
+	_, err = io.Copy(io.Discard, payload)
+	return br, err
+}
+
+// readSyncPayloadHeader reads the framing header of the payload, and returns
+// a reader that reaches EOF at the end of the payload.
+func readSyncPayloadHeader(br *bufio.Reader) (io.Reader, error) {
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		switch {
+		case line == "":
+			// keepalive sent by the master while the payload is being prepared
+			continue
+		case strings.HasPrefix(line, "+FULLRESYNC"):
+			continue
+		case strings.HasPrefix(line, "-"):
+			return nil, errors.New(line[1:])
+		case strings.HasPrefix(line, "$EOF:"):
+			mark := line[len("$EOF:"):]
+			if len(mark) != eofMarkLen {
+				return nil, fmt.Errorf("unexpected EOF mark length %d", len(mark))
+			}
+
+			return &eofMarkReader{
+				reader: br,
+				mark:   []byte(mark),
+			}, nil
+		case strings.HasPrefix(line, "$"):
+			length, err := strconv.ParseInt(line[1:], 10, 64)
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("unexpected payload length %q", line[1:])
+			}
+
+			return &exactReader{
+				reader:    br,
+				remaining: length,
+			}, nil
+		default:
+			return nil, fmt.Errorf("unexpected sync payload header %q", line)
+		}
+	}
+}
+
+// exactReader reads exactly the remaining bytes from the reader, and returns
+// io.ErrUnexpectedEOF if the reader ends before that.
+type exactReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *exactReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// Len returns the number of bytes left in the payload.
+func (r *exactReader) Len() int {
+	if r.remaining > math.MaxInt {
+		return -1
+	}
+	return int(r.remaining)
+}
+
+// eofMarkReader reads from the reader until the mark, and consumes
+// the mark before returning io.EOF.
+type eofMarkReader struct {
+	reader *bufio.Reader
+	mark   []byte
+	// number of the buffered bytes that are known to be
+	// before the mark, hence can be returned as they are.
+	safe int
+	done bool
+}
+
+func (r *eofMarkReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+
+	if r.safe == 0 {
+		err := r.scan()
+		if err != nil {
+			return 0, err
+		}
+
+		if r.done {
+			return 0, io.EOF
+		}
+	}
+
+	if len(p) > r.safe {
+		p = p[:r.safe]
+	}
+
+	n, err := r.reader.Read(p)
+	r.safe -= n
+	return n, err
+}
+
+func (r *eofMarkReader) scan() error {
+	// the payload is always followed by the mark, so it is safe to
+	// wait for at least the mark length bytes.
+	buf, err := r.reader.Peek(maxInt(r.reader.Buffered(), eofMarkLen))
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	idx := bytes.Index(buf, r.mark)
+	switch {
+	case idx == 0:
+		r.done = true
+		_, err = r.reader.Discard(eofMarkLen)
+		return err
+	case idx > 0:
+		r.safe = idx
+	default:
+		// the mark might start in the last mark length - 1 bytes
+		r.safe = len(buf) - eofMarkLen + 1
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package rdb
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testEOFMark = "0123456789abcdefghijklmnopqrstuvwxyzABCD"
+
+const commandStream = "*1\r\n$4\r\nPING\r\n"
+
+func readDump(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join(dumpsPath, name))
+	require.NoError(t, err)
+	return data
+}
+
+func lengthFramed(payload []byte) []byte {
+	framed := []byte("$" + strconv.Itoa(len(payload)) + "\r\n")
+	return append(framed, payload...)
+}
+
+func eofMarkFramed(payload []byte) []byte {
+	framed := []byte("$EOF:" + testEOFMark + "\r\n")
+	framed = append(framed, payload...)
+	return append(framed, testEOFMark...)
+}
+
+func TestReadSyncPayload(t *testing.T) {
+	payload := readDump(t, "all-types.rdb")
+	expected := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "all-types.rdb"), expected)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		stream []byte
+	}{
+		{
+			name:   "length",
+			stream: lengthFramed(payload),
+		},
+		{
+			name:   "eof mark",
+			stream: eofMarkFramed(payload),
+		},
+		{
+			name:   "keepalives and fullresync",
+			stream: append([]byte("+FULLRESYNC 8de1787ba490483314a4d30f1c628bc5025eb761 42\r\n\n\n"), eofMarkFramed(payload)...),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stream := append(tc.stream, commandStream...)
+
+			db := newDummyDB()
+			r, err := ReadSyncPayload(iotest.OneByteReader(bytes.NewReader(stream)), db)
+			require.NoError(t, err)
+			require.Equal(t, expected, db)
+
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, commandStream, string(rest))
+		})
+	}
+}
+
+func TestReadSyncPayload_strictEOF(t *testing.T) {
+	// the file has some padding after the CRC
+	payload := readDump(t, "with-padding.rdb")
+
+	for _, stream := range [][]byte{lengthFramed(payload), eofMarkFramed(payload)} {
+		v := &verifier{
+			maxDataSize:      defaultMaxDataSize,
+			maxEntrySize:     defaultMaxEntrySize,
+			maxKeySize:       defaultMaxKeySize,
+			maxStreamPELSize: defaultMaxStreamPELSize,
+			maxLibrarySize:   defaultMaxLibrarySize,
+			requireStrictEOF: true,
+		}
+		_, err := ReadSyncPayload(bytes.NewReader(stream), v)
+		require.ErrorContains(t, err, "required file to end after eof opcode")
+
+		v.requireStrictEOF = false
+		r, err := ReadSyncPayload(bytes.NewReader(append(stream, commandStream...)), v)
+		require.NoError(t, err)
+
+		rest, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, commandStream, string(rest))
+	}
+}
+
+func TestReadSyncPayload_truncated(t *testing.T) {
+	payload := readDump(t, "all-types.rdb")
+
+	for _, stream := range [][]byte{lengthFramed(payload), eofMarkFramed(payload)} {
+		_, err := ReadSyncPayload(bytes.NewReader(stream[:len(stream)-10]), newDummyDB())
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestReadSyncPayload_badHeader(t *testing.T) {
+	_, err := ReadSyncPayload(bytes.NewReader([]byte("-ERR unknown command\r\n")), newDummyDB())
+	require.ErrorContains(t, err, "ERR unknown command")
+
+	_, err = ReadSyncPayload(bytes.NewReader([]byte("$EOF:short\r\n")), newDummyDB())
+	require.ErrorContains(t, err, "unexpected EOF mark length")
+
+	_, err = ReadSyncPayload(bytes.NewReader([]byte("*1\r\n")), newDummyDB())
+	require.ErrorContains(t, err, "unexpected sync payload header")
+}
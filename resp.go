@@ -0,0 +1,346 @@
+package rdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RESPError is an error reply sent by a Redis-compatible server.
+type RESPError string
+
+func (e RESPError) Error() string {
+	return string(e)
+}
+
+var errRESPProtocol = errors.New("RESP protocol error")
+
+// the largest length of the bulk strings read, which is the
+// default "proto-max-bulk-len" of Redis.
+const maxBulkLen = 512 << 20
+
+// the largest number of elements of the aggregate replies read.
+const maxAggregateLen = 1 << 20
+
+// the largest number of the aggregate replies nested in each other.
+const maxReplyDepth = 32
+
+// the largest number of elements allocated up front for the aggregate
+// replies, the rest are allocated as the elements are read.
+const aggregatePrealloc = 1 << 10
+
+// writeCommand writes the given arguments as a RESP array of bulk strings.
+func writeCommand(w io.Writer, args ...string) error {
+	n := 16
+	for _, arg := range args {
+		n += len(arg) + 16
+	}
+
+	buf := make([]byte, 0, n)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// readLine reads a single CRLF terminated line, without the terminator.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errRESPProtocol
+	}
+
+	return line[:len(line)-2], nil
+}
+
+// readReply reads a single RESP2 or RESP3 reply. Simple and bulk strings are
+// returned as strings, integers as int64, doubles as float64, booleans as bool,
+// arrays and sets as []any, maps as []any of key value pairs back to back, and
+// null replies as nil. Error replies are returned as the value of type RESPError,
+// not as the error.
+func readReply(r *bufio.Reader) (any, error) {
+	return readNestedReply(r, 0)
+}
+
+// readNestedReply reads a reply nested in the given number of aggregate replies.
+func readNestedReply(r *bufio.Reader, depth int) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if line == "" {
+		return nil, errRESPProtocol
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return RESPError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, errRESPProtocol
+		}
+
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, errRESPProtocol
+		}
+
+		if n == -1 {
+			return nil, nil
+		}
+
+		if n > maxBulkLen {
+			return nil, fmt.Errorf("%w: bulk length %d exceeds the limit", errRESPProtocol, n)
+		}
+
+		buf := make([]byte, n+2)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		if buf[n] != '\r' || buf[n+1] != '\n' {
+			return nil, errRESPProtocol
+		}
+
+		return bytesToString(buf[:n]), nil
+	case '_':
+		return nil, nil
+	case '#':
+		switch line[1:] {
+		case "t":
+			return true, nil
+		case "f":
+			return false, nil
+		default:
+			return nil, errRESPProtocol
+		}
+	case ',':
+		f, err := strconv.ParseFloat(line[1:], 64)
+		if err != nil {
+			return nil, errRESPProtocol
+		}
+
+		return f, nil
+	case '*', '~', '%':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, errRESPProtocol
+		}
+
+		if n == -1 {
+			return nil, nil
+		}
+
+		if n > maxAggregateLen {
+			return nil, fmt.Errorf("%w: aggregate length %d exceeds the limit", errRESPProtocol, n)
+		}
+
+		if depth == maxReplyDepth {
+			return nil, fmt.Errorf("%w: aggregate replies are nested too deeply", errRESPProtocol)
+		}
+
+		if line[0] == '%' {
+			n *= 2
+		}
+
+		elems := make([]any, 0, minInt(n, aggregatePrealloc))
+		for i := 0; i < n; i++ {
+			elem, err := readNestedReply(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			elems = append(elems, elem)
+		}
+
+		return elems, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected reply type %q", errRESPProtocol, line[0])
+	}
+}
+
+// readStatusReply reads a reply that is expected to be a simple string,
+// and returns it. Error replies are returned as errors.
+func readStatusReply(r *bufio.Reader) (string, error) {
+	reply, err := readReply(r)
+	if err != nil {
+		return "", err
+	}
+
+	switch reply := reply.(type) {
+	case string:
+		return reply, nil
+	case RESPError:
+		return "", reply
+	default:
+		return "", fmt.Errorf("%w: unexpected reply %v", errRESPProtocol, reply)
+	}
+}
+
+// readCommand reads a single command sent by a client as a
+// RESP array of bulk strings, and returns its arguments.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	reply, err := readReply(r)
+	if err != nil {
+		return nil, err
+	}
+
+	elems, ok := reply.([]any)
+	if !ok || len(elems) == 0 {
+		return nil, fmt.Errorf("%w: expected a command, got %v", errRESPProtocol, reply)
+	}
+
+	args := make([]string, len(elems))
+	for i, elem := range elems {
+		arg, ok := elem.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected a bulk string argument, got %v", errRESPProtocol, elem)
+		}
+
+		args[i] = arg
+	}
+
+	return args, nil
+}
+
+// writeStatusReply writes the given string as a simple string reply.
+func writeStatusReply(w io.Writer, s string) error {
+	_, err := io.WriteString(w, "+"+s+"\r\n")
+	return err
+}
+
+// writeErrorReply writes the given message as an error reply.
+func writeErrorReply(w io.Writer, msg string) error {
+	_, err := io.WriteString(w, "-"+msg+"\r\n")
+	return err
+}
+
+// respWriter writes the replies of a server in the RESP2 or RESP3 protocol.
+// The RESP3 types are written as their closest RESP2 counterparts in RESP2.
+type respWriter struct {
+	*bufio.Writer
+	proto int
+}
+
+func (w *respWriter) writeHeader(prefix byte, n int) {
+	_ = w.WriteByte(prefix)
+	_, _ = w.WriteString(strconv.Itoa(n))
+	_, _ = w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeStatus(s string) {
+	_ = w.WriteByte('+')
+	_, _ = w.WriteString(s)
+	_, _ = w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeError(msg string) {
+	_ = w.WriteByte('-')
+	_, _ = w.WriteString(msg)
+	_, _ = w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeInt(n int64) {
+	_ = w.WriteByte(':')
+	_, _ = w.WriteString(strconv.FormatInt(n, 10))
+	_, _ = w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeBulk(s string) {
+	w.writeHeader('$', len(s))
+	_, _ = w.WriteString(s)
+	_, _ = w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeNull() {
+	if w.proto == 3 {
+		_, _ = w.WriteString("_\r\n")
+		return
+	}
+
+	_, _ = w.WriteString("$-1\r\n")
+}
+
+func (w *respWriter) writeDouble(f float64) {
+	if w.proto == 3 {
+		_ = w.WriteByte(',')
+		_, _ = w.WriteString(formatDouble(f))
+		_, _ = w.WriteString("\r\n")
+		return
+	}
+
+	w.writeBulk(formatDouble(f))
+}
+
+func (w *respWriter) writeArray(n int) {
+	w.writeHeader('*', n)
+}
+
+// writeMap writes the header of a map with n key value pairs.
+func (w *respWriter) writeMap(n int) {
+	if w.proto == 3 {
+		w.writeHeader('%', n)
+		return
+	}
+
+	w.writeHeader('*', 2*n)
+}
+
+func (w *respWriter) writeSet(n int) {
+	if w.proto == 3 {
+		w.writeHeader('~', n)
+		return
+	}
+
+	w.writeHeader('*', n)
+}
+
+func (w *respWriter) writeBulkArray(elems []string) {
+	w.writeArray(len(elems))
+	for _, elem := range elems {
+		w.writeBulk(elem)
+	}
+}
+
+// formatDouble formats the float in the shortest form that represents
+// it exactly, such as 1, 1.5, or 1e+100, similar to Redis.
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,62 @@
+package rdb
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadReply(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*3\r\n$3\r\nfoo\r\n:42\r\n%1\r\n+a\r\n_\r\n"))
+	reply, err := readReply(r)
+	require.NoError(t, err)
+	require.Equal(t, []any{"foo", int64(42), []any{"a", nil}}, reply)
+}
+
+func TestReadReply_limits(t *testing.T) {
+	tests := map[string]string{
+		"max int bulk":      "$9223372036854775807\r\n",
+		"large bulk":        "$536870913\r\n",
+		"max int array":     "*9223372036854775807\r\n",
+		"large array":       "*1048577\r\n",
+		"max int map":       "%9223372036854775807\r\n",
+		"max int arg":       "*1\r\n$9223372036854775807\r\n",
+		"large arg":         "*1\r\n$536870913\r\n",
+		"large nested list": "*1\r\n*1048577\r\n",
+		"deeply nested":     strings.Repeat("*1\r\n", maxReplyDepth+1) + ":1\r\n",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(input))
+			_, err := readReply(r)
+			require.ErrorIs(t, err, errRESPProtocol)
+
+			r = bufio.NewReader(strings.NewReader(input))
+			_, err = readCommand(r)
+			require.ErrorIs(t, err, errRESPProtocol)
+		})
+	}
+}
+
+func TestReadReply_atLimit(t *testing.T) {
+	// the elements are read up to the limit
+	r := bufio.NewReader(strings.NewReader("*1048576\r\n"))
+	_, err := readReply(r)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestReadReply_nested(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(strings.Repeat("*1\r\n", maxReplyDepth) + ":1\r\n"))
+	reply, err := readReply(r)
+	require.NoError(t, err)
+
+	for i := 0; i < maxReplyDepth; i++ {
+		require.Len(t, reply, 1)
+		reply = reply.([]any)[0]
+	}
+	require.Equal(t, int64(1), reply)
+}
@@ -0,0 +1,446 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// the number of entries that must be read after an offset,
+// unless the file ends before them, to resume reading there.
+const salvageProbeEntries = 8
+
+// the number of bytes read from the file at once to probe the offsets.
+const salvageWindowCap = 64 << 10
+
+// SalvageReport is the result of salvaging an RDB file.
+type SalvageReport struct {
+	// Recovered is the number of entries read completely, including
+	// the ones that are filtered out by the options.
+	Recovered uint64
+	// Lost are the failures in the entries, in the order they occurred,
+	// each of which lost the entry with its DB, Type, and Key, if the
+	// key is read before the failure.
+	Lost []*ParseError
+	// Errors are the failures outside the entries, such as in the
+	// auxiliary fields or the CRC of the file, in the order they occurred.
+	Errors []*ParseError
+	// SkippedBytes is the number of bytes skipped after the failures,
+	// including the bytes of the lost entries.
+	SkippedBytes int64
+	// Truncated is true if no entry is found after the last failure, as
+	// happens when the file is truncated.
+	Truncated bool
+}
+
+// SalvageFile reads the RDB file in the given path in the same way as
+// ReadFileContext, but instead of returning the first error that occurs
+// while reading an entry, it records the entry as lost, and resumes reading
+// at the next offset that plausibly begins an entry, which is one where the
+// following entries can be read completely, with non-empty keys, without
+// exceeding the sizes declared for their databases, and without running past
+// the other offsets where the entries can be read. The entries read are passed
+// to the handler, and the report of the recovered and lost entries is returned.
+//
+// The handler might have received some of the elements of a lost entry
+// before the failure, without the ending callbacks of its value. The errors
+// returned from the handler, the errors of the context, and the failures to
+// read the header of the file are returned as they are, without salvaging
+// the rest of the file.
+func SalvageFile(ctx context.Context, path string, handler FileHandler, opts ReadOptions) (*SalvageReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fileLen := int(info.Size())
+	s := &salvager{
+		file:     file,
+		fileLen:  fileLen,
+		bufCap:   minInt(fileLen, 1<<20),
+		probeBuf: newSalvageProbeBuffer(file, fileLen),
+	}
+
+	return s.salvage(ctx, handler, opts)
+}
+
+type salvager struct {
+	file     *os.File
+	fileLen  int
+	bufCap   int
+	probeBuf *salvageProbeBuffer
+}
+
+func (s *salvager) salvage(ctx context.Context, handler FileHandler, opts ReadOptions) (*SalvageReport, error) {
+	var buf buffer = newFileBackedBuffer(s.file, s.fileLen, s.bufCap)
+	trace := &parseTrace{}
+	state, err := readHeader(buf)
+	if err != nil {
+		return nil, trace.wrap(err, buf.Pos())
+	}
+
+	report := &SalvageReport{}
+	for {
+		err = readBody(ctx, buf, handler, 0, opts, trace, state)
+		if err == nil || errors.Is(err, ErrStop) {
+			break
+		}
+
+		if err == ctx.Err() {
+			return nil, err
+		}
+
+		var perr *ParseError
+		errors.As(trace.wrap(err, buf.Pos()), &perr)
+		if errors.Is(err, errWrongCRC) {
+			// the entries are read already
+			report.Errors = append(report.Errors, perr)
+			break
+		}
+
+		start := state.pos
+		if _, ok := s.probe(ctx, start, state, 1); ok {
+			// the failure is not caused by the contents of the file
+			return nil, perr
+		}
+
+		if perr.InEntry {
+			report.Lost = append(report.Lost, perr)
+			// the lost entry might not be a key of the database,
+			// so it is not counted against the declared size
+			state.dbKeys--
+		} else {
+			report.Errors = append(report.Errors, perr)
+		}
+		trace.endEntry()
+
+		next, err := s.resync(ctx, start+1, state)
+		if err != nil {
+			return nil, err
+		}
+
+		if next < 0 {
+			report.Truncated = true
+			report.SkippedBytes += int64(s.fileLen - start)
+			break
+		}
+
+		report.SkippedBytes += int64(next - start)
+		fileBuf, err := newFileBackedBufferAt(s.file, s.fileLen, s.bufCap, next)
+		if err != nil {
+			return nil, err
+		}
+
+		// the CRC of the file cannot be calculated anymore
+		fileBuf.DoNotCalcCrc()
+		state.checkCRC = false
+		buf = fileBuf
+	}
+
+	report.Recovered = state.keys - uint64(len(report.Lost))
+	return report, nil
+}
+
+// resync returns the first offset starting from the given one, at which
+// reading can be resumed, or -1 if there is none until the end of the file.
+//
+// An offset is rejected when one of the entries read from it contains another
+// entry, which begins an offset where reading can be resumed as well. The
+// corrupt bytes often begin entries with the lengths that run past the
+// following entries, and reach the end of one of them by chance. The bytes
+// up to the next offset are counted as skipped instead.
+func (s *salvager) resync(ctx context.Context, from int, state *entriesState) (int, error) {
+	for offset := from; offset < s.fileLen; offset++ {
+		if (offset-from)%salvageWindowCap == 0 {
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			default:
+			}
+		}
+
+		spans, ok, err := s.plausible(ctx, offset, state)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok && !s.overlaps(ctx, spans, state) {
+			return offset, nil
+		}
+	}
+
+	return -1, nil
+}
+
+// plausible returns whether reading can be resumed at the given offset,
+// along with the spans of the entries read from it.
+func (s *salvager) plausible(ctx context.Context, offset int, state *entriesState) ([]salvageSpan, bool, error) {
+	s.probeBuf.reset(offset)
+	b, err := s.probeBuf.Get(1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !plausibleType(Type(b[0])) {
+		return nil, false, nil
+	}
+
+	spans, ok := s.probe(ctx, offset, state, salvageProbeEntries)
+	return spans, ok, nil
+}
+
+// overlaps returns whether reading can be resumed at an offset within one of
+// the given spans, whose first entry ends within the span as well.
+func (s *salvager) overlaps(ctx context.Context, spans []salvageSpan, state *entriesState) bool {
+	for _, span := range spans {
+		for offset := span.start + 1; offset < span.end; offset++ {
+			inner, ok, err := s.plausible(ctx, offset, state)
+			if err != nil || ctx.Err() != nil {
+				// the error is returned while resyncing the next offset
+				return true
+			}
+
+			if ok && len(inner) > 0 && inner[0].end <= span.end {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// probe returns whether the given number of entries with non-empty keys can
+// be read completely starting from the given offset, or the file ends properly
+// before them, along with the spans of the entries read. The entries are not
+// passed to the handler of the file.
+func (s *salvager) probe(ctx context.Context, offset int, state *entriesState, entries int) ([]salvageSpan, bool) {
+	s.probeBuf.reset(offset)
+	probeState := &entriesState{
+		endsWithCRC: state.endsWithCRC,
+		dbnum:       state.dbnum,
+		keys:        state.keys,
+		dbSize:      state.dbSize,
+		dbKeys:      state.dbKeys,
+	}
+	handler := &salvageProbeHandler{
+		buf:       s.probeBuf,
+		state:     probeState,
+		dbnum:     state.dbnum,
+		remaining: entries,
+	}
+
+	err := readBody(ctx, s.probeBuf, handler, 0, ReadOptions{}, &parseTrace{}, probeState)
+	return handler.spans, err == nil || errors.Is(err, ErrStop)
+}
+
+// plausibleType returns whether an entry or an opcode can begin with the given type.
+func plausibleType(t Type) bool {
+	switch t {
+	case 6, 8, TypeHashMetadataPreGa, TypeHashListpackExPreGa, typeOpCodeFunctionPreGA:
+		return false
+	default:
+		return t <= TypeHashListpackEx || t >= typeOpCodeFunction2
+	}
+}
+
+var errSalvageEmptyKey = errors.New("empty key")
+var errSalvageKeyCount = errors.New("more keys than the declared size of the database")
+var errSalvageOrder = errors.New("unexpected order of the sections")
+
+// salvageSpan is the range of the bytes of an entry or an auxiliary field
+// in the file, from its type to its end, without its optional metadata.
+type salvageSpan struct {
+	start, end int
+}
+
+// salvageProbeHandler decodes the entries read without keeping them,
+// and stops reading once the given number of entries are read. The
+// sections that are not written in the order Redis writes them are
+// rejected, as they are read from the corrupt bytes.
+type salvageProbeHandler struct {
+	BaseHandler
+	buf   *salvageProbeBuffer
+	state *entriesState
+	// the number of the database selected last
+	dbnum     uint64
+	remaining int
+	spans     []salvageSpan
+}
+
+func (h *salvageProbeHandler) RequireStrictEOF() bool {
+	return true
+}
+
+func (h *salvageProbeHandler) HandleSelectDB(dbnum uint64) error {
+	// the databases are written in the ascending order
+	if h.state.keys > 0 && dbnum <= h.dbnum {
+		return errSalvageOrder
+	}
+
+	h.dbnum = dbnum
+	return nil
+}
+
+func (h *salvageProbeHandler) HandleKeyInfo(info KeyInfo) error {
+	if info.Key == "" {
+		// the empty keys are valid, but they are much more likely
+		// to be read from the zeros of the corrupt data.
+		return errSalvageEmptyKey
+	}
+
+	if h.state.dbSize > 0 && h.state.dbKeys > h.state.dbSize {
+		return errSalvageKeyCount
+	}
+
+	h.span()
+	h.remaining--
+	if h.remaining == 0 {
+		return ErrStop
+	}
+
+	return nil
+}
+
+// The auxiliary fields are recorded as well, as their strings might run past
+// the following entries too. The fields and the libraries are written before
+// the entries, and the auxiliary data of the modules before or after them.
+
+func (h *salvageProbeHandler) HandleAux(key, value string) error {
+	if h.state.keys > 0 {
+		return errSalvageOrder
+	}
+
+	h.span()
+	return nil
+}
+
+func (h *salvageProbeHandler) HandleModuleAux(aux ModuleAux) error {
+	h.span()
+	return nil
+}
+
+func (h *salvageProbeHandler) HandleLibrary(code string) error {
+	if h.state.keys > 0 {
+		return errSalvageOrder
+	}
+
+	h.span()
+	return nil
+}
+
+// span records the span of the entry or the auxiliary field just read.
+func (h *salvageProbeHandler) span() {
+	h.spans = append(h.spans, salvageSpan{
+		start: h.state.pos,
+		end:   h.buf.Pos(),
+	})
+}
+
+// salvageProbeBuffer is the buffer the offsets are probed with. It keeps
+// a window of the file in memory, starting at or before the offset being
+// probed, so that the consecutive offsets are probed without reading the
+// file again. The bytes are read from the file only when a probe continues
+// past the window, and the skipped bytes are not read at all.
+type salvageProbeBuffer struct {
+	file    *os.File
+	fileLen int
+	// the bytes of the file starting at the windowPos
+	window    []byte
+	windowPos int
+	// the offset being probed
+	start int
+	pos   int
+}
+
+func newSalvageProbeBuffer(file *os.File, fileLen int) *salvageProbeBuffer {
+	return &salvageProbeBuffer{
+		file:    file,
+		fileLen: fileLen,
+	}
+}
+
+// reset makes the buffer read from the given offset.
+func (b *salvageProbeBuffer) reset(offset int) {
+	b.start = offset
+	b.pos = offset
+}
+
+func (b *salvageProbeBuffer) Get(n int) ([]byte, error) {
+	err := b.check(n)
+	if err != nil {
+		return nil, err
+	}
+
+	end := b.pos + n
+	if b.pos < b.windowPos || end > b.windowPos+len(b.window) {
+		// the window is read from the offset being probed, so that it
+		// covers the following offsets as well. a new slice is read, as
+		// the bytes returned from the previous window might still be used.
+		window := make([]byte, minInt(maxInt(end-b.start, salvageWindowCap), b.fileLen-b.start))
+		_, err := b.file.ReadAt(window, int64(b.start))
+		if err != nil {
+			return nil, err
+		}
+
+		b.window = window
+		b.windowPos = b.start
+	}
+
+	value := b.window[b.pos-b.windowPos : end-b.windowPos]
+	b.pos = end
+	return value, nil
+}
+
+func (b *salvageProbeBuffer) Discard(n int) error {
+	err := b.check(n)
+	if err != nil {
+		return err
+	}
+
+	b.pos += n
+	return nil
+}
+
+// check returns an error if there are not n bytes left in the file.
+func (b *salvageProbeBuffer) check(n int) error {
+	if n < 0 {
+		return errNegativeRead
+	}
+
+	if b.fileLen-b.pos < n {
+		if b.fileLen == b.pos {
+			return io.EOF
+		}
+
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+func (b *salvageProbeBuffer) Pos() int {
+	return b.pos
+}
+
+func (b *salvageProbeBuffer) SupportsView() bool {
+	return false
+}
+
+func (b *salvageProbeBuffer) View(_ int) (bufferView, error) {
+	return nil, nil
+}
+
+func (b *salvageProbeBuffer) DoNotCalcCrc() {
+	// nop
+}
+
+func (b *salvageProbeBuffer) Crc() uint64 {
+	return 0
+}
@@ -0,0 +1,266 @@
+package rdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSalvageFile(t *testing.T) {
+	db := newDummyDB()
+	report, err := SalvageFile(context.Background(), allTypesRDBPath, db, ReadOptions{})
+	require.NoError(t, err)
+
+	expected := newDummyDB()
+	require.NoError(t, ReadFile(allTypesRDBPath, expected))
+	require.Equal(t, expected, db)
+	require.Empty(t, report.Lost)
+	require.Empty(t, report.Errors)
+	require.Zero(t, report.SkippedBytes)
+	require.False(t, report.Truncated)
+	require.NotZero(t, report.Recovered)
+}
+
+func TestSalvageFile_badCRC(t *testing.T) {
+	db := newDummyDB()
+	report, err := SalvageFile(context.Background(), badCrcRDBPath, db, ReadOptions{})
+	require.NoError(t, err)
+
+	require.Empty(t, report.Lost)
+	require.Len(t, report.Errors, 1)
+	require.ErrorIs(t, report.Errors[0], errWrongCRC)
+	require.False(t, report.Truncated)
+	require.Zero(t, report.Recovered)
+}
+
+func TestSalvageFile_corruptValue(t *testing.T) {
+	value, err := os.ReadFile(filepath.Join(valueDumpsPath, "list-quicklist2-big.bin"))
+	require.NoError(t, err)
+
+	// the 17th entry of the first listpack is replaced with its end
+	value[11+17*3] = listpackEnd
+
+	file := []byte("REDIS0011")
+	file = append(file, byte(typeOpCodeSelectDB), 0)
+	file = append(file, byte(TypeString), 1, 'a', 3, 'f', 'o', 'o')
+	file = append(file, value[0], 4, 'l', 'i', 's', 't')
+	file = append(file, value[1:len(value)-10]...)
+	file = append(file, byte(typeOpCodeExpireTimeMS), 0, 0, 0, 0, 0, 0, 0, 0)
+	file = append(file, byte(TypeString), 1, 'b', 3, 'b', 'a', 'r')
+	file = append(file, byte(typeOpCodeEOF), 0, 0, 0, 0, 0, 0, 0, 0)
+
+	path := filepath.Join(t.TempDir(), "corrupt.rdb")
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	db := newDummyDB()
+	report, err := SalvageFile(context.Background(), path, db, ReadOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{"a": "foo", "b": "bar"}, db.strings)
+	require.Contains(t, db.expireTimes, "b")
+	require.Equal(t, uint64(2), report.Recovered)
+	require.Len(t, report.Lost, 1)
+	require.Equal(t, "list", report.Lost[0].Key)
+	require.Equal(t, TypeListQuicklist2, report.Lost[0].Type)
+	require.ErrorIs(t, report.Lost[0], errLPUnexpectedEnd)
+	require.Empty(t, report.Errors)
+	require.Equal(t, int64(len(value)-10+5), report.SkippedBytes)
+	require.False(t, report.Truncated)
+}
+
+func TestSalvageFile_truncated(t *testing.T) {
+	data, err := os.ReadFile(allTypesRDBPath)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "truncated.rdb")
+	require.NoError(t, os.WriteFile(path, data[:len(data)/2], 0644))
+
+	db := newDummyDB()
+	report, err := SalvageFile(context.Background(), path, db, ReadOptions{})
+	require.NoError(t, err)
+
+	require.True(t, report.Truncated)
+	require.Len(t, report.Lost, 1)
+	require.ErrorIs(t, report.Lost[0], io.ErrUnexpectedEOF)
+	require.NotZero(t, report.Recovered)
+	require.Empty(t, report.Errors)
+	require.NotContains(t, db.strings, report.Lost[0].Key)
+}
+
+func TestSalvageFile_garbage(t *testing.T) {
+	garbage := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(garbage)
+
+	file := []byte("REDIS0011")
+	file = append(file, byte(typeOpCodeSelectDB), 0)
+	file = append(file, byte(TypeString), 1, 'a', 3, 'f', 'o', 'o')
+	file = append(file, garbage...)
+	file = append(file, byte(TypeString), 1, 'b', 3, 'b', 'a', 'r')
+	file = append(file, byte(TypeString), 1, 'c', 3, 'b', 'a', 'z')
+	file = append(file, byte(typeOpCodeEOF), 0, 0, 0, 0, 0, 0, 0, 0)
+
+	path := filepath.Join(t.TempDir(), "garbage.rdb")
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	// the offsets in the garbage are probed without reading the file for each
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db := newDummyDB()
+	report, err := SalvageFile(ctx, path, db, ReadOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, "foo", db.strings["a"])
+	require.Equal(t, "bar", db.strings["b"])
+	require.Equal(t, "baz", db.strings["c"])
+	require.NotEmpty(t, append(report.Lost, report.Errors...))
+	require.GreaterOrEqual(t, report.SkippedBytes, int64(len(garbage)/2))
+	require.False(t, report.Truncated)
+}
+
+func TestSalvageFile_garbageInEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.rdb")
+	encoder, err := NewFileEncoder(path, saveRedisVersion)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Begin())
+
+	expected := make(map[string]string)
+	for i := 0; i < 20000; i++ {
+		key, value := fmt.Sprintf("key-%05d", i), fmt.Sprintf("value-%05d", i)
+		require.NoError(t, encoder.WriteStringEntry(key, value, time.Time{}))
+		expected[key] = value
+	}
+	require.NoError(t, encoder.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// the garbage is spliced after the key of an entry, and begins
+	// with a length that is larger than the file
+	entry := []byte("\x00\x09key-10000\x0bvalue-10000")
+	start := bytes.Index(data, entry)
+	require.Positive(t, start)
+	garbage := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(garbage)
+	garbage[0], garbage[1] = 0x81, 0x7f
+
+	splice := start + len("\x00\x09key-10000")
+	file := append([]byte{}, data[:splice]...)
+	file = append(file, garbage...)
+	file = append(file, data[splice:]...)
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	db := newDummyDB()
+	report, err := SalvageFile(context.Background(), path, db, ReadOptions{})
+	require.NoError(t, err)
+
+	// no key is read from the garbage
+	delete(expected, "key-10000")
+	require.Equal(t, expected, db.strings)
+	require.Empty(t, db.expireTimes)
+	require.Equal(t, uint64(len(expected)), report.Recovered)
+	require.Len(t, report.Lost, 1)
+	require.Equal(t, "key-10000", report.Lost[0].Key)
+	require.Empty(t, report.Errors)
+	require.Equal(t, int64(len(entry)+len(garbage)), report.SkippedBytes)
+	require.False(t, report.Truncated)
+}
+
+func TestSalvageFile_declaredDBSize(t *testing.T) {
+	file := []byte("REDIS0011")
+	file = append(file, byte(typeOpCodeSelectDB), 0)
+	file = append(file, byte(typeOpCodeResizeDB), 1, 0)
+	file = append(file, byte(TypeString), 1, 'a', 3, 'f', 'o', 'o')
+	file = append(file, byte(TypeList), 1, 'l', 0x80, 0xff, 0xff, 0xff, 0xff)
+	// the entry is read from the corrupt bytes, after
+	// all the keys of the database are read
+	file = append(file, byte(TypeString), 1, 'x', 3, 'b', 'a', 'd')
+	file = append(file, byte(typeOpCodeSelectDB), 1)
+	file = append(file, byte(typeOpCodeResizeDB), 1, 0)
+	file = append(file, byte(TypeString), 1, 'b', 3, 'b', 'a', 'r')
+	file = append(file, byte(typeOpCodeEOF), 0, 0, 0, 0, 0, 0, 0, 0)
+
+	path := filepath.Join(t.TempDir(), "dbsize.rdb")
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	db := newMultiDummyDB()
+	report, err := SalvageFile(context.Background(), path, db, ReadOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{"a": "foo", "b": "bar"}, db.strings)
+	require.Equal(t, map[string][]uint64{"a": {0}, "b": {1}}, db.stringDBs)
+	require.Equal(t, uint64(2), report.Recovered)
+	require.Len(t, report.Lost, 1)
+	require.Equal(t, "l", report.Lost[0].Key)
+	require.Equal(t, int64(8+7), report.SkippedBytes)
+}
+
+func TestSalvageProbeBuffer(t *testing.T) {
+	data := make([]byte, 3*salvageWindowCap)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	path := filepath.Join(t.TempDir(), "probe.bin")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	buf := newSalvageProbeBuffer(file, len(data))
+	buf.reset(10)
+	b, err := buf.Get(2)
+	require.NoError(t, err)
+	require.Equal(t, data[10:12], b)
+	window := buf.window
+
+	// the following offsets are probed from the same window
+	buf.reset(11)
+	b, err = buf.Get(4)
+	require.NoError(t, err)
+	require.Equal(t, data[11:15], b)
+	require.NoError(t, buf.Discard(2*salvageWindowCap))
+	require.Equal(t, 11+4+2*salvageWindowCap, buf.Pos())
+	require.Same(t, &window[0], &buf.window[0])
+
+	// the window is read from the offset being probed once the probe passes it
+	b, err = buf.Get(3)
+	require.NoError(t, err)
+	require.Equal(t, data[15+2*salvageWindowCap:18+2*salvageWindowCap], b)
+	require.Equal(t, 11, buf.windowPos)
+	require.Len(t, buf.window, 18+2*salvageWindowCap-11)
+
+	buf.reset(len(data) - 1)
+	_, err = buf.Get(2)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.ErrorIs(t, buf.Discard(2), io.ErrUnexpectedEOF)
+}
+
+func TestSalvageFile_handlerError(t *testing.T) {
+	errHandler := errors.New("handler error")
+	db := &stringErrorDummyDB{dummyDB: newDummyDB(), err: errHandler}
+	_, err := SalvageFile(context.Background(), allTypesRDBPath, db, ReadOptions{})
+	require.ErrorIs(t, err, errHandler)
+
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	require.Equal(t, "00", parseErr.Key)
+}
+
+func TestSalvageFile_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := SalvageFile(ctx, allTypesRDBPath, newDummyDB(), ReadOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+}
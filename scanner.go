@@ -0,0 +1,450 @@
+package rdb
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"iter"
+	"os"
+	"time"
+)
+
+// Entry is a key read by the Scanner, along with its metadata.
+type Entry struct {
+	// DB is the number of the database the key belongs to.
+	DB uint64
+	// Key is the name of the key.
+	Key string
+	// Kind is the logical type of the value.
+	Kind Kind
+	// ExpireTime is the expiration time of the key, or the zero time
+	// if the key does not expire.
+	ExpireTime time.Time
+	// Value is the value of the strings and the modules. It is empty
+	// for the collections, whose elements are read with Elements.
+	Value string
+	// Marker is the marker of the module values.
+	Marker ModuleMarker
+
+	scanner *Scanner
+}
+
+// Element is an element of a collection read by the Scanner.
+// The fields set depend on the kind of the collection:
+// - lists and sets have the Value
+// - sorted sets have the Value as the member, and the Score
+// - hashes have the Field and the Value, and the ExpireTime of the field
+// if it has one
+// - streams have either the StreamEntry or the StreamGroup, with the entries
+// of the stream before its consumer groups
+type Element struct {
+	Field       string
+	Value       string
+	Score       float64
+	ExpireTime  time.Time
+	StreamEntry *StreamEntry
+	StreamGroup *StreamConsumerGroup
+}
+
+// Elements returns an iterator over the elements of the collection, which
+// are read from the file lazily as the iterator advances. The elements can be
+// iterated only once, and only until the next call to Next of the Scanner.
+// The elements that are not iterated when the Scanner advances to the next
+// entry are skipped without being decoded, except the one that is read
+// already.
+func (e *Entry) Elements() iter.Seq[Element] {
+	return func(yield func(Element) bool) {
+		s := e.scanner
+		for s != nil && s.entry == e {
+			event, ok := s.pull()
+			if !ok {
+				return
+			}
+
+			if event.entry != nil {
+				// the first event of the next entry
+				s.pending = &event
+				return
+			}
+
+			if !yield(event.elem) {
+				return
+			}
+		}
+	}
+}
+
+// scanEvent is either the start of an entry, or an element of the
+// current entry, produced by the handler of the scanner.
+type scanEvent struct {
+	entry *Entry
+	elem  Element
+}
+
+// Scanner reads the entries of an RDB file one at a time, as an alternative
+// to the handlers. The entries of all the databases are read.
+//
+//	s, err := rdb.NewScanner("/path/to/dump.rdb")
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//
+//	for s.Next() {
+//		entry := s.Entry()
+//		for elem := range entry.Elements() {
+//			...
+//		}
+//	}
+//
+//	return s.Err()
+type Scanner struct {
+	next    func() (scanEvent, bool)
+	stop    func()
+	closer  io.Closer
+	entry   *Entry
+	pending *scanEvent
+	err     error
+	done    bool
+	// the entry the scanner advanced past, whose
+	// elements that are not iterated are skipped
+	skipped *Entry
+}
+
+// NewScanner returns a scanner that reads the RDB file in the given path.
+// The scanner must be closed after use.
+func NewScanner(path string) (*Scanner, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	fileLen := info.Size()
+	buf := newFileBackedBuffer(file, int(fileLen), minInt(int(fileLen), 1<<20))
+	return newScanner(buf, file), nil
+}
+
+// NewReaderScanner returns a scanner that reads the RDB file from the given
+// reader, in a single forward pass as ReadReader does. The scanner must be
+// closed after use, although the reader is not closed by it.
+func NewReaderScanner(r io.Reader) *Scanner {
+	return newScanner(newForwardOnlyBuffer(bufio.NewReaderSize(r, 1<<20)), nil)
+}
+
+func newScanner(buf buffer, closer io.Closer) *Scanner {
+	s := &Scanner{
+		closer: closer,
+	}
+
+	s.next, s.stop = iter.Pull(func(yield func(scanEvent) bool) {
+		h := &scanHandler{
+			scanner: s,
+			yield:   yield,
+		}
+
+		s.err = readFile(context.Background(), buf, h, 0, ReadOptions{})
+	})
+
+	return s
+}
+
+// Next advances the scanner to the next entry, skipping the elements
+// of the current entry that are not iterated. It returns false when
+// there are no more entries, or an error occurs.
+func (s *Scanner) Next() bool {
+	s.skipped = s.entry
+	s.entry = nil
+	for {
+		event, ok := s.pull()
+		if !ok {
+			return false
+		}
+
+		if event.entry != nil {
+			s.entry = event.entry
+			return true
+		}
+	}
+}
+
+// Entry returns the current entry.
+func (s *Scanner) Entry() *Entry {
+	return s.entry
+}
+
+// Err returns the error occurred while reading the file, if any.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Close stops reading the file, and releases the resources of the scanner.
+func (s *Scanner) Close() error {
+	s.stop()
+	s.done = true
+	s.entry = nil
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+
+	return nil
+}
+
+func (s *Scanner) pull() (scanEvent, bool) {
+	if s.pending != nil {
+		event := *s.pending
+		s.pending = nil
+		return event, true
+	}
+
+	if s.done {
+		return scanEvent{}, false
+	}
+
+	event, ok := s.next()
+	if !ok {
+		s.done = true
+	}
+
+	return event, ok
+}
+
+// ScanFile returns an iterator over the entries of the RDB file in the given
+// path. The elements of the entries can be iterated only until the iterator
+// advances to the next entry. The iteration stops after the first error.
+func ScanFile(path string) iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		s, err := NewScanner(path)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer s.Close()
+
+		scan(s, yield)
+	}
+}
+
+// ScanReader returns an iterator over the entries of the RDB file read from
+// the given reader, in the same way as ScanFile.
+func ScanReader(r io.Reader) iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		s := NewReaderScanner(r)
+		defer s.Close()
+
+		scan(s, yield)
+	}
+}
+
+func scan(s *Scanner, yield func(*Entry, error) bool) {
+	for s.Next() {
+		if !yield(s.Entry(), nil) {
+			return
+		}
+	}
+
+	if s.Err() != nil {
+		yield(nil, s.Err())
+	}
+}
+
+// scanHandler is the FileHandler that produces the
+// events of the scanner from the handler methods.
+type scanHandler struct {
+	scanner *Scanner
+	yield   func(scanEvent) bool
+	stopped bool
+	db      uint64
+	// the collection being read, and the one whose
+	// HandleBegin is not called yet, if any
+	entry     *Entry
+	beginning *Entry
+	// the expiration time of the next entry, if set
+	expireKey  string
+	expireTime time.Time
+}
+
+func (h *scanHandler) begin(key string, kind Kind) *Entry {
+	e := &Entry{
+		DB:      h.db,
+		Key:     key,
+		Kind:    kind,
+		scanner: h.scanner,
+	}
+
+	if h.expireKey == key {
+		e.ExpireTime = h.expireTime
+	}
+
+	h.expireKey = ""
+	h.expireTime = time.Time{}
+	return e
+}
+
+func (h *scanHandler) emit(event scanEvent) error {
+	if h.stopped || !h.yield(event) {
+		h.stopped = true
+		return ErrStop
+	}
+
+	return nil
+}
+
+// beginEntry emits the start of the entry, and returns
+// the function that emits the elements of the entry.
+func (h *scanHandler) beginEntry(key string, kind Kind) func(Element) error {
+	e := h.begin(key, kind)
+	h.entry = e
+	h.beginning = e
+	err := h.emit(scanEvent{entry: e})
+	return func(elem Element) error {
+		if err != nil {
+			return err
+		}
+
+		return h.emitElem(e, elem)
+	}
+}
+
+// emitElem emits the element of the given entry. Once the scanner advances
+// past the entry, the rest of its elements are skipped without being decoded.
+func (h *scanHandler) emitElem(e *Entry, elem Element) error {
+	if h.scanner.skipped == e {
+		return ErrSkipKey
+	}
+
+	err := h.emit(scanEvent{elem: elem})
+	if err == nil && h.scanner.skipped == e {
+		return ErrSkipKey
+	}
+
+	return err
+}
+
+// HandleBegin skips the collections that the scanner advanced
+// past before iterating them, before their first element is decoded.
+func (h *scanHandler) HandleBegin(key string, t Type, length int64) error {
+	e := h.beginning
+	h.beginning = nil
+	if e != nil && h.scanner.skipped == e {
+		return ErrSkipKey
+	}
+
+	return nil
+}
+
+func (h *scanHandler) HandleEnd(key string, t Type, entriesRead uint64) error {
+	return nil
+}
+
+func (h *scanHandler) AllowPartialRead() bool {
+	return true
+}
+
+func (h *scanHandler) RequireStrictEOF() bool {
+	return false
+}
+
+func (h *scanHandler) HandleSelectDB(dbnum uint64) error {
+	h.db = dbnum
+	if h.stopped {
+		return ErrStop
+	}
+
+	return nil
+}
+
+func (h *scanHandler) HandleExpireTime(key string, expireTime time.Duration) {
+	h.expireKey = key
+	h.expireTime = time.UnixMilli(expireTime.Milliseconds())
+}
+
+func (h *scanHandler) HandleString(key, value string) error {
+	e := h.begin(key, KindString)
+	e.Value = value
+	return h.emit(scanEvent{entry: e})
+}
+
+func (h *scanHandler) ListEntryHandler(key string) func(elem string) error {
+	emit := h.beginEntry(key, KindList)
+	return func(elem string) error {
+		return emit(Element{Value: elem})
+	}
+}
+
+func (h *scanHandler) HandleListEnding(key string, entriesRead uint64) {
+}
+
+func (h *scanHandler) SetEntryHandler(key string) func(elem string) error {
+	emit := h.beginEntry(key, KindSet)
+	return func(elem string) error {
+		return emit(Element{Value: elem})
+	}
+}
+
+func (h *scanHandler) ZsetEntryHandler(key string) func(elem string, score float64) error {
+	emit := h.beginEntry(key, KindZset)
+	return func(elem string, score float64) error {
+		return emit(Element{Value: elem, Score: score})
+	}
+}
+
+func (h *scanHandler) HandleZsetEnding(key string, entriesRead uint64) {
+}
+
+func (h *scanHandler) HashEntryHandler(key string) func(field, value string) error {
+	emit := h.beginEntry(key, KindHash)
+	return func(field, value string) error {
+		return emit(Element{Field: field, Value: value})
+	}
+}
+
+func (h *scanHandler) HashWithExpEntryHandler(key string) func(field string, value string, ttl time.Time) error {
+	emit := h.beginEntry(key, KindHash)
+	return func(field string, value string, ttl time.Time) error {
+		return emit(Element{Field: field, Value: value, ExpireTime: ttl})
+	}
+}
+
+func (h *scanHandler) HandleModule(key, value string, marker ModuleMarker) error {
+	e := h.begin(key, KindModule)
+	if marker == EmptyModuleMarker {
+		// skipped module, whose value is not available
+		return nil
+	}
+
+	e.Value = value
+	e.Marker = marker
+	return h.emit(scanEvent{entry: e})
+}
+
+func (h *scanHandler) StreamEntryHandler(key string) func(entry StreamEntry) error {
+	emit := h.beginEntry(key, KindStream)
+	return func(entry StreamEntry) error {
+		return emit(Element{StreamEntry: &entry})
+	}
+}
+
+func (h *scanHandler) StreamGroupHandler(key string) func(group StreamConsumerGroup) error {
+	// the groups are read after the entries of the stream
+	e := h.entry
+	return func(group StreamConsumerGroup) error {
+		return h.emitElem(e, Element{StreamGroup: &group})
+	}
+}
+
+func (h *scanHandler) HandleStreamEnding(key string, entriesRead uint64) {
+}
+
+func (h *scanHandler) HandleLibrary(code string) error {
+	if h.stopped {
+		return ErrStop
+	}
+
+	return nil
+}
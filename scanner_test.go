@@ -0,0 +1,297 @@
+package rdb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scanIntoDummyDB adds the entries read by the scanner to the db,
+// in the same way as the handler methods would do.
+func scanIntoDummyDB(t *testing.T, s *Scanner, db *dummyDB) {
+	for s.Next() {
+		entry := s.Entry()
+		if !entry.ExpireTime.IsZero() {
+			db.HandleExpireTime(entry.Key, time.Duration(entry.ExpireTime.UnixMilli())*time.Millisecond)
+		}
+
+		switch entry.Kind {
+		case KindString:
+			require.NoError(t, db.HandleString(entry.Key, entry.Value))
+		case KindModule:
+			require.NoError(t, db.HandleModule(entry.Key, entry.Value, entry.Marker))
+		case KindList:
+			handle := db.ListEntryHandler(entry.Key)
+			for elem := range entry.Elements() {
+				require.NoError(t, handle(elem.Value))
+			}
+		case KindSet:
+			handle := db.SetEntryHandler(entry.Key)
+			for elem := range entry.Elements() {
+				require.NoError(t, handle(elem.Value))
+			}
+		case KindZset:
+			handle := db.ZsetEntryHandler(entry.Key)
+			for elem := range entry.Elements() {
+				require.NoError(t, handle(elem.Value, elem.Score))
+			}
+		case KindHash:
+			handle := db.HashWithExpEntryHandler(entry.Key)
+			for elem := range entry.Elements() {
+				require.NoError(t, handle(elem.Field, elem.Value, elem.ExpireTime))
+			}
+		case KindStream:
+			handleEntry := db.StreamEntryHandler(entry.Key)
+			handleGroup := db.StreamGroupHandler(entry.Key)
+			for elem := range entry.Elements() {
+				if elem.StreamEntry != nil {
+					require.NoError(t, handleEntry(*elem.StreamEntry))
+				} else {
+					require.NoError(t, handleGroup(*elem.StreamGroup))
+				}
+			}
+		default:
+			t.Fatalf("unexpected kind %v", entry.Kind)
+		}
+	}
+}
+
+// readScanExpected reads the dump with the handlers, without the
+// information that is not available to the scanner.
+func readScanExpected(t *testing.T, name string) *dummyDB {
+	expected := newDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, name), expected)
+	require.NoError(t, err)
+
+	expected.listEntriesRead = make(map[string]uint64)
+	expected.zsetEntriesRead = make(map[string]uint64)
+	expected.streamEntriesRead = make(map[string]uint64)
+	expected.libraries = make([]string, 0)
+	return expected
+}
+
+func TestScanner(t *testing.T) {
+	for _, name := range []string{"all-types.rdb", "stream-with-pel.rdb", "expiretime-sec.rdb", "function.rdb"} {
+		t.Run(name, func(t *testing.T) {
+			expected := readScanExpected(t, name)
+
+			s, err := NewScanner(filepath.Join(dumpsPath, name))
+			require.NoError(t, err)
+			defer s.Close()
+
+			db := newDummyDB()
+			scanIntoDummyDB(t, s, db)
+			require.NoError(t, s.Err())
+			require.Nil(t, s.Entry())
+			require.False(t, s.Next())
+
+			require.Equal(t, expected, db)
+		})
+	}
+}
+
+func TestScanner_reader(t *testing.T) {
+	expected := readScanExpected(t, "all-types.rdb")
+
+	data, err := os.ReadFile(filepath.Join(dumpsPath, "all-types.rdb"))
+	require.NoError(t, err)
+
+	s := NewReaderScanner(bytes.NewReader(data))
+	defer s.Close()
+
+	db := newDummyDB()
+	scanIntoDummyDB(t, s, db)
+	require.NoError(t, s.Err())
+
+	require.Equal(t, expected, db)
+}
+
+func TestScanner_skipElements(t *testing.T) {
+	expected := readScanExpected(t, "all-types.rdb")
+
+	s, err := NewScanner(filepath.Join(dumpsPath, "all-types.rdb"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	var keys []string
+	for s.Next() {
+		entry := s.Entry()
+		keys = append(keys, entry.Key)
+
+		if entry.Kind == KindStream {
+			// read only the first element
+			for elem := range entry.Elements() {
+				require.NotNil(t, elem.StreamEntry)
+				break
+			}
+
+			// the rest of the elements are skipped after the break
+			for range entry.Elements() {
+			}
+		}
+	}
+	require.NoError(t, s.Err())
+
+	expectedKeys := 0
+	for _, m := range []int{
+		len(expected.strings), len(expected.lists), len(expected.sets), len(expected.zsets),
+		len(expected.hashes), len(expected.modules), len(expected.streamEntries),
+	} {
+		expectedKeys += m
+	}
+	require.Len(t, keys, expectedKeys)
+}
+
+func TestScanner_skipUndecodedElements(t *testing.T) {
+	file := []byte("REDIS0011")
+	file = append(file, byte(typeOpCodeSelectDB), 0)
+	// the second element of the list is an invalid LZF string,
+	// which fails only if it is decoded
+	file = append(file, byte(TypeList), 4, 'l', 'i', 's', 't', 2)
+	file = append(file, 1, 'a')
+	file = append(file, 0xC3, 3, 10, 0xFF, 0xFF, 0xFF)
+	file = append(file, byte(TypeString), 1, 'b', 1, 'c')
+	file = append(file, byte(typeOpCodeEOF), 0, 0, 0, 0, 0, 0, 0, 0)
+
+	path := filepath.Join(t.TempDir(), "skip.rdb")
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	s, err := NewScanner(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.True(t, s.Next())
+	for range s.Entry().Elements() {
+	}
+	require.False(t, s.Next())
+	require.Error(t, s.Err())
+
+	s, err = NewScanner(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.True(t, s.Next())
+	require.Equal(t, "list", s.Entry().Key)
+	for elem := range s.Entry().Elements() {
+		require.Equal(t, "a", elem.Value)
+		break
+	}
+
+	require.True(t, s.Next())
+	require.Equal(t, "b", s.Entry().Key)
+	require.Equal(t, "c", s.Entry().Value)
+	require.False(t, s.Next())
+	require.NoError(t, s.Err())
+
+	// the list is skipped before its first element is decoded
+	s, err = NewScanner(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	var keys []string
+	for s.Next() {
+		keys = append(keys, s.Entry().Key)
+	}
+	require.NoError(t, s.Err())
+	require.Equal(t, []string{"list", "b"}, keys)
+}
+
+func TestScanner_elementsAfterNext(t *testing.T) {
+	s, err := NewScanner(filepath.Join(dumpsPath, "all-types.rdb"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	var list *Entry
+	for s.Next() {
+		if s.Entry().Kind == KindList {
+			list = s.Entry()
+			break
+		}
+	}
+	require.NotNil(t, list)
+
+	require.True(t, s.Next())
+	for range list.Elements() {
+		t.Fatal("unexpected element of the previous entry")
+	}
+}
+
+func TestScanner_close(t *testing.T) {
+	s, err := NewScanner(filepath.Join(dumpsPath, "all-types.rdb"))
+	require.NoError(t, err)
+
+	require.True(t, s.Next())
+	require.NoError(t, s.Close())
+
+	require.False(t, s.Next())
+	require.Nil(t, s.Entry())
+	require.NoError(t, s.Err())
+}
+
+func TestScanner_multiDB(t *testing.T) {
+	s, err := NewScanner(filepath.Join(dumpsPath, "multi-db.rdb"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	dbs := make(map[string][]uint64)
+	for s.Next() {
+		entry := s.Entry()
+		dbs[entry.Key] = append(dbs[entry.Key], entry.DB)
+	}
+	require.NoError(t, s.Err())
+
+	require.Equal(t, []uint64{0, 1}, dbs["00"])
+	require.Equal(t, []uint64{1}, dbs["01"])
+}
+
+func TestScanner_badCRC(t *testing.T) {
+	s, err := NewScanner(filepath.Join(dumpsPath, "bad-crc.rdb"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	for s.Next() {
+	}
+	require.ErrorContains(t, s.Err(), "wrong CRC at the end of the RDB file")
+}
+
+func TestScanFile(t *testing.T) {
+	var keys []string
+	for entry, err := range ScanFile(filepath.Join(dumpsPath, "all-types.rdb")) {
+		require.NoError(t, err)
+		keys = append(keys, entry.Key)
+		if len(keys) == 3 {
+			break
+		}
+	}
+	require.Equal(t, []string{"00", "01", "02"}, keys[:3])
+
+	var errs []error
+	for _, err := range ScanFile(filepath.Join(dumpsPath, "bad-crc.rdb")) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "wrong CRC at the end of the RDB file")
+
+	for _, err := range ScanFile(filepath.Join(dumpsPath, "does-not-exist.rdb")) {
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
+
+func TestScanReader(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"))
+	require.NoError(t, err)
+
+	var keys []string
+	for entry, err := range ScanReader(bytes.NewReader(data)) {
+		require.NoError(t, err)
+		keys = append(keys, entry.Key)
+	}
+	require.Contains(t, keys, "00")
+	require.Contains(t, keys, "01")
+}
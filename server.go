@@ -0,0 +1,921 @@
+package rdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohler55/ojg/jp"
+	"github.com/ohler55/ojg/oj"
+)
+
+const (
+	errWrongType   = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	errSyntax      = "ERR syntax error"
+	errNotInteger  = "ERR value is not an integer or out of range"
+	errNoAuth      = "NOAUTH Authentication required."
+	errWrongPass   = "WRONGPASS invalid username-password pair or user is disabled."
+	errReadOnly    = "READONLY You can't write against a read only snapshot."
+	errInvalidID   = "ERR Invalid stream ID specified as stream command argument"
+	defaultScanLen = 10
+)
+
+// ServerOptions configures the server that serves a snapshot.
+type ServerOptions struct {
+	// Username and Password are required from the clients with the AUTH or
+	// HELLO commands, if the Password is set. The Username defaults to "default".
+	Username string
+	Password string
+}
+
+// Server answers the read-only commands of the Redis-compatible clients over
+// RESP2 and RESP3, from the entries of an RDB file loaded into memory. The
+// entries of all the databases are loaded, and they can be selected with the
+// SELECT command. The expired keys and hash fields are not visible, and the
+// values of the modules other than JSON are skipped.
+//
+// The following commands are supported: GET, MGET, HGETALL, HGET, LRANGE,
+// SMEMBERS, ZRANGE, XRANGE, TTL, TYPE, SCAN, DBSIZE and JSON.GET, along with
+// the connection commands such as HELLO, AUTH, SELECT, and PING. The write
+// commands are answered with an error.
+type Server struct {
+	opts     ServerOptions
+	snapshot *snapshot
+}
+
+// NewServer loads the RDB file in the given path into memory, and returns
+// a server that serves it.
+func NewServer(path string, opts ServerOptions) (*Server, error) {
+	loader := newSnapshotLoader()
+	err := ReadFile(path, NewValueAdapter(loader, ValueAdapterOptions{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return newServer(loader.finish(), opts), nil
+}
+
+// NewReaderServer loads the RDB file read from the given reader into memory,
+// and returns a server that serves it.
+func NewReaderServer(r io.Reader, opts ServerOptions) (*Server, error) {
+	loader := newSnapshotLoader()
+	err := ReadReader(r, NewValueAdapter(loader, ValueAdapterOptions{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return newServer(loader.finish(), opts), nil
+}
+
+func newServer(s *snapshot, opts ServerOptions) *Server {
+	if opts.Username == "" {
+		opts.Username = "default"
+	}
+
+	return &Server{
+		opts:     opts,
+		snapshot: s,
+	}
+}
+
+// Serve accepts the client connections from the listener, and serves each
+// of them in a separate goroutine, until the context is done or the listener
+// is closed. It closes the listener and the connections before returning.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	return serveListener(ctx, l, s.ServeConn)
+}
+
+// ServeConn serves a single client connection, until the client disconnects
+// or the context is done. It closes the connection before returning.
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	// closing the connection unblocks the reads and writes
+	// below when the context is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	c := &serverConn{
+		server:        s,
+		r:             bufio.NewReader(conn),
+		w:             &respWriter{Writer: bufio.NewWriter(conn), proto: 2},
+		authenticated: s.opts.Password == "",
+	}
+
+	err := c.serve()
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// serverConn is the state of a client connection.
+type serverConn struct {
+	server        *Server
+	r             *bufio.Reader
+	w             *respWriter
+	db            int
+	authenticated bool
+	quit          bool
+}
+
+func (c *serverConn) serve() error {
+	for !c.quit {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		c.handle(args)
+
+		// the replies of the pipelined commands are flushed together
+		if c.r.Buffered() == 0 || c.quit {
+			err = c.w.Flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// serverCommand is a command supported by the server.
+type serverCommand struct {
+	// arity is the number of arguments, including the command name, or
+	// the minimum number of arguments if it is negative, as in Redis.
+	arity  int
+	handle func(c *serverConn, args []string)
+}
+
+var serverCommands = map[string]serverCommand{
+	"PING":     {arity: -1, handle: (*serverConn).ping},
+	"ECHO":     {arity: 2, handle: (*serverConn).echo},
+	"QUIT":     {arity: -1, handle: (*serverConn).quitConn},
+	"HELLO":    {arity: -1, handle: (*serverConn).hello},
+	"AUTH":     {arity: -2, handle: (*serverConn).auth},
+	"SELECT":   {arity: 2, handle: (*serverConn).selectDB},
+	"CLIENT":   {arity: -2, handle: (*serverConn).client},
+	"COMMAND":  {arity: -1, handle: (*serverConn).command},
+	"GET":      {arity: 2, handle: (*serverConn).get},
+	"MGET":     {arity: -2, handle: (*serverConn).mget},
+	"HGETALL":  {arity: 2, handle: (*serverConn).hgetall},
+	"HGET":     {arity: 3, handle: (*serverConn).hget},
+	"LRANGE":   {arity: 4, handle: (*serverConn).lrange},
+	"SMEMBERS": {arity: 2, handle: (*serverConn).smembers},
+	"ZRANGE":   {arity: -4, handle: (*serverConn).zrange},
+	"XRANGE":   {arity: -4, handle: (*serverConn).xrange},
+	"TTL":      {arity: 2, handle: (*serverConn).ttl},
+	"TYPE":     {arity: 2, handle: (*serverConn).typeOf},
+	"SCAN":     {arity: -2, handle: (*serverConn).scan},
+	"DBSIZE":   {arity: 1, handle: (*serverConn).dbsize},
+	"JSON.GET": {arity: -2, handle: (*serverConn).jsonGet},
+}
+
+// serverWriteCommands are the write commands, which are
+// answered with an error instead of an unknown command error.
+var serverWriteCommands = map[string]struct{}{
+	"SET": {}, "SETNX": {}, "SETEX": {}, "PSETEX": {}, "MSET": {}, "MSETNX": {},
+	"APPEND": {}, "SETRANGE": {}, "GETSET": {}, "GETDEL": {}, "GETEX": {},
+	"INCR": {}, "INCRBY": {}, "INCRBYFLOAT": {}, "DECR": {}, "DECRBY": {},
+	"DEL": {}, "UNLINK": {}, "RENAME": {}, "RENAMENX": {}, "COPY": {}, "MOVE": {},
+	"EXPIRE": {}, "PEXPIRE": {}, "EXPIREAT": {}, "PEXPIREAT": {}, "PERSIST": {},
+	"RESTORE": {}, "FLUSHDB": {}, "FLUSHALL": {}, "SWAPDB": {},
+	"LPUSH": {}, "RPUSH": {}, "LPUSHX": {}, "RPUSHX": {}, "LPOP": {}, "RPOP": {},
+	"LSET": {}, "LREM": {}, "LTRIM": {}, "LINSERT": {}, "LMOVE": {}, "RPOPLPUSH": {},
+	"SADD": {}, "SREM": {}, "SPOP": {}, "SMOVE": {},
+	"ZADD": {}, "ZREM": {}, "ZINCRBY": {}, "ZPOPMIN": {}, "ZPOPMAX": {},
+	"HSET": {}, "HSETNX": {}, "HMSET": {}, "HDEL": {}, "HINCRBY": {}, "HINCRBYFLOAT": {},
+	"XADD": {}, "XDEL": {}, "XTRIM": {}, "XGROUP": {}, "XACK": {}, "XCLAIM": {},
+	"JSON.SET": {}, "JSON.DEL": {}, "JSON.MERGE": {}, "JSON.NUMINCRBY": {}, "JSON.ARRAPPEND": {},
+}
+
+func (c *serverConn) handle(args []string) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := serverCommands[name]
+	if !ok {
+		if _, ok := serverWriteCommands[name]; ok {
+			c.w.writeError(errReadOnly)
+			return
+		}
+
+		c.w.writeError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+
+	if !c.authenticated && name != "AUTH" && name != "HELLO" && name != "QUIT" {
+		c.w.writeError(errNoAuth)
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.w.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+		return
+	}
+
+	cmd.handle(c, args)
+}
+
+// lookup returns the entry of the key in the selected database, or nil if
+// there is no such key or it is expired. It writes the wrong type error,
+// and returns nil, if the entry is not one of the given types.
+func (c *serverConn) lookup(key string, types ...string) (*snapshotEntry, bool) {
+	db, ok := c.server.snapshot.dbs[c.db]
+	if !ok {
+		return nil, true
+	}
+
+	e, ok := db.entries[key]
+	if !ok || e.expired(time.Now()) {
+		return nil, true
+	}
+
+	if len(types) == 0 {
+		return e, true
+	}
+
+	for _, t := range types {
+		if e.t == t {
+			return e, true
+		}
+	}
+
+	c.w.writeError(errWrongType)
+	return nil, false
+}
+
+func (c *serverConn) ping(args []string) {
+	switch len(args) {
+	case 1:
+		c.w.writeStatus("PONG")
+	case 2:
+		c.w.writeBulk(args[1])
+	default:
+		c.w.writeError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (c *serverConn) echo(args []string) {
+	c.w.writeBulk(args[1])
+}
+
+func (c *serverConn) quitConn(args []string) {
+	c.w.writeStatus("OK")
+	c.quit = true
+}
+
+func (c *serverConn) hello(args []string) {
+	proto := c.w.proto
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			c.w.writeError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+
+		if n != 2 && n != 3 {
+			c.w.writeError("NOPROTO unsupported protocol version")
+			return
+		}
+
+		proto = n
+	}
+
+	authenticated := c.authenticated
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				c.w.writeError(errSyntax)
+				return
+			}
+
+			if !c.checkPassword(args[i+1], args[i+2]) {
+				c.w.writeError(errWrongPass)
+				return
+			}
+
+			authenticated = true
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				c.w.writeError(errSyntax)
+				return
+			}
+			i++
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+
+	if !authenticated {
+		c.w.writeError(errNoAuth)
+		return
+	}
+
+	c.authenticated = true
+	c.w.proto = proto
+
+	c.w.writeMap(7)
+	c.w.writeBulk("server")
+	c.w.writeBulk("rdb")
+	c.w.writeBulk("version")
+	// the Redis version whose RDB format is supported
+	c.w.writeBulk("7.4.0")
+	c.w.writeBulk("proto")
+	c.w.writeInt(int64(proto))
+	c.w.writeBulk("id")
+	c.w.writeInt(0)
+	c.w.writeBulk("mode")
+	c.w.writeBulk("standalone")
+	c.w.writeBulk("role")
+	c.w.writeBulk("master")
+	c.w.writeBulk("modules")
+	c.w.writeArray(0)
+}
+
+func (c *serverConn) auth(args []string) {
+	var ok bool
+	switch len(args) {
+	case 2:
+		ok = c.checkPassword("default", args[1])
+	case 3:
+		ok = c.checkPassword(args[1], args[2])
+	default:
+		c.w.writeError(errSyntax)
+		return
+	}
+
+	if !ok {
+		c.w.writeError(errWrongPass)
+		return
+	}
+
+	c.authenticated = true
+	c.w.writeStatus("OK")
+}
+
+func (c *serverConn) checkPassword(username, password string) bool {
+	return username == c.server.opts.Username && password == c.server.opts.Password
+}
+
+func (c *serverConn) selectDB(args []string) {
+	db, err := strconv.Atoi(args[1])
+	if err != nil || db < 0 {
+		c.w.writeError("ERR DB index is out of range")
+		return
+	}
+
+	c.db = db
+	c.w.writeStatus("OK")
+}
+
+func (c *serverConn) client(args []string) {
+	switch strings.ToUpper(args[1]) {
+	case "SETNAME", "SETINFO":
+		c.w.writeStatus("OK")
+	case "ID":
+		c.w.writeInt(0)
+	default:
+		c.w.writeError(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+	}
+}
+
+func (c *serverConn) command(args []string) {
+	// the clients request the documentation of the
+	// commands on startup, which we don't have.
+	c.w.writeArray(0)
+}
+
+func (c *serverConn) get(args []string) {
+	e, ok := c.lookup(args[1], snapshotTypeString)
+	if !ok {
+		return
+	}
+
+	if e == nil {
+		c.w.writeNull()
+		return
+	}
+
+	c.w.writeBulk(e.str)
+}
+
+func (c *serverConn) mget(args []string) {
+	c.w.writeArray(len(args) - 1)
+	for _, key := range args[1:] {
+		e, _ := c.lookup(key)
+		if e == nil || e.t != snapshotTypeString {
+			c.w.writeNull()
+			continue
+		}
+
+		c.w.writeBulk(e.str)
+	}
+}
+
+func (c *serverConn) hgetall(args []string) {
+	e, ok := c.lookup(args[1], snapshotTypeHash)
+	if !ok {
+		return
+	}
+
+	if e == nil {
+		c.w.writeMap(0)
+		return
+	}
+
+	fields := e.hashFields(time.Now())
+	c.w.writeMap(len(fields))
+	for _, field := range fields {
+		c.w.writeBulk(field)
+		c.w.writeBulk(e.hash[field])
+	}
+}
+
+func (c *serverConn) hget(args []string) {
+	e, ok := c.lookup(args[1], snapshotTypeHash)
+	if !ok {
+		return
+	}
+
+	if e == nil {
+		c.w.writeNull()
+		return
+	}
+
+	value, ok := e.hash[args[2]]
+	if !ok || e.fieldExpired(args[2], time.Now()) {
+		c.w.writeNull()
+		return
+	}
+
+	c.w.writeBulk(value)
+}
+
+func (c *serverConn) lrange(args []string) {
+	start, stop, ok := c.parseRange(args[2], args[3])
+	if !ok {
+		return
+	}
+
+	e, ok := c.lookup(args[1], snapshotTypeList)
+	if !ok {
+		return
+	}
+
+	if e == nil {
+		c.w.writeArray(0)
+		return
+	}
+
+	start, stop = normalizeRange(start, stop, len(e.elems))
+	c.w.writeBulkArray(e.elems[start:stop])
+}
+
+func (c *serverConn) smembers(args []string) {
+	e, ok := c.lookup(args[1], snapshotTypeSet)
+	if !ok {
+		return
+	}
+
+	if e == nil {
+		c.w.writeSet(0)
+		return
+	}
+
+	c.w.writeSet(len(e.elems))
+	for _, elem := range e.elems {
+		c.w.writeBulk(elem)
+	}
+}
+
+func (c *serverConn) zrange(args []string) {
+	start, stop, ok := c.parseRange(args[2], args[3])
+	if !ok {
+		return
+	}
+
+	withScores, rev := false, false
+	for _, arg := range args[4:] {
+		switch strings.ToUpper(arg) {
+		case "WITHSCORES":
+			withScores = true
+		case "REV":
+			rev = true
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+
+	e, ok := c.lookup(args[1], snapshotTypeZset)
+	if !ok {
+		return
+	}
+
+	if e == nil {
+		c.w.writeArray(0)
+		return
+	}
+
+	n := len(e.elems)
+	start, stop = normalizeRange(start, stop, n)
+	if withScores && c.w.proto == 2 {
+		c.w.writeArray(2 * (stop - start))
+	} else {
+		c.w.writeArray(stop - start)
+	}
+
+	for i := start; i < stop; i++ {
+		idx := i
+		if rev {
+			idx = n - 1 - i
+		}
+
+		if !withScores {
+			c.w.writeBulk(e.elems[idx])
+			continue
+		}
+
+		if c.w.proto == 3 {
+			c.w.writeArray(2)
+		}
+
+		c.w.writeBulk(e.elems[idx])
+		c.w.writeDouble(e.scores[idx])
+	}
+}
+
+func (c *serverConn) xrange(args []string) {
+	start, ok := parseStreamRangeID(args[2], false)
+	if !ok {
+		c.w.writeError(errInvalidID)
+		return
+	}
+
+	end, ok := parseStreamRangeID(args[3], true)
+	if !ok {
+		c.w.writeError(errInvalidID)
+		return
+	}
+
+	count := -1
+	switch len(args) {
+	case 4:
+	case 6:
+		if strings.ToUpper(args[4]) != "COUNT" {
+			c.w.writeError(errSyntax)
+			return
+		}
+
+		n, err := strconv.Atoi(args[5])
+		if err != nil {
+			c.w.writeError(errNotInteger)
+			return
+		}
+
+		count = maxInt(n, 0)
+	default:
+		c.w.writeError(errSyntax)
+		return
+	}
+
+	e, ok := c.lookup(args[1], snapshotTypeStream)
+	if !ok {
+		return
+	}
+
+	var entries []StreamEntry
+	if e != nil {
+		for _, entry := range e.stream {
+			if count >= 0 && len(entries) == count {
+				break
+			}
+
+			if streamIDLess(entry.ID, start) || streamIDLess(end, entry.ID) {
+				continue
+			}
+
+			entries = append(entries, entry)
+		}
+	}
+
+	c.w.writeArray(len(entries))
+	for _, entry := range entries {
+		c.w.writeArray(2)
+		c.w.writeBulk(strconv.FormatUint(entry.ID.Millis, 10) + "-" + strconv.FormatUint(entry.ID.Seq, 10))
+		c.w.writeBulkArray(entry.Value)
+	}
+}
+
+func (c *serverConn) ttl(args []string) {
+	e, _ := c.lookup(args[1])
+	switch {
+	case e == nil:
+		c.w.writeInt(-2)
+	case e.expireAt.IsZero():
+		c.w.writeInt(-1)
+	default:
+		ms := time.Until(e.expireAt).Milliseconds()
+		c.w.writeInt((ms + 500) / 1000)
+	}
+}
+
+func (c *serverConn) typeOf(args []string) {
+	e, _ := c.lookup(args[1])
+	if e == nil {
+		c.w.writeStatus("none")
+		return
+	}
+
+	c.w.writeStatus(e.t)
+}
+
+func (c *serverConn) scan(args []string) {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		c.w.writeError("ERR invalid cursor")
+		return
+	}
+
+	pattern, t, count := "", "", defaultScanLen
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.w.writeError(errSyntax)
+			return
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "TYPE":
+			t = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				c.w.writeError(errNotInteger)
+				return
+			}
+
+			if count < 1 {
+				c.w.writeError(errSyntax)
+				return
+			}
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+
+	var keys []string
+	next := uint64(0)
+	if db, ok := c.server.snapshot.dbs[c.db]; ok && cursor < uint64(len(db.keys)) {
+		now := time.Now()
+		end := minInt(int(cursor)+count, len(db.keys))
+		for _, key := range db.keys[cursor:end] {
+			e := db.entries[key]
+			if e.expired(now) {
+				continue
+			}
+
+			if t != "" && !strings.EqualFold(t, e.t) {
+				continue
+			}
+
+			if pattern != "" && !matchGlob(pattern, key) {
+				continue
+			}
+
+			keys = append(keys, key)
+		}
+
+		if end < len(db.keys) {
+			next = uint64(end)
+		}
+	}
+
+	c.w.writeArray(2)
+	c.w.writeBulk(strconv.FormatUint(next, 10))
+	c.w.writeBulkArray(keys)
+}
+
+func (c *serverConn) dbsize(args []string) {
+	db, ok := c.server.snapshot.dbs[c.db]
+	if !ok {
+		c.w.writeInt(0)
+		return
+	}
+
+	c.w.writeInt(int64(len(db.entries)))
+}
+
+func (c *serverConn) jsonGet(args []string) {
+	e, ok := c.lookup(args[1], snapshotTypeJSON)
+	if !ok {
+		return
+	}
+
+	if e == nil {
+		c.w.writeNull()
+		return
+	}
+
+	var paths []string
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "INDENT", "NEWLINE", "SPACE":
+			// formatting options are ignored
+			i++
+		default:
+			paths = append(paths, args[i])
+		}
+	}
+
+	if len(paths) == 0 {
+		c.w.writeBulk(e.str)
+		return
+	}
+
+	doc, err := oj.ParseString(e.str)
+	if err != nil {
+		c.w.writeError("ERR " + err.Error())
+		return
+	}
+
+	if len(paths) == 1 {
+		value, err := getJSONPath(doc, paths[0])
+		if err != nil {
+			c.w.writeError("ERR " + err.Error())
+			return
+		}
+
+		c.w.writeBulk(oj.JSON(value))
+		return
+	}
+
+	values := make(map[string]any, len(paths))
+	for _, path := range paths {
+		values[path], err = getJSONPath(doc, path)
+		if err != nil {
+			c.w.writeError("ERR " + err.Error())
+			return
+		}
+	}
+
+	c.w.writeBulk(oj.JSON(values, &oj.Options{Sort: true}))
+}
+
+// getJSONPath returns the values matching the JSONPath starting with $,
+// or the first value matching the legacy path, as RedisJSON does.
+func getJSONPath(doc any, path string) (any, error) {
+	legacy := !strings.HasPrefix(path, "$")
+	if legacy {
+		switch {
+		case path == ".":
+			return doc, nil
+		case strings.HasPrefix(path, "."):
+			path = "$" + path
+		default:
+			path = "$." + path
+		}
+	}
+
+	x, err := jp.ParseString(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path '%s'", path)
+	}
+
+	values := x.Get(doc)
+	if !legacy {
+		return values, nil
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("Path '%s' does not exist", path)
+	}
+
+	return values[0], nil
+}
+
+// parseRange parses the start and stop indexes of the range commands.
+func (c *serverConn) parseRange(startArg, stopArg string) (int, int, bool) {
+	start, err := strconv.Atoi(startArg)
+	if err != nil {
+		c.w.writeError(errNotInteger)
+		return 0, 0, false
+	}
+
+	stop, err := strconv.Atoi(stopArg)
+	if err != nil {
+		c.w.writeError(errNotInteger)
+		return 0, 0, false
+	}
+
+	return start, stop, true
+}
+
+// normalizeRange converts the inclusive start and stop indexes, which might
+// be negative to count from the end, into a half-open range of [0, n).
+func normalizeRange(start, stop, n int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+
+	if stop < 0 {
+		stop += n
+	}
+
+	start = maxInt(start, 0)
+	stop = minInt(stop, n-1)
+	if start > stop {
+		return 0, 0
+	}
+
+	return start, stop + 1
+}
+
+// parseStreamRangeID parses the ids of the XRANGE command, which might
+// be - or +, have the sequence omitted, or be exclusive with the ( prefix.
+func parseStreamRangeID(s string, end bool) (StreamID, bool) {
+	switch s {
+	case "-":
+		return StreamID{}, true
+	case "+":
+		return StreamID{Millis: math.MaxUint64, Seq: math.MaxUint64}, true
+	}
+
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+
+	millisStr, seqStr, hasSeq := strings.Cut(s, "-")
+	millis, err := strconv.ParseUint(millisStr, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+
+	var seq uint64
+	switch {
+	case hasSeq:
+		seq, err = strconv.ParseUint(seqStr, 10, 64)
+		if err != nil {
+			return StreamID{}, false
+		}
+	case end:
+		seq = math.MaxUint64
+	}
+
+	id := StreamID{Millis: millis, Seq: seq}
+	if !exclusive {
+		return id, true
+	}
+
+	if end {
+		return decrStreamID(id)
+	}
+
+	return incrStreamID(id)
+}
+
+func incrStreamID(id StreamID) (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		id.Seq++
+	case id.Millis < math.MaxUint64:
+		id.Millis++
+		id.Seq = 0
+	default:
+		return id, false
+	}
+
+	return id, true
+}
+
+func decrStreamID(id StreamID) (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		id.Seq--
+	case id.Millis > 0:
+		id.Millis--
+		id.Seq = math.MaxUint64
+	default:
+		return id, false
+	}
+
+	return id, true
+}
@@ -0,0 +1,266 @@
+package rdb
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type serverClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startServer(t *testing.T, s *Server) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, listener)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	return listener.Addr().String()
+}
+
+func dialServer(t *testing.T, addr string) *serverClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return &serverClient{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+}
+
+func (c *serverClient) do(t *testing.T, args ...string) any {
+	err := writeCommand(c.conn, args...)
+	require.NoError(t, err)
+
+	reply, err := readReply(c.r)
+	require.NoError(t, err)
+	return reply
+}
+
+// newTestServer returns a server with a snapshot
+// of a few entries of all types.
+func newTestServer(t *testing.T, opts ServerOptions) *Server {
+	l := newSnapshotLoader()
+	now := time.Now()
+
+	values := []struct {
+		key        string
+		value      Value
+		expireTime time.Time
+	}{
+		{key: "str", value: String("hello"), expireTime: time.UnixMilli(now.Add(time.Hour).UnixMilli())},
+		{key: "expired", value: String("gone"), expireTime: time.UnixMilli(now.Add(-time.Minute).UnixMilli())},
+		{key: "list", value: List{"a", "b", "c", "d"}},
+		{key: "set", value: Set{"x", "y"}},
+		{key: "zset", value: ZSet{"c": 3, "b": 1, "a": 1}},
+		{key: "hash", value: Hash{"f2": {Value: "v2"}, "f1": {Value: "v1"}}},
+		{key: "hashttl", value: Hash{
+			"g1": {Value: "v1"},
+			"g2": {Value: "v2", ExpirationTime: now.Add(-time.Minute)},
+			"g3": {Value: "v3", ExpirationTime: now.Add(time.Minute)},
+		}},
+		{key: "stream", value: &Stream{Entries: []StreamEntry{
+			{ID: StreamID{Millis: 1, Seq: 1}, Value: []string{"f", "v"}},
+			{ID: StreamID{Millis: 1, Seq: 2}, Value: []string{"f", "v"}},
+			{ID: StreamID{Millis: 2, Seq: 1}, Value: []string{"f", "v"}},
+		}}},
+		{key: "json", value: JSON(`{"a":{"b":[1,2]}}`)},
+	}
+
+	for _, v := range values {
+		require.NoError(t, l.HandleValue(v.key, v.value, KeyInfo{Key: v.key, ExpireTime: v.expireTime}))
+	}
+
+	require.NoError(t, l.HandleSelectDB(1))
+	require.NoError(t, l.HandleValue("other", String("1"), KeyInfo{DB: 1, Key: "other"}))
+
+	return newServer(l.finish(), opts)
+}
+
+func TestServer(t *testing.T) {
+	addr := startServer(t, newTestServer(t, ServerOptions{}))
+	c := dialServer(t, addr)
+
+	tests := []struct {
+		args     []string
+		expected any
+	}{
+		{args: []string{"PING"}, expected: "PONG"},
+		{args: []string{"GET", "str"}, expected: "hello"},
+		{args: []string{"get", "str"}, expected: "hello"},
+		{args: []string{"GET", "missing"}, expected: nil},
+		{args: []string{"GET", "expired"}, expected: nil},
+		{args: []string{"GET", "list"}, expected: RESPError(errWrongType)},
+		{args: []string{"GET"}, expected: RESPError("ERR wrong number of arguments for 'get' command")},
+		{args: []string{"MGET", "str", "list", "missing"}, expected: []any{"hello", nil, nil}},
+		{args: []string{"HGETALL", "hash"}, expected: []any{"f1", "v1", "f2", "v2"}},
+		{args: []string{"HGETALL", "hashttl"}, expected: []any{"g1", "v1", "g3", "v3"}},
+		{args: []string{"HGETALL", "missing"}, expected: []any{}},
+		{args: []string{"HGET", "hash", "f2"}, expected: "v2"},
+		{args: []string{"HGET", "hashttl", "g2"}, expected: nil},
+		{args: []string{"HGET", "hash", "missing"}, expected: nil},
+		{args: []string{"LRANGE", "list", "0", "-1"}, expected: []any{"a", "b", "c", "d"}},
+		{args: []string{"LRANGE", "list", "1", "2"}, expected: []any{"b", "c"}},
+		{args: []string{"LRANGE", "list", "-2", "100"}, expected: []any{"c", "d"}},
+		{args: []string{"LRANGE", "list", "3", "1"}, expected: []any{}},
+		{args: []string{"LRANGE", "list", "a", "1"}, expected: RESPError(errNotInteger)},
+		{args: []string{"SMEMBERS", "set"}, expected: []any{"x", "y"}},
+		{args: []string{"ZRANGE", "zset", "0", "-1"}, expected: []any{"a", "b", "c"}},
+		{args: []string{"ZRANGE", "zset", "0", "1", "WITHSCORES"}, expected: []any{"a", "1", "b", "1"}},
+		{args: []string{"ZRANGE", "zset", "0", "0", "REV"}, expected: []any{"c"}},
+		{args: []string{"ZRANGE", "zset", "0", "0", "BYSCORE"}, expected: RESPError(errSyntax)},
+		{args: []string{"XRANGE", "stream", "-", "+"}, expected: []any{
+			[]any{"1-1", []any{"f", "v"}},
+			[]any{"1-2", []any{"f", "v"}},
+			[]any{"2-1", []any{"f", "v"}},
+		}},
+		{args: []string{"XRANGE", "stream", "1", "1"}, expected: []any{
+			[]any{"1-1", []any{"f", "v"}},
+			[]any{"1-2", []any{"f", "v"}},
+		}},
+		{args: []string{"XRANGE", "stream", "(1-1", "+", "COUNT", "1"}, expected: []any{
+			[]any{"1-2", []any{"f", "v"}},
+		}},
+		{args: []string{"XRANGE", "stream", "x", "+"}, expected: RESPError(errInvalidID)},
+		{args: []string{"TTL", "str"}, expected: int64(3600)},
+		{args: []string{"TTL", "list"}, expected: int64(-1)},
+		{args: []string{"TTL", "expired"}, expected: int64(-2)},
+		{args: []string{"TYPE", "zset"}, expected: "zset"},
+		{args: []string{"TYPE", "json"}, expected: "ReJSON-RL"},
+		{args: []string{"TYPE", "missing"}, expected: "none"},
+		{args: []string{"SCAN", "0", "COUNT", "100"}, expected: []any{"0", []any{"hash", "hashttl", "json", "list", "set", "str", "stream", "zset"}}},
+		{args: []string{"SCAN", "0", "COUNT", "3"}, expected: []any{"3", []any{"hash", "hashttl"}}},
+		{args: []string{"SCAN", "3", "COUNT", "3"}, expected: []any{"6", []any{"json", "list", "set"}}},
+		{args: []string{"SCAN", "0", "MATCH", "s*", "COUNT", "100"}, expected: []any{"0", []any{"set", "str", "stream"}}},
+		{args: []string{"SCAN", "0", "TYPE", "hash", "COUNT", "100"}, expected: []any{"0", []any{"hash", "hashttl"}}},
+		{args: []string{"DBSIZE"}, expected: int64(9)},
+		{args: []string{"JSON.GET", "json"}, expected: `{"a":{"b":[1,2]}}`},
+		{args: []string{"JSON.GET", "json", "$.a.b[0]"}, expected: `[1]`},
+		{args: []string{"JSON.GET", "json", ".a.b"}, expected: `[1,2]`},
+		{args: []string{"JSON.GET", "json", "$.a.b", ".a"}, expected: `{"$.a.b":[[1,2]],".a":{"b":[1,2]}}`},
+		{args: []string{"JSON.GET", "json", ".missing"}, expected: RESPError("ERR Path '$.missing' does not exist")},
+		{args: []string{"SET", "str", "value"}, expected: RESPError(errReadOnly)},
+		{args: []string{"DEL", "str"}, expected: RESPError(errReadOnly)},
+		{args: []string{"FOO"}, expected: RESPError("ERR unknown command 'FOO'")},
+		{args: []string{"SELECT", "1"}, expected: "OK"},
+		{args: []string{"GET", "other"}, expected: "1"},
+		{args: []string{"GET", "str"}, expected: nil},
+		{args: []string{"DBSIZE"}, expected: int64(1)},
+		{args: []string{"SELECT", "5"}, expected: "OK"},
+		{args: []string{"DBSIZE"}, expected: int64(0)},
+		{args: []string{"SCAN", "0"}, expected: []any{"0", []any{}}},
+	}
+
+	for _, tc := range tests {
+		require.Equal(t, tc.expected, c.do(t, tc.args...), "%v", tc.args)
+	}
+}
+
+func TestServer_resp3(t *testing.T) {
+	addr := startServer(t, newTestServer(t, ServerOptions{}))
+	c := dialServer(t, addr)
+
+	reply := c.do(t, "HELLO", "3")
+	require.Contains(t, reply, "proto")
+	require.Contains(t, reply, int64(3))
+
+	err := writeCommand(c.conn, "HGETALL", "hash")
+	require.NoError(t, err)
+	header, err := readLine(c.r)
+	require.NoError(t, err)
+	require.Equal(t, "%2", header)
+	for _, expected := range []string{"f1", "v1", "f2", "v2"} {
+		elem, err := readReply(c.r)
+		require.NoError(t, err)
+		require.Equal(t, expected, elem)
+	}
+
+	err = writeCommand(c.conn, "SMEMBERS", "set")
+	require.NoError(t, err)
+	header, err = readLine(c.r)
+	require.NoError(t, err)
+	require.Equal(t, "~2", header)
+	_, _ = readReply(c.r)
+	_, _ = readReply(c.r)
+
+	require.Equal(t, []any{[]any{"a", 1.0}, []any{"b", 1.0}}, c.do(t, "ZRANGE", "zset", "0", "1", "WITHSCORES"))
+
+	err = writeCommand(c.conn, "GET", "missing")
+	require.NoError(t, err)
+	header, err = readLine(c.r)
+	require.NoError(t, err)
+	require.Equal(t, "_", header)
+
+	require.Equal(t, RESPError("NOPROTO unsupported protocol version"), c.do(t, "HELLO", "4"))
+}
+
+func TestServer_auth(t *testing.T) {
+	addr := startServer(t, newTestServer(t, ServerOptions{Password: "secret"}))
+
+	c := dialServer(t, addr)
+	require.Equal(t, RESPError(errNoAuth), c.do(t, "GET", "str"))
+	require.Equal(t, RESPError(errWrongPass), c.do(t, "AUTH", "wrong"))
+	require.Equal(t, "OK", c.do(t, "AUTH", "secret"))
+	require.Equal(t, "hello", c.do(t, "GET", "str"))
+
+	c = dialServer(t, addr)
+	require.Equal(t, RESPError(errNoAuth), c.do(t, "HELLO", "3"))
+	require.Contains(t, c.do(t, "HELLO", "3", "AUTH", "default", "secret"), "proto")
+	require.Equal(t, "hello", c.do(t, "GET", "str"))
+}
+
+func TestServer_pipeline(t *testing.T) {
+	addr := startServer(t, newTestServer(t, ServerOptions{}))
+	c := dialServer(t, addr)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, writeCommand(c.conn, "GET", "str"))
+	}
+
+	for i := 0; i < 100; i++ {
+		reply, err := readReply(c.r)
+		require.NoError(t, err)
+		require.Equal(t, "hello", reply)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	s, err := NewServer(filepath.Join(dumpsPath, "all-types.rdb"), ServerOptions{})
+	require.NoError(t, err)
+
+	addr := startServer(t, s)
+	c := dialServer(t, addr)
+
+	require.Equal(t, "a", c.do(t, "GET", "00"))
+	require.Equal(t, []any{"a"}, c.do(t, "LRANGE", "01", "0", "-1"))
+	require.Equal(t, `{"a":0}`, c.do(t, "JSON.GET", "07"))
+	require.Equal(t, "stream", c.do(t, "TYPE", "21"))
+
+	s, err = NewServer(filepath.Join(dumpsPath, "multi-db.rdb"), ServerOptions{})
+	require.NoError(t, err)
+
+	addr = startServer(t, s)
+	c = dialServer(t, addr)
+
+	require.Equal(t, "OK", c.do(t, "SELECT", "1"))
+	require.Equal(t, []any{"a"}, c.do(t, "LRANGE", "01", "0", "-1"))
+}
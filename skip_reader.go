@@ -0,0 +1,327 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// readRaw skips the next RDB object with the given type in the same way as
+// skipObject, and returns its serialized bytes, prefixed with the type.
+func (r *valueReader) readRaw(t Type) ([]byte, error) {
+	buf := &recordingBuffer{
+		buffer:   r.buf,
+		recorded: []byte{byte(t)},
+	}
+
+	r.buf = buf
+	err := r.skipObject(t)
+	r.buf = buf.buffer
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.recorded, nil
+}
+
+// skipObject skips the next RDB object with the given type, without decoding
+// its elements. The strings, including the ziplists, the listpacks, and the
+// intsets, are skipped using their length prefixes.
+func (r *valueReader) skipObject(t Type) error {
+	switch t {
+	case TypeString, TypeHashZipmap, TypeListZiplist, TypeSetIntset, TypeZsetZiplist,
+		TypeHashZiplist, TypeHashListpack, TypeZsetListpack, TypeSetListpack:
+		return r.skipString()
+	case TypeList, TypeSet, TypeListQuicklist:
+		return r.skipCollection(r.skipString)
+	case TypeZset:
+		return r.skipCollection(r.skipZsetElem)
+	case TypeZset2:
+		return r.skipCollection(r.skipZset2Elem)
+	case TypeHash:
+		return r.skipCollection(r.skipHashElem)
+	case TypeListQuicklist2:
+		return r.skipCollection(r.skipQuicklist2Node)
+	case TypeModule2:
+		_, _, err := r.readLen() // module id
+		if err != nil {
+			return err
+		}
+
+		mReader := moduleReader{
+			reader: r,
+		}
+		return mReader.Skip()
+	case TypeStreamListpacks, TypeStreamListpacks2, TypeStreamListpacks3:
+		return r.skipStream(t)
+	case TypeHashMetadata:
+		err := r.skip(8) // min expiration time
+		if err != nil {
+			return err
+		}
+
+		return r.skipCollection(r.skipHashMetadataElem)
+	case TypeHashListpackEx:
+		err := r.skip(8) // min expiration time
+		if err != nil {
+			return err
+		}
+
+		return r.skipString()
+	default:
+		return fmt.Errorf("unknown RDB object type %d", t)
+	}
+}
+
+// skipCollection skips the length of the collection and
+// its elements, each of which is skipped with the given function.
+func (r *valueReader) skipCollection(skip func() error) error {
+	length, _, err := r.readLen()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < length; i++ {
+		err = skip()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipStream skips the next stream object, which has
+// the form described in ReadStreamListpacks3.
+func (r *valueReader) skipStream(t Type) error {
+	lpCount, _, err := r.readLen()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < lpCount; i++ {
+		// <master-entry-id><entry-lp>
+		err = r.skipHashElem()
+		if err != nil {
+			return err
+		}
+	}
+
+	// length, last id millis and seq
+	lens := 3
+	if t >= TypeStreamListpacks2 {
+		// first id millis and seq, max deleted entry id millis and seq, entries added
+		lens += 5
+	}
+
+	err = r.skipLens(lens)
+	if err != nil {
+		return err
+	}
+
+	groupCount, _, err := r.readLen()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < groupCount; i++ {
+		err = r.skipString() // name
+		if err != nil {
+			return err
+		}
+
+		// last id millis and seq
+		lens := 2
+		if t >= TypeStreamListpacks2 {
+			// entries read
+			lens++
+		}
+
+		err = r.skipLens(lens)
+		if err != nil {
+			return err
+		}
+
+		globalPELLen, _, err := r.readLen()
+		if err != nil {
+			return err
+		}
+
+		for j := uint64(0); j < globalPELLen; j++ {
+			// entry id and delivery time
+			err = r.skip(16 + 8)
+			if err != nil {
+				return err
+			}
+
+			_, _, err = r.readLen() // delivery count
+			if err != nil {
+				return err
+			}
+		}
+
+		consumerCount, _, err := r.readLen()
+		if err != nil {
+			return err
+		}
+
+		for j := uint64(0); j < consumerCount; j++ {
+			err = r.skipString() // name
+			if err != nil {
+				return err
+			}
+
+			// seen time
+			n := 8
+			if t >= TypeStreamListpacks3 {
+				// active time
+				n += 8
+			}
+
+			err = r.skip(n)
+			if err != nil {
+				return err
+			}
+
+			pelLen, _, err := r.readLen()
+			if err != nil {
+				return err
+			}
+
+			if pelLen > math.MaxInt/16 {
+				return errLengthOutOfRange
+			}
+
+			err = r.skipLen(16 * pelLen) // entry ids
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// skipLens skips the next n length encoded integers.
+func (r *valueReader) skipLens(n int) error {
+	for i := 0; i < n; i++ {
+		_, _, err := r.readLen()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipElements skips the rest of the elements of the value being read, if the
+// err is ErrSkipKey, so that the next value can be read. Each element is skipped
+// with the given function, without decoding it. It returns the given err.
+func (r *valueReader) skipElements(err error, n int, skip func() error) error {
+	if !errors.Is(err, ErrSkipKey) {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		if skipErr := skip(); skipErr != nil {
+			return skipErr
+		}
+	}
+
+	return err
+}
+
+// skipString skips the next string object, without decoding it.
+func (r *valueReader) skipString() error {
+	length, encoded, err := r.readLen()
+	if err != nil {
+		return err
+	}
+
+	if !encoded {
+		return r.skipLen(length)
+	}
+
+	switch length {
+	case lenEncodingInt8:
+		return r.skip(1)
+	case lenEncodingInt16:
+		return r.skip(2)
+	case lenEncodingInt32:
+		return r.skip(4)
+	case lenEncodingLZF:
+		compressedLen, _, err := r.readLen()
+		if err != nil {
+			return err
+		}
+
+		_, _, err = r.readLen() // uncompressed length
+		if err != nil {
+			return err
+		}
+
+		return r.skipLen(compressedLen)
+	default:
+		return errors.New("unexpected string encoding")
+	}
+}
+
+// skipZsetElem skips the next <elem><score> pair of the zset.
+func (r *valueReader) skipZsetElem() error {
+	err := r.skipString()
+	if err != nil {
+		return err
+	}
+
+	scoreLen, err := r.readUint8()
+	if err != nil {
+		return err
+	}
+
+	if scoreLen >= 253 {
+		// infinities and NaN
+		return nil
+	}
+
+	return r.skip(int(scoreLen))
+}
+
+// skipZset2Elem skips the next <elem><score> pair of the zset2.
+func (r *valueReader) skipZset2Elem() error {
+	err := r.skipString()
+	if err != nil {
+		return err
+	}
+
+	return r.skip(8)
+}
+
+// skipHashElem skips the next <field><value> pair of the hash.
+func (r *valueReader) skipHashElem() error {
+	err := r.skipString()
+	if err != nil {
+		return err
+	}
+
+	return r.skipString()
+}
+
+// skipHashMetadataElem skips the next <ttl><field><value> triplet of the hash.
+func (r *valueReader) skipHashMetadataElem() error {
+	_, _, err := r.readLen()
+	if err != nil {
+		return err
+	}
+
+	return r.skipHashElem()
+}
+
+// skipQuicklist2Node skips the next <container-type><node-content> of the quicklist2.
+func (r *valueReader) skipQuicklist2Node() error {
+	_, _, err := r.readLen()
+	if err != nil {
+		return err
+	}
+
+	return r.skipString()
+}
@@ -0,0 +1,192 @@
+package rdb
+
+import (
+	"sort"
+	"time"
+)
+
+// names of the types, as returned by the TYPE command.
+const (
+	snapshotTypeString = "string"
+	snapshotTypeList   = "list"
+	snapshotTypeSet    = "set"
+	snapshotTypeZset   = "zset"
+	snapshotTypeHash   = "hash"
+	snapshotTypeStream = "stream"
+	snapshotTypeJSON   = "ReJSON-RL"
+)
+
+// snapshot is the read-only, in-memory copy of the entries of an RDB file.
+type snapshot struct {
+	dbs map[int]*snapshotDB
+}
+
+type snapshotDB struct {
+	entries map[string]*snapshotEntry
+	// sorted keys of the entries, so that they can be iterated with cursors.
+	keys []string
+}
+
+type snapshotEntry struct {
+	t        string
+	expireAt time.Time
+	// value of the strings and the JSON documents.
+	str string
+	// elements of the lists, the sets and the sorted sets.
+	elems []string
+	// scores of the sorted set elements, which are
+	// sorted by their score and then lexicographically.
+	scores       []float64
+	hash         map[string]string
+	hashExpireAt map[string]time.Time
+	stream       []StreamEntry
+}
+
+func (e *snapshotEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// hashFields returns the fields of the hash that are not expired,
+// in the lexicographical order.
+func (e *snapshotEntry) hashFields(now time.Time) []string {
+	fields := make([]string, 0, len(e.hash))
+	for field := range e.hash {
+		if !e.fieldExpired(field, now) {
+			fields = append(fields, field)
+		}
+	}
+
+	sort.Strings(fields)
+	return fields
+}
+
+func (e *snapshotEntry) fieldExpired(field string, now time.Time) bool {
+	expireAt, ok := e.hashExpireAt[field]
+	return ok && !expireAt.IsZero() && !now.Before(expireAt)
+}
+
+// snapshotLoader is a WholeValueHandler that builds the snapshot
+// from the values of all databases, passed by the ValueAdapter.
+type snapshotLoader struct {
+	BaseHandler
+	snapshot *snapshot
+	db       *snapshotDB
+}
+
+func newSnapshotLoader() *snapshotLoader {
+	l := &snapshotLoader{
+		snapshot: &snapshot{
+			dbs: make(map[int]*snapshotDB),
+		},
+	}
+
+	_ = l.HandleSelectDB(0)
+	return l
+}
+
+// finish sorts the keys of the databases and the elements of
+// the sorted sets, and returns the snapshot.
+func (l *snapshotLoader) finish() *snapshot {
+	for _, db := range l.snapshot.dbs {
+		db.keys = make([]string, 0, len(db.entries))
+		for key, e := range db.entries {
+			db.keys = append(db.keys, key)
+			if e.t == snapshotTypeZset {
+				sort.Sort(zsetSorter{e})
+			}
+		}
+
+		sort.Strings(db.keys)
+	}
+
+	return l.snapshot
+}
+
+func (l *snapshotLoader) AllowPartialRead() bool {
+	return true
+}
+
+func (l *snapshotLoader) HandleSelectDB(dbnum uint64) error {
+	db, ok := l.snapshot.dbs[int(dbnum)]
+	if !ok {
+		db = &snapshotDB{
+			entries: make(map[string]*snapshotEntry),
+		}
+		l.snapshot.dbs[int(dbnum)] = db
+	}
+
+	l.db = db
+	return nil
+}
+
+func (l *snapshotLoader) HandleValue(key string, value Value, info KeyInfo) error {
+	e := &snapshotEntry{
+		expireAt: info.ExpireTime,
+	}
+
+	switch v := value.(type) {
+	case String:
+		e.t = snapshotTypeString
+		e.str = string(v)
+	case JSON:
+		e.t = snapshotTypeJSON
+		e.str = string(v)
+	case List:
+		e.t = snapshotTypeList
+		e.elems = v
+	case Set:
+		e.t = snapshotTypeSet
+		e.elems = v
+	case ZSet:
+		e.t = snapshotTypeZset
+		e.elems = make([]string, 0, len(v))
+		e.scores = make([]float64, 0, len(v))
+		for elem, score := range v {
+			e.elems = append(e.elems, elem)
+			e.scores = append(e.scores, score)
+		}
+	case Hash:
+		e.t = snapshotTypeHash
+		e.hash = make(map[string]string, len(v))
+		e.hashExpireAt = make(map[string]time.Time, len(v))
+		for field, entry := range v {
+			e.hash[field] = entry.Value
+			e.hashExpireAt[field] = entry.ExpirationTime
+		}
+	case *Stream:
+		e.t = snapshotTypeStream
+		e.stream = v.Entries
+	}
+
+	l.db.entries[key] = e
+	return nil
+}
+
+func (l *snapshotLoader) HandleModule(key, value string, marker ModuleMarker) error {
+	// skipped module, which we cannot serve. The JSON
+	// values are passed to HandleValue.
+	delete(l.db.entries, key)
+	return nil
+}
+
+// zsetSorter sorts the elements of a sorted set by their
+// scores, and then lexicographically, as Redis does.
+type zsetSorter struct {
+	e *snapshotEntry
+}
+
+func (s zsetSorter) Len() int {
+	return len(s.e.elems)
+}
+
+func (s zsetSorter) Less(i, j int) bool {
+	if s.e.scores[i] != s.e.scores[j] {
+		return s.e.scores[i] < s.e.scores[j]
+	}
+	return s.e.elems[i] < s.e.elems[j]
+}
+
+func (s zsetSorter) Swap(i, j int) {
+	s.e.elems[i], s.e.elems[j] = s.e.elems[j], s.e.elems[i]
+	s.e.scores[i], s.e.scores[j] = s.e.scores[j], s.e.scores[i]
+}
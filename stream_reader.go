@@ -146,6 +146,7 @@ func (r *valueReader) readStreamListpacks0(
 		entriesViewReader := valueReader{
 			buf:           entriesView,
 			maxLz77StrLen: r.maxLz77StrLen,
+			trace:         r.trace,
 		}
 
 		// second pass over entries, we read the values of the pending entries we collected above
@@ -164,6 +165,7 @@ func (r *valueReader) readStreamListpacks0(
 		groupsViewReader := valueReader{
 			buf:           groupsView,
 			maxLz77StrLen: r.maxLz77StrLen,
+			trace:         r.trace,
 		}
 
 		// second pass over consumer groups, we read all into cb, after setting the pending entry values
@@ -177,15 +179,7 @@ func (r *valueReader) readStreamListpacks0(
 				}
 
 				sort.Slice(c.PendingEntries, func(i, j int) bool {
-					a, b := c.PendingEntries[i].Entry.ID, c.PendingEntries[j].Entry.ID
-
-					if a.Millis < b.Millis {
-						return true
-					} else if a.Millis > b.Millis {
-						return false
-					} else {
-						return a.Seq < b.Seq
-					}
+					return streamIDLess(c.PendingEntries[i].Entry.ID, c.PendingEntries[j].Entry.ID)
 				})
 			}
 
@@ -213,7 +207,9 @@ func (r *valueReader) readStreamEntries(cb func(StreamEntry) error) error {
 		return err
 	}
 
+	depth := r.trace.push("stream node")
 	for i := uint64(0); i < lpCount; i++ {
+		r.trace.at(depth, int(i))
 		masterIDS, err := r.ReadString()
 		if err != nil {
 			return err
@@ -298,7 +294,9 @@ func (r *valueReader) readStreamEntries(cb func(StreamEntry) error) error {
 		}
 
 		total := count + deleted
+		entryDepth := r.trace.push("stream entry")
 		for j := 0; j < total; j++ {
+			r.trace.at(entryDepth, j)
 			fields := make([]string, 0)
 
 			flagS, err := lpReader.readListpackEntry()
@@ -402,6 +400,7 @@ func (r *valueReader) readStreamEntries(cb func(StreamEntry) error) error {
 				return err
 			}
 		}
+		r.trace.pop(entryDepth)
 
 		lpEnd, err := lpReader.readUint8()
 		if err != nil {
@@ -412,6 +411,7 @@ func (r *valueReader) readStreamEntries(cb func(StreamEntry) error) error {
 			return errLPUnexpectedEnd
 		}
 	}
+	r.trace.pop(depth)
 
 	return nil
 }
@@ -422,7 +422,9 @@ func (r *valueReader) readStreamConsumerGroups(t Type, cb func(StreamConsumerGro
 		return err
 	}
 
+	depth := r.trace.push("consumer group")
 	for i := uint64(0); i < count; i++ {
+		r.trace.at(depth, int(i))
 		name, err := r.ReadString()
 		if err != nil {
 			return err
@@ -568,6 +570,22 @@ func (r *valueReader) readStreamConsumerGroups(t Type, cb func(StreamConsumerGro
 			return err
 		}
 	}
+	r.trace.pop(depth)
 
 	return nil
 }
+
+func streamIDLess(a, b StreamID) bool {
+	if a.Millis != b.Millis {
+		return a.Millis < b.Millis
+	}
+	return a.Seq < b.Seq
+}
+
+// maxStreamID returns the greater of the given ids.
+func maxStreamID(a, b StreamID) StreamID {
+	if streamIDLess(a, b) {
+		return b
+	}
+	return a
+}
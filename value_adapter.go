@@ -0,0 +1,416 @@
+package rdb
+
+import (
+	"errors"
+	"time"
+)
+
+// WholeValueHandler is a FileHandler that receives the complete values of the
+// keys from the ValueAdapter, instead of the elements of their collections.
+// Its streaming methods are called only for the collections that are too large
+// to be buffered, and for the values of the modules other than JSON.
+type WholeValueHandler interface {
+	FileHandler
+
+	// called once the value of the key is read completely, with the
+	// value and the metadata of the entry. Returning ErrSkipKey from
+	// it has no effect, as the value is already read.
+	HandleValue(key string, value Value, info KeyInfo) error
+}
+
+// ValueAdapterOptions are the limits of the collections buffered by the
+// ValueAdapter. The limits are not applied when they are not positive.
+type ValueAdapterOptions struct {
+	// MaxElements is the max number of elements buffered for a collection. For
+	// streams, both the stream entries and the consumer groups are counted.
+	MaxElements int
+	// MaxBytes is the max size of the elements buffered for a collection, which
+	// is estimated from the lengths of their strings.
+	MaxBytes int
+}
+
+// ValueAdapter is a FileHandler that buffers the elements of each key read, and
+// passes the complete value of the key to the WholeValueHandler, once the value
+// is read. The strings and the JSON modules are passed as they are read.
+//
+// When a collection exceeds one of the limits in the options, the elements
+// buffered so far are passed to the streaming methods of the handler, as if
+// they were just read, and the rest of the collection is streamed to it, along
+// with the ending callback of the collection, instead of calling HandleValue.
+// If the handler implements the KeyInfoHandler, the metadata of the streamed
+// collections is passed to it once they are read.
+//
+// The optional DBHandler, AuxHandler, EvictionHandler and ModuleAuxHandler
+// extensions are forwarded to the handler, if it implements them. When it
+// does not implement the DBHandler, it receives only the entries of the
+// database 0, as if it was passed to ReadFile.
+type ValueAdapter struct {
+	handler WholeValueHandler
+	opts    ValueAdapterOptions
+	// whether the handler receives the entries of the selected database
+	active bool
+	// the value of the key being read
+	pending *pendingValue
+}
+
+// pendingValue is the value of a key, which is either buffered
+// until the key is read, or streamed to the handler.
+type pendingValue struct {
+	key   string
+	kind  Kind
+	value Value
+	elems []Element
+	size  int
+	// whether the hash is read with the HashWithExpEntryHandler
+	withExp  bool
+	streamed bool
+	// the function that streams the elements to the handler
+	emit func(Element) error
+}
+
+// NewValueAdapter returns an adapter that passes the
+// complete values read to the given handler.
+func NewValueAdapter(handler WholeValueHandler, opts ValueAdapterOptions) *ValueAdapter {
+	return &ValueAdapter{
+		handler: handler,
+		opts:    opts,
+		active:  true,
+	}
+}
+
+// begin starts buffering the value of the given key, or returns
+// nil if the entries of the selected database are not received.
+func (a *ValueAdapter) begin(key string, kind Kind) *pendingValue {
+	if !a.active {
+		a.pending = nil
+		return nil
+	}
+
+	a.pending = &pendingValue{
+		key:  key,
+		kind: kind,
+	}
+
+	return a.pending
+}
+
+// add buffers or streams the element of the value, depending on its size.
+func (a *ValueAdapter) add(p *pendingValue, elem Element, size int) error {
+	if p == nil {
+		return ErrSkipKey
+	}
+
+	if p.streamed {
+		return p.emit(elem)
+	}
+
+	p.elems = append(p.elems, elem)
+	p.size += size
+	if (a.opts.MaxElements > 0 && len(p.elems) > a.opts.MaxElements) ||
+		(a.opts.MaxBytes > 0 && p.size > a.opts.MaxBytes) {
+		return a.fallback(p)
+	}
+
+	return nil
+}
+
+// fallback streams the elements buffered so far to the
+// handler, along with the rest of the elements of the value.
+func (a *ValueAdapter) fallback(p *pendingValue) error {
+	h := a.handler
+	p.streamed = true
+	switch p.kind {
+	case KindList:
+		fn := h.ListEntryHandler(p.key)
+		p.emit = func(elem Element) error {
+			return fn(elem.Value)
+		}
+	case KindSet:
+		fn := h.SetEntryHandler(p.key)
+		p.emit = func(elem Element) error {
+			return fn(elem.Value)
+		}
+	case KindZset:
+		fn := h.ZsetEntryHandler(p.key)
+		p.emit = func(elem Element) error {
+			return fn(elem.Value, elem.Score)
+		}
+	case KindHash:
+		if p.withExp {
+			fn := h.HashWithExpEntryHandler(p.key)
+			p.emit = func(elem Element) error {
+				return fn(elem.Field, elem.Value, elem.ExpireTime)
+			}
+		} else {
+			fn := h.HashEntryHandler(p.key)
+			p.emit = func(elem Element) error {
+				return fn(elem.Field, elem.Value)
+			}
+		}
+	case KindStream:
+		entryFn := h.StreamEntryHandler(p.key)
+		var groupFn func(StreamConsumerGroup) error
+		p.emit = func(elem Element) error {
+			if elem.StreamEntry != nil {
+				return entryFn(*elem.StreamEntry)
+			}
+
+			if groupFn == nil {
+				groupFn = h.StreamGroupHandler(p.key)
+			}
+			return groupFn(*elem.StreamGroup)
+		}
+	}
+
+	elems := p.elems
+	p.elems = nil
+	for _, elem := range elems {
+		err := p.emit(elem)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// build returns the value from the buffered elements.
+func (p *pendingValue) build() Value {
+	switch p.kind {
+	case KindList:
+		list := make(List, len(p.elems))
+		for i, elem := range p.elems {
+			list[i] = elem.Value
+		}
+		return list
+	case KindSet:
+		set := make(Set, len(p.elems))
+		for i, elem := range p.elems {
+			set[i] = elem.Value
+		}
+		return set
+	case KindZset:
+		zset := make(ZSet, len(p.elems))
+		for _, elem := range p.elems {
+			zset[elem.Value] = elem.Score
+		}
+		return zset
+	case KindHash:
+		hash := make(Hash, len(p.elems))
+		for _, elem := range p.elems {
+			hash[elem.Field] = HashEntry{
+				Value:          elem.Value,
+				ExpirationTime: elem.ExpireTime,
+			}
+		}
+		return hash
+	case KindStream:
+		stream := &Stream{}
+		for _, elem := range p.elems {
+			if elem.StreamEntry != nil {
+				stream.Entries = append(stream.Entries, *elem.StreamEntry)
+				stream.Length++
+				stream.LastID = maxStreamID(stream.LastID, elem.StreamEntry.ID)
+			} else {
+				stream.Groups = append(stream.Groups, *elem.StreamGroup)
+				// the groups might be delivered past the last entry,
+				// whose successors might be deleted
+				stream.LastID = maxStreamID(stream.LastID, elem.StreamGroup.LastID)
+			}
+		}
+		return stream
+	default:
+		return p.value
+	}
+}
+
+// ending returns whether the ending callback of the
+// value with the given key is passed to the handler.
+func (a *ValueAdapter) ending(key string) bool {
+	return a.pending != nil && a.pending.key == key && a.pending.streamed
+}
+
+func (a *ValueAdapter) AllowPartialRead() bool {
+	return a.handler.AllowPartialRead()
+}
+
+func (a *ValueAdapter) RequireStrictEOF() bool {
+	return a.handler.RequireStrictEOF()
+}
+
+func (a *ValueAdapter) HandleSelectDB(dbnum uint64) error {
+	if dbHandler, ok := a.handler.(DBHandler); ok {
+		return dbHandler.HandleSelectDB(dbnum)
+	}
+
+	if dbnum != 0 && !a.handler.AllowPartialRead() {
+		return errors.New("multiple databases are not supported when the partial restore is not allowed")
+	}
+
+	a.active = dbnum == 0
+	return nil
+}
+
+func (a *ValueAdapter) HandleAux(key, value string) error {
+	if auxHandler, ok := a.handler.(AuxHandler); ok {
+		return auxHandler.HandleAux(key, value)
+	}
+
+	return nil
+}
+
+func (a *ValueAdapter) HandleModuleAux(aux ModuleAux) error {
+	if moduleAuxHandler, ok := a.handler.(ModuleAuxHandler); ok {
+		return moduleAuxHandler.HandleModuleAux(aux)
+	}
+
+	return nil
+}
+
+func (a *ValueAdapter) HandleFreq(key string, freq uint8) {
+	if evictionHandler, ok := a.handler.(EvictionHandler); ok && a.active {
+		evictionHandler.HandleFreq(key, freq)
+	}
+}
+
+func (a *ValueAdapter) HandleIdle(key string, idle time.Duration) {
+	if evictionHandler, ok := a.handler.(EvictionHandler); ok && a.active {
+		evictionHandler.HandleIdle(key, idle)
+	}
+}
+
+func (a *ValueAdapter) HandleExpireTime(key string, expireTime time.Duration) {
+	if a.active {
+		a.handler.HandleExpireTime(key, expireTime)
+	}
+}
+
+func (a *ValueAdapter) HandleString(key, value string) error {
+	p := a.begin(key, KindString)
+	if p != nil {
+		p.value = String(value)
+	}
+
+	return nil
+}
+
+func (a *ValueAdapter) ListEntryHandler(key string) func(elem string) error {
+	p := a.begin(key, KindList)
+	return func(elem string) error {
+		return a.add(p, Element{Value: elem}, len(elem))
+	}
+}
+
+func (a *ValueAdapter) HandleListEnding(key string, entriesRead uint64) {
+	if a.ending(key) {
+		a.handler.HandleListEnding(key, entriesRead)
+	}
+}
+
+func (a *ValueAdapter) SetEntryHandler(key string) func(elem string) error {
+	p := a.begin(key, KindSet)
+	return func(elem string) error {
+		return a.add(p, Element{Value: elem}, len(elem))
+	}
+}
+
+func (a *ValueAdapter) ZsetEntryHandler(key string) func(elem string, score float64) error {
+	p := a.begin(key, KindZset)
+	return func(elem string, score float64) error {
+		return a.add(p, Element{Value: elem, Score: score}, len(elem)+8)
+	}
+}
+
+func (a *ValueAdapter) HandleZsetEnding(key string, entriesRead uint64) {
+	if a.ending(key) {
+		a.handler.HandleZsetEnding(key, entriesRead)
+	}
+}
+
+func (a *ValueAdapter) HashEntryHandler(key string) func(field, value string) error {
+	p := a.begin(key, KindHash)
+	return func(field, value string) error {
+		return a.add(p, Element{Field: field, Value: value}, len(field)+len(value))
+	}
+}
+
+func (a *ValueAdapter) HashWithExpEntryHandler(key string) func(field string, value string, ttl time.Time) error {
+	p := a.begin(key, KindHash)
+	if p != nil {
+		p.withExp = true
+	}
+
+	return func(field string, value string, ttl time.Time) error {
+		return a.add(p, Element{Field: field, Value: value, ExpireTime: ttl}, len(field)+len(value))
+	}
+}
+
+func (a *ValueAdapter) HandleModule(key, value string, marker ModuleMarker) error {
+	p := a.begin(key, KindModule)
+	if p == nil {
+		return nil
+	}
+
+	if marker == JSONModuleMarker {
+		p.value = JSON(value)
+		return nil
+	}
+
+	p.streamed = true
+	return a.handler.HandleModule(key, value, marker)
+}
+
+func (a *ValueAdapter) StreamEntryHandler(key string) func(entry StreamEntry) error {
+	p := a.begin(key, KindStream)
+	return func(entry StreamEntry) error {
+		size := 16 // id
+		for _, v := range entry.Value {
+			size += len(v)
+		}
+		return a.add(p, Element{StreamEntry: &entry}, size)
+	}
+}
+
+func (a *ValueAdapter) StreamGroupHandler(key string) func(group StreamConsumerGroup) error {
+	p := a.pending
+	if p == nil || p.key != key {
+		p = a.begin(key, KindStream)
+	}
+
+	return func(group StreamConsumerGroup) error {
+		return a.add(p, Element{StreamGroup: &group}, len(group.Name))
+	}
+}
+
+func (a *ValueAdapter) HandleStreamEnding(key string, entriesRead uint64) {
+	if a.ending(key) {
+		a.handler.HandleStreamEnding(key, entriesRead)
+	}
+}
+
+func (a *ValueAdapter) HandleLibrary(code string) error {
+	return a.handler.HandleLibrary(code)
+}
+
+func (a *ValueAdapter) HandleKeyInfo(info KeyInfo) error {
+	p := a.pending
+	a.pending = nil
+	if p == nil || p.key != info.Key {
+		return nil
+	}
+
+	if p.streamed {
+		if keyInfoHandler, ok := a.handler.(KeyInfoHandler); ok {
+			return keyInfoHandler.HandleKeyInfo(info)
+		}
+
+		return nil
+	}
+
+	err := a.handler.HandleValue(info.Key, p.build(), info)
+	if errors.Is(err, ErrSkipKey) {
+		return nil
+	}
+
+	return err
+}
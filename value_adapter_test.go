@@ -0,0 +1,218 @@
+package rdb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// wholeValueDummyDB adds the complete values to the db, in the same way
+// as the handler methods would do, and records the keys streamed to it.
+type wholeValueDummyDB struct {
+	*dummyDB
+	infos    map[string]KeyInfo
+	streamed []string
+}
+
+func newWholeValueDummyDB() *wholeValueDummyDB {
+	return &wholeValueDummyDB{
+		dummyDB: newDummyDB(),
+		infos:   make(map[string]KeyInfo),
+	}
+}
+
+func (db *wholeValueDummyDB) HandleValue(key string, value Value, info KeyInfo) error {
+	db.infos[key] = info
+	switch v := value.(type) {
+	case String:
+		return db.HandleString(key, string(v))
+	case JSON:
+		return db.HandleModule(key, string(v), JSONModuleMarker)
+	case List:
+		for _, elem := range v {
+			_ = db.ListEntryHandler(key)(elem)
+		}
+	case Set:
+		for _, elem := range v {
+			_ = db.SetEntryHandler(key)(elem)
+		}
+	case ZSet:
+		for elem, score := range v {
+			_ = db.ZsetEntryHandler(key)(elem, score)
+		}
+	case Hash:
+		for field, entry := range v {
+			_ = db.HashWithExpEntryHandler(key)(field, entry.Value, entry.ExpirationTime)
+		}
+	case *Stream:
+		for _, entry := range v.Entries {
+			_ = db.StreamEntryHandler(key)(entry)
+		}
+		for _, group := range v.Groups {
+			_ = db.StreamGroupHandler(key)(group)
+		}
+	}
+
+	return nil
+}
+
+func (db *wholeValueDummyDB) HandleKeyInfo(info KeyInfo) error {
+	db.streamed = append(db.streamed, info.Key)
+	return nil
+}
+
+func TestValueAdapter(t *testing.T) {
+	for _, name := range []string{"all-types.rdb", "stream-with-pel.rdb", "expiretime-sec.rdb"} {
+		t.Run(name, func(t *testing.T) {
+			expected := readScanExpected(t, name)
+
+			db := newWholeValueDummyDB()
+			err := ReadFile(filepath.Join(dumpsPath, name), NewValueAdapter(db, ValueAdapterOptions{}))
+			require.NoError(t, err)
+			require.Empty(t, db.streamed)
+
+			for key, expireTime := range expected.expireTimes {
+				require.Equal(t, time.UnixMilli(expireTime.Milliseconds()), db.infos[key].ExpireTime)
+			}
+
+			require.Equal(t, expected, db.dummyDB)
+		})
+	}
+}
+
+// writeValueAdapterDump writes a file with both
+// the small and the large values of all types.
+func writeValueAdapterDump(t *testing.T) string {
+	ds := NewDataset()
+	db := ds.DB(0)
+	ttl := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	for i, n := range []int{2, 20} {
+		suffix := fmt.Sprint(n)
+		list := make(List, n)
+		set := make(Set, n)
+		zset := make(ZSet)
+		hash := make(Hash)
+		stream := &Stream{}
+		for j := 0; j < n; j++ {
+			elem := fmt.Sprintf("elem-%d", j)
+			list[j] = elem
+			set[j] = elem
+			zset[elem] = float64(j)
+			hash[elem] = HashEntry{Value: elem}
+			if i > 0 && j%2 == 0 {
+				hash[elem] = HashEntry{Value: elem, ExpirationTime: ttl}
+			}
+
+			id := StreamID{Millis: uint64(j + 1)}
+			stream.Entries = append(stream.Entries, StreamEntry{ID: id, Value: []string{"f", elem}})
+			stream.Length++
+			stream.LastID = id
+		}
+		stream.Groups = []StreamConsumerGroup{{Name: "g", LastID: stream.LastID, Consumers: []StreamConsumer{}}}
+
+		db["string-"+suffix] = &Item{Value: String(strings.Repeat("x", n))}
+		db["list-"+suffix] = &Item{Value: list, ExpireTime: ttl}
+		db["set-"+suffix] = &Item{Value: set}
+		db["zset-"+suffix] = &Item{Value: zset}
+		db["hash-"+suffix] = &Item{Value: hash}
+		db["stream-"+suffix] = &Item{Value: stream}
+	}
+
+	path := filepath.Join(t.TempDir(), "value-adapter.rdb")
+	require.NoError(t, SaveFile(path, ds))
+	return path
+}
+
+func TestValueAdapter_fallback(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ValueAdapterOptions
+	}{
+		{name: "max elements", opts: ValueAdapterOptions{MaxElements: 3}},
+		{name: "max bytes", opts: ValueAdapterOptions{MaxBytes: 64}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeValueAdapterDump(t)
+			expected := newDummyDB()
+			require.NoError(t, ReadFile(path, expected))
+
+			db := newWholeValueDummyDB()
+			err := ReadFile(path, NewValueAdapter(db, tc.opts))
+			require.NoError(t, err)
+			// the large collections are streamed, and the rest are passed as a whole
+			require.ElementsMatch(t, []string{"list-20", "set-20", "zset-20", "hash-20", "stream-20"}, db.streamed)
+			require.Len(t, db.infos, 7)
+			require.Contains(t, db.infos, "string-20")
+
+			// the ending callbacks are called only for the streamed keys
+			for _, m := range []map[string]uint64{db.listEntriesRead, db.zsetEntriesRead, db.streamEntriesRead} {
+				for key := range m {
+					require.Contains(t, db.streamed, key)
+				}
+				clear(m)
+			}
+			clear(expected.listEntriesRead)
+			clear(expected.zsetEntriesRead)
+			clear(expected.streamEntriesRead)
+
+			require.Equal(t, expected, db.dummyDB)
+		})
+	}
+}
+
+func TestValueAdapter_multiDB(t *testing.T) {
+	db := newWholeValueDummyDB()
+	err := ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), NewValueAdapter(db, ValueAdapterOptions{}))
+	require.ErrorContains(t, err, "multiple databases are not supported")
+
+	db = newWholeValueDummyDB()
+	db.partialRead = true
+	err = ReadFile(filepath.Join(dumpsPath, "multi-db.rdb"), NewValueAdapter(db, ValueAdapterOptions{}))
+	require.NoError(t, err)
+
+	require.Contains(t, db.strings, "00")
+	require.NotContains(t, db.strings, "01")
+	for _, info := range db.infos {
+		require.Equal(t, uint64(0), info.DB)
+	}
+}
+
+// valueCaptureDB records the complete values passed to it.
+type valueCaptureDB struct {
+	BaseHandler
+	values map[string]Value
+}
+
+func (db *valueCaptureDB) HandleValue(key string, value Value, info KeyInfo) error {
+	db.values[key] = value
+	return nil
+}
+
+func TestValueAdapter_streamLastID(t *testing.T) {
+	db := &valueCaptureDB{values: make(map[string]Value)}
+	a := NewValueAdapter(db, ValueAdapterOptions{})
+
+	streams := map[string]StreamID{
+		// the entries after the groups are deleted
+		"deleted-entries": {Millis: 7},
+		"read-entries":    {Millis: 1},
+	}
+
+	for key, groupID := range streams {
+		entryHandler := a.StreamEntryHandler(key)
+		require.NoError(t, entryHandler(StreamEntry{ID: StreamID{Millis: 1}, Value: []string{"f", "v"}}))
+		require.NoError(t, entryHandler(StreamEntry{ID: StreamID{Millis: 2, Seq: 1}, Value: []string{"f", "v"}}))
+		require.NoError(t, a.StreamGroupHandler(key)(StreamConsumerGroup{Name: "g", LastID: groupID}))
+		require.NoError(t, a.HandleKeyInfo(KeyInfo{Key: key}))
+	}
+
+	require.Equal(t, StreamID{Millis: 7}, db.values["deleted-entries"].(*Stream).LastID)
+	require.Equal(t, StreamID{Millis: 2, Seq: 1}, db.values["read-entries"].(*Stream).LastID)
+	require.Equal(t, uint64(2), db.values["read-entries"].(*Stream).Length)
+}
@@ -1,6 +1,7 @@
 package rdb
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -24,6 +25,9 @@ type VerifyFileOptions struct {
 	MaxLibrarySize     int
 	AllowPartialVerify bool
 	RequireStrictEOF   bool
+	// Progress is called after each entry is verified, and once the
+	// file is verified completely, with the progress so far.
+	Progress func(Progress)
 }
 
 func (o *VerifyFileOptions) maybeSetDefaults() {
@@ -51,6 +55,12 @@ func (o *VerifyFileOptions) maybeSetDefaults() {
 // VerifyFile verifies that the given RDB file is not corrupt,
 // or does not exceed the limits in the given options.
 func VerifyFile(path string, opts VerifyFileOptions) error {
+	return VerifyFileContext(context.Background(), path, opts)
+}
+
+// VerifyFileContext verifies the given RDB file in the same way as VerifyFile,
+// and stops verifying with the error of the context once it is done.
+func VerifyFileContext(ctx context.Context, path string, opts VerifyFileOptions) error {
 	opts.maybeSetDefaults()
 	v := &verifier{
 		maxDataSize:        opts.MaxDataSize,
@@ -76,7 +86,7 @@ func VerifyFile(path string, opts VerifyFileOptions) error {
 	fileLen := info.Size()
 	buf := newFileBackedBuffer(file, int(fileLen), minInt(int(fileLen), 1<<20))
 
-	return readFile(buf, v, uint64(opts.MaxEntrySize))
+	return readFile(ctx, buf, v, uint64(opts.MaxEntrySize), ReadOptions{Progress: opts.Progress})
 }
 
 type VerifyReaderOptions struct {
@@ -87,6 +97,9 @@ type VerifyReaderOptions struct {
 	MaxLibrarySize     int
 	AllowPartialVerify bool
 	RequireStrictEOF   bool
+	// Progress is called after each entry is verified, and once the
+	// file is verified completely, with the progress so far.
+	Progress func(Progress)
 }
 
 func (o *VerifyReaderOptions) maybeSetDefaults() {
@@ -114,6 +127,13 @@ func (o *VerifyReaderOptions) maybeSetDefaults() {
 // VerifyReader verifies that the given RDB reader is not corrupt,
 // or does not exceed the limits in the given options.
 func VerifyReader(r io.Reader, opts VerifyReaderOptions) error {
+	return VerifyReaderContext(context.Background(), r, opts)
+}
+
+// VerifyReaderContext verifies the given RDB reader in the same way as
+// VerifyReader, and stops verifying with the error of the context once
+// it is done.
+func VerifyReaderContext(ctx context.Context, r io.Reader, opts VerifyReaderOptions) error {
 	opts.maybeSetDefaults()
 	v := &verifier{
 		maxDataSize:        opts.MaxDataSize,
@@ -127,7 +147,7 @@ func VerifyReader(r io.Reader, opts VerifyReaderOptions) error {
 
 	buf := newForwardOnlyBuffer(r)
 
-	return readFile(buf, v, uint64(opts.MaxEntrySize))
+	return readFile(ctx, buf, v, uint64(opts.MaxEntrySize), ReadOptions{Progress: opts.Progress})
 }
 
 type VerifyValueOptions struct {
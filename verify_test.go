@@ -1,6 +1,7 @@
 package rdb
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -90,6 +91,44 @@ func TestVerifyFile_biggerThanBufferSizeFile(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestVerifyFileContext(t *testing.T) {
+	var last Progress
+	err := VerifyFileContext(context.Background(), bigDumpPath, VerifyFileOptions{
+		Progress: func(p Progress) {
+			last = p
+		},
+	})
+	require.NoError(t, err)
+	require.NotZero(t, last.Keys)
+	require.Equal(t, last.TotalBytes, last.BytesRead)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err = VerifyFileContext(ctx, bigDumpPath, VerifyFileOptions{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestVerifyReaderContext(t *testing.T) {
+	file, err := os.Open(bigDumpPath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var keys uint64
+	err = VerifyReaderContext(ctx, file, VerifyReaderOptions{
+		Progress: func(p Progress) {
+			keys = p.Keys
+			cancel()
+		},
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, uint64(1), keys)
+}
+
 func TestVerifyValue(t *testing.T) {
 	dump, err := os.ReadFile(stringRDBValuePath)
 	require.NoError(t, err)
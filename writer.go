@@ -141,6 +141,7 @@ type HashEntry struct {
 }
 
 // WriteHashWithMetadata writes the given hash as the TypeHashMetadata with expiration metadata for each field.
+// The fields with zero ExpirationTime are written without TTLs.
 func (w *Writer) WriteHashWithMetadata(hash map[string]HashEntry) error {
 	// Redis writes minimum expiration time at the begining and then
 	// writes only the diff for the individual elements to reduce the disk size.
@@ -158,9 +159,10 @@ func (w *Writer) WriteHashWithMetadata(hash map[string]HashEntry) error {
 	}
 
 	for key, value := range hash {
+		// the TTLs are written with +1, as 0 is reserved for the fields without TTLs
 		ms := int64(0)
 		if !value.ExpirationTime.IsZero() {
-			ms = value.ExpirationTime.UnixMilli()
+			ms = value.ExpirationTime.UnixMilli() + 1
 		}
 		err = w.writeLen(uint64(ms))
 		if err != nil {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -189,6 +190,44 @@ func TestWriteHash(t *testing.T) {
 	require.Equal(t, dump, writer.GetBuffer())
 }
 
+func TestWriteHashWithMetadata(t *testing.T) {
+	hash := map[string]HashEntry{
+		"a": {Value: "1", ExpirationTime: time.UnixMilli(1700000000123)},
+		"b": {Value: "2"},
+		"c": {Value: "3", ExpirationTime: time.UnixMilli(1)},
+	}
+
+	writer := NewWriter()
+	require.NoError(t, writer.WriteType(TypeHashMetadata))
+	require.NoError(t, writer.WriteHashWithMetadata(hash))
+
+	reader := valueReader{
+		buf: newMemoryBackedBuffer(writer.GetBuffer()),
+	}
+
+	ot, err := reader.ReadType()
+	require.NoError(t, err)
+	require.Equal(t, TypeHashMetadata, ot)
+
+	read := make(map[string]HashEntry)
+	err = reader.ReadHashMetadata(func(field, value string, exp time.Time) error {
+		read[field] = HashEntry{Value: value, ExpirationTime: exp}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, read, len(hash))
+	for field, entry := range hash {
+		require.Equal(t, entry.Value, read[field].Value)
+		if entry.ExpirationTime.IsZero() {
+			require.True(t, read[field].ExpirationTime.IsZero())
+			continue
+		}
+
+		require.Equal(t, entry.ExpirationTime.UnixMilli(), read[field].ExpirationTime.UnixMilli())
+	}
+}
+
 func TestJSON(t *testing.T) {
 	path := filepath.Join(valueDumpsPath, "module2-jsonv3.bin")
 